@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,18 +22,30 @@ import (
 
 // Server store the stats / data of every deployment
 type Server struct {
-	Config   *viper.Viper
-	ConfigDB *db.ConfigDB
+	Config    *viper.Viper
+	ConfigDB  db.ConfigStore
+	MetricsDB db.MetricsStore
 
 	JobManager *jobs.JobManager
 }
 
 // NewServer return an instance of Server struct.
-func NewServer(config *viper.Viper) *Server {
-	return &Server{
-		Config:   config,
-		ConfigDB: db.NewConfigDB(config),
+func NewServer(config *viper.Viper) (*Server, error) {
+	configDB, err := db.NewConfigStore(config)
+	if err != nil {
+		return nil, errors.New("Unable to create config store: " + err.Error())
+	}
+
+	metricsDB, err := db.NewMetricsStore(config)
+	if err != nil {
+		return nil, errors.New("Unable to create metrics store: " + err.Error())
 	}
+
+	return &Server{
+		Config:    config,
+		ConfigDB:  configDB,
+		MetricsDB: metricsDB,
+	}, nil
 }
 
 // StartServer starts a web server
@@ -83,11 +97,47 @@ func (server *Server) StartServer() error {
 	sizingGroup := router.Group("/sizing")
 	{
 		sizingGroup.POST("/aws/:appName", server.runAWSSizing)
+		sizingGroup.POST("/aws/:appName/resume", server.resumeAWSSizing)
+		sizingGroup.GET("/aws/:appName/recommendation", server.getSizingRecommendation)
+		sizingGroup.POST("/gcp/:appName", server.runGCPSizing)
+	}
+
+	pipelinesGroup := router.Group("/pipelines")
+	{
+		pipelinesGroup.POST("/:appName", server.runPipeline)
+		pipelinesGroup.POST("/:appName/resume", server.resumePipeline)
+		pipelinesGroup.GET("/:appName/:pipelineId", server.getPipeline)
+	}
+
+	runsGroup := router.Group("/runs")
+	{
+		runsGroup.POST("/:runId/cancel", server.cancelRun)
+		runsGroup.PUT("/:runId/priority", server.setRunPriority)
+		runsGroup.GET("/:runId/results", server.getRunResults)
+		runsGroup.GET("/:runId/events", server.streamRunEvents)
+	}
+
+	resultsGroup := router.Group("/results")
+	{
+		resultsGroup.GET("/calibration/:appName", server.getCalibrationResults)
+		resultsGroup.GET("/profiling/:appName", server.getProfilingResults)
+		resultsGroup.GET("/sizing/:appName", server.getSizingResults)
+		resultsGroup.GET("/captureMetrics/:appName", server.getCaptureMetricsResults)
+		resultsGroup.GET("/resourceUsage/:appName", server.getResourceUsageResults)
+	}
+
+	router.GET("/queue", server.getQueue)
+
+	clustersGroup := router.Group("/clusters")
+	{
+		clustersGroup.GET("", server.getClusters)
+		clustersGroup.DELETE("/:deploymentId", server.deleteCluster)
+		clustersGroup.POST("/gc", server.gcClusters)
 	}
 
 	router.GET("/state/:runId", server.state)
 
-	jobManager, err := jobs.NewJobManager(server.Config)
+	jobManager, err := jobs.NewJobManager(server.Config, server.restoreJob)
 	if err != nil {
 		return errors.New("Unable to create job manager: " + err.Error())
 	}
@@ -99,6 +149,15 @@ func (server *Server) StartServer() error {
 
 func (server *Server) runAWSSizing(c *gin.Context) {
 	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
 
 	glog.V(1).Infof("Received request to run aws sizing for app: %s", appName)
 
@@ -113,72 +172,95 @@ func (server *Server) runAWSSizing(c *gin.Context) {
 		return
 	}
 
-	// TODO: We assume region is us-east-1
-	region := "us-east-1"
 	skipFlag := c.DefaultQuery("skipUnreserveOnFailure", "false") == "true"
 	allInstances := c.DefaultQuery("allInstances", "false") == "true"
-	instances := []string{}
-	for _, instance := range strings.Split(c.DefaultQuery("instances", ""), ",") {
-		if instance != "" {
-			instances = append(instances, instance)
-		}
+	calibrationRunId := c.DefaultQuery("calibrationRunId", "")
+	instances := parseListQuery(c, "instances")
+	regions := parseListQuery(c, "region")
+	if len(regions) > 1 && !allInstances {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Multiple regions are only supported when sizing all instances",
+		})
+		return
+	}
+
+	locations, err := runners.ResolveAWSLocations(server.Config, regions, parseListQuery(c, "availabilityZone"))
+	if err != nil {
+		message := "Unable to resolve sizing location: " + err.Error()
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
 	}
 
-	id := ""
 	if allInstances {
-		var awsRegionNodeTypeConfig *models.AWSRegionNodeTypeConfig
-		previousGenerations := []string{}
-		nodeTypeConfig, err := server.ConfigDB.GetNodeTypeConfig(region)
-		if err != nil {
-			message := fmt.Sprintf("Unable to get node type for %s: %s", region, err.Error())
-			glog.Infof(message)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": true,
-				"data":  message,
-			})
-			return
-		}
-		awsRegionNodeTypeConfig = nodeTypeConfig
-		previousGeneration, err := server.ConfigDB.GetPreviousGenerationConfig(region)
-		if err != nil {
-			message := fmt.Sprintf("Unable to get previous generation for %s: %s", region, err.Error())
-			glog.Infof(message)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": true,
-				"data":  message,
-			})
-			return
-		}
+		// Each region is sized by its own run, as the instance types and
+		// their prices differ between regions.
+		runs := []*runners.AWSSizingAllInstancesRun{}
+		for _, location := range locations {
+			nodeTypeConfig, previousGenerations, err := server.getAWSNodeTypes(location.Region)
+			if err != nil {
+				glog.Infof(err.Error())
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": true,
+					"data":  err.Error(),
+				})
+				return
+			}
 
-		for _, awsNodeType := range previousGeneration.Data {
-			previousGenerations = append(previousGenerations, awsNodeType.Name)
+			run, err := runners.NewAWSSizingAllInstancesRun(
+				server.JobManager,
+				applicationConfig,
+				server.Config,
+				nodeTypeConfig,
+				previousGenerations,
+				location.AvailabilityZone,
+				"",
+				skipFlag)
+			if err != nil {
+				message := fmt.Sprintf("Unable to create aws sizing all instances run: " + err.Error())
+				glog.Infof(message)
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": true,
+					"data":  message,
+				})
+				return
+			}
+			runs = append(runs, run)
 		}
 
-		run, err := runners.NewAWSSizingAllInstancesRun(
-			server.JobManager,
-			applicationConfig,
-			server.Config,
-			awsRegionNodeTypeConfig,
-			previousGenerations,
-			allInstances,
-			skipFlag)
-		if err != nil {
-			message := fmt.Sprintf("Unable to create aws sizing all instances run: " + err.Error())
-			glog.Infof(message)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": true,
-				"data":  message,
-			})
-			return
+		// The runs are only queued once every region is validated, so that a
+		// bad region doesn't leave the other regions sizing.
+		runIds := []string{}
+		for _, run := range runs {
+			run.SetPriority(priority)
+			run.SetCallbackUrl(callbackUrl)
+			run.SetUserId(c.Query("userId"))
+			run.SetCalibrationRunId(calibrationRunId)
+			server.JobManager.AddJob(run)
+			runIds = append(runIds, run.GetId())
 		}
-		id = run.GetId()
-		server.JobManager.AddJob(run)
-	} else if len(instances) > 0 {
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"error":  false,
+			"data":   "",
+			"runId":  runIds[0],
+			"runIds": runIds,
+		})
+		return
+	}
+
+	id := ""
+	if len(instances) > 0 {
 		run, err := runners.NewAWSSizingInstancesRun(
 			server.JobManager,
 			applicationConfig,
 			server.Config,
 			instances,
+			locations[0],
 			skipFlag)
 		if err != nil {
 			message := fmt.Sprintf("Unable to create aws sizing instances run: " + err.Error())
@@ -190,12 +272,17 @@ func (server *Server) runAWSSizing(c *gin.Context) {
 			return
 		}
 		id = run.GetId()
+		run.SetPriority(priority)
+		run.SetCallbackUrl(callbackUrl)
+		run.SetUserId(c.Query("userId"))
+		run.SetCalibrationRunId(calibrationRunId)
 		server.JobManager.AddJob(run)
 	} else {
 		run, err := runners.NewAWSSizingRun(
 			server.JobManager,
 			applicationConfig,
 			server.Config,
+			locations[0],
 			skipFlag)
 		if err != nil {
 			message := fmt.Sprintf("Unable to create aws sizing run: " + err.Error())
@@ -207,6 +294,10 @@ func (server *Server) runAWSSizing(c *gin.Context) {
 			return
 		}
 		id = run.GetId()
+		run.SetPriority(priority)
+		run.SetCallbackUrl(callbackUrl)
+		run.SetUserId(c.Query("userId"))
+		run.SetCalibrationRunId(calibrationRunId)
 		server.JobManager.AddJob(run)
 
 	}
@@ -218,13 +309,236 @@ func (server *Server) runAWSSizing(c *gin.Context) {
 	})
 }
 
+// getAWSNodeTypes returns the node types of the region, and the names of its
+// previous generation node types.
+func (server *Server) getAWSNodeTypes(region string) (*models.AWSRegionNodeTypeConfig, []string, error) {
+	nodeTypeConfig, err := server.ConfigDB.GetNodeTypeConfig(region)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to get node type for %s: %s", region, err.Error())
+	}
+
+	previousGeneration, err := server.ConfigDB.GetPreviousGenerationConfig(region)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to get previous generation for %s: %s", region, err.Error())
+	}
+
+	previousGenerations := []string{}
+	for _, awsNodeType := range previousGeneration.Data {
+		previousGenerations = append(previousGenerations, awsNodeType.Name)
+	}
+
+	return nodeTypeConfig, previousGenerations, nil
+}
+
+// resumeAWSSizing starts an all instances sizing run that only sizes the
+// unfinished and failed instance types of the runId query, or of the latest
+// all instances run of the app in the region query.
+func (server *Server) resumeAWSSizing(c *gin.Context) {
+	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
+
+	glog.V(1).Infof("Received request to resume aws sizing for app: %s", appName)
+
+	applicationConfig, err := server.ConfigDB.GetApplicationConfig(appName)
+	if err != nil {
+		message := fmt.Sprintf("Unable to get application config for %s: %s", appName, err.Error())
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+
+	previous := &runners.AllInstanceRunResults{}
+	if runId := c.Query("runId"); runId != "" {
+		_, err = server.MetricsDB.GetMetricByRunId("allInstance", runId, previous)
+		if err == nil && (previous.AppName != appName || previous.GetCloud() != runners.AWSCloud) {
+			err = fmt.Errorf("Run %s is not an aws sizing run of app %s", runId, appName)
+		}
+	} else {
+		previous, err = runners.GetLatestInstanceRunResults(server.MetricsDB, appName, runners.AWSCloud, c.Query("region"))
+	}
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  "Unable to get sizing results to resume: " + err.Error(),
+		})
+		return
+	}
+
+	if job, err := server.JobManager.FindJob(previous.RunId); err == nil && !jobs.IsFinalState(job.GetState()) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Sizing run %s is still %s", previous.RunId, job.GetState()),
+		})
+		return
+	}
+
+	regions := parseListQuery(c, "region")
+	if previous.Region != "" {
+		regions = []string{previous.Region}
+	}
+
+	locations, err := runners.ResolveAWSLocations(server.Config, regions, parseListQuery(c, "availabilityZone"))
+	if err != nil {
+		message := "Unable to resolve sizing location: " + err.Error()
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+
+	nodeTypeConfig, previousGenerations, err := server.getAWSNodeTypes(locations[0].Region)
+	if err != nil {
+		glog.Infof(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  err.Error(),
+		})
+		return
+	}
+
+	run, err := runners.NewAWSSizingAllInstancesRun(
+		server.JobManager,
+		applicationConfig,
+		server.Config,
+		nodeTypeConfig,
+		previousGenerations,
+		locations[0].AvailabilityZone,
+		previous.RunId,
+		c.DefaultQuery("skipUnreserveOnFailure", "false") == "true")
+	if err != nil {
+		message := fmt.Sprintf("Unable to create aws sizing all instances run: " + err.Error())
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+
+	run.SetPriority(priority)
+	run.SetCallbackUrl(callbackUrl)
+	run.SetUserId(c.Query("userId"))
+	run.SetCalibrationRunId(c.DefaultQuery("calibrationRunId", ""))
+	server.JobManager.AddJob(run)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"error":        false,
+		"data":         "",
+		"runId":        run.GetId(),
+		"resumedRunId": previous.RunId,
+	})
+}
+
+// runGCPSizing sizes the app on the machine types of the region query, which
+// defaults to the gcp.region config, or on the machine types of the instances
+// query.
+func (server *Server) runGCPSizing(c *gin.Context) {
+	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
+
+	glog.V(1).Infof("Received request to run gcp sizing for app: %s", appName)
+
+	applicationConfig, err := server.ConfigDB.GetApplicationConfig(appName)
+	if err != nil {
+		message := fmt.Sprintf("Unable to get application config for %s: %s", appName, err.Error())
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+
+	region := c.DefaultQuery("region", server.Config.GetString("gcp.region"))
+	if region == "" {
+		region = "us-central1"
+	}
+	skipFlag := c.DefaultQuery("skipUnreserveOnFailure", "false") == "true"
+	calibrationRunId := c.DefaultQuery("calibrationRunId", "")
+	instances := parseListQuery(c, "instances")
+
+	machineTypeConfig, err := server.ConfigDB.GetGCPMachineTypeConfig(region)
+	if err != nil {
+		message := fmt.Sprintf("Unable to get machine types for %s: %s", region, err.Error())
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+
+	run, err := runners.NewGCPSizingRun(
+		server.JobManager,
+		applicationConfig,
+		server.Config,
+		machineTypeConfig,
+		instances,
+		skipFlag)
+	if err != nil {
+		message := fmt.Sprintf("Unable to create gcp sizing run: " + err.Error())
+		glog.Infof(message)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  message,
+		})
+		return
+	}
+	run.SetPriority(priority)
+	run.SetCallbackUrl(callbackUrl)
+	run.SetUserId(c.Query("userId"))
+	run.SetCalibrationRunId(calibrationRunId)
+	server.JobManager.AddJob(run)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"error": false,
+		"data":  "",
+		"runId": run.GetId(),
+	})
+}
+
 func (server *Server) runBenchmarks(c *gin.Context) {
 	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
 
 	var request struct {
 		StartingIntensity int     `json:"startingIntensity" binding:"required"`
-		Step              int     `json:"step" binding:"required"`
+		Step              int     `json:"step"`
 		SloTolerance      float64 `json:"sloTolerance"`
+		CalibrationRunId  string  `json:"calibrationRunId"`
+		// SearchMode is either linear (default) or binary.
+		SearchMode string `json:"searchMode"`
+		Precision  int    `json:"precision"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -262,6 +576,8 @@ func (server *Server) runBenchmarks(c *gin.Context) {
 		request.StartingIntensity,
 		request.Step,
 		request.SloTolerance,
+		request.SearchMode,
+		request.Precision,
 		server.Config)
 
 	if err != nil {
@@ -274,6 +590,10 @@ func (server *Server) runBenchmarks(c *gin.Context) {
 
 	log := run.ProfileLog
 	log.Logger.Infof("Queueing benchmark job %s for app %s...", run.Id, appName)
+	run.SetPriority(priority)
+	run.SetCallbackUrl(callbackUrl)
+	run.SetUserId(c.Query("userId"))
+	run.SetCalibrationRunId(request.CalibrationRunId)
 	server.JobManager.AddJob(run)
 
 	c.JSON(http.StatusAccepted, gin.H{
@@ -285,6 +605,15 @@ func (server *Server) runBenchmarks(c *gin.Context) {
 
 func (server *Server) captureClusterMetrics(c *gin.Context) {
 	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
 
 	var request struct {
 		LoadTesters []models.LoadTester `json:"loadTesters"`
@@ -292,7 +621,8 @@ func (server *Server) captureClusterMetrics(c *gin.Context) {
 			Name      string `json:"name"`
 			Intensity int    `json:"intensity"`
 		} `json:"benchmarks"`
-		WaitTime string `json:"duration" binding:"required"`
+		WaitTime      string                      `json:"duration" binding:"required"`
+		MetricsSource *models.MetricsSourceConfig `json:"metricsSource"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -368,6 +698,7 @@ func (server *Server) captureClusterMetrics(c *gin.Context) {
 					foundBenchmark,
 					benchmarkIntensity,
 					waitTime,
+					request.MetricsSource,
 					skipFlag,
 					server.Config)
 				if err != nil {
@@ -385,6 +716,9 @@ func (server *Server) captureClusterMetrics(c *gin.Context) {
 	for _, run := range runs {
 		log := run.ProfileLog
 		log.Logger.Infof("Queueing capture metrics job %s for app %s...", run.Id, appName)
+		run.SetPriority(priority)
+		run.SetCallbackUrl(callbackUrl)
+		run.SetUserId(c.Query("userId"))
 		server.JobManager.AddJob(run)
 	}
 
@@ -396,6 +730,15 @@ func (server *Server) captureClusterMetrics(c *gin.Context) {
 
 func (server *Server) runCalibration(c *gin.Context) {
 	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
 
 	applicationConfig, err := server.ConfigDB.GetApplicationConfig(appName)
 	if err != nil {
@@ -418,6 +761,9 @@ func (server *Server) runCalibration(c *gin.Context) {
 
 	log := run.ProfileLog
 	log.Logger.Infof("Running calibration job %s for app %s...", run.Id, appName)
+	run.SetPriority(priority)
+	run.SetCallbackUrl(callbackUrl)
+	run.SetUserId(c.Query("userId"))
 	server.JobManager.AddJob(run)
 
 	c.JSON(http.StatusAccepted, gin.H{
@@ -445,10 +791,539 @@ func (server *Server) state(c *gin.Context) {
 		})
 	} else {
 		c.JSON(http.StatusAccepted, gin.H{
-			"error": false,
-			"data":  "",
-			"state": result.GetState(),
+			"error":      false,
+			"data":       "",
+			"state":      result.GetState(),
+			"summary":    result.GetSummary(),
+			"deliveries": server.JobManager.JobStore.GetDeliveries(runId),
+			"progress":   server.JobManager.JobStore.Events.GetProgress(runId),
+		})
+	}
+
+}
+
+func (server *Server) restoreJob(
+	jobManager *jobs.JobManager,
+	runId string,
+	request jobs.JobRequest) (jobs.Job, error) {
+	return runners.RestoreJob(jobManager, server.Config, runId, request)
+}
+
+func (server *Server) cancelRun(c *gin.Context) {
+	runId := c.Param("runId")
+	if _, err := server.JobManager.FindJob(runId); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Job %s not found", runId),
+		})
+		return
+	}
+
+	if err := server.JobManager.CancelJob(runId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to cancel job: " + err.Error(),
+		})
+		return
+	}
+
+	glog.V(1).Infof("Cancelled job %s", runId)
+	c.JSON(http.StatusAccepted, gin.H{
+		"error": false,
+		"data":  "",
+		"runId": runId,
+	})
+}
+
+func (server *Server) getClusters(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  server.JobManager.Clusters.GetClusterSummaries(),
+	})
+}
+
+func (server *Server) deleteCluster(c *gin.Context) {
+	deploymentId := c.Param("deploymentId")
+	if err := server.JobManager.ForceDeleteCluster(deploymentId); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  err.Error(),
 		})
+		return
 	}
 
+	c.JSON(http.StatusAccepted, gin.H{
+		"error": false,
+		"data":  "",
+	})
+}
+
+func (server *Server) gcClusters(c *gin.Context) {
+	removedRunIds, err := server.JobManager.Clusters.GarbageCollect()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": true,
+			"data":  "Unable to garbage collect clusters: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  removedRunIds,
+	})
+}
+
+// parsePriority parses the optional priority query parameter of a job submission.
+// Jobs with higher priority are run first.
+func parsePriority(c *gin.Context) (int, bool) {
+	priority, err := strconv.Atoi(c.DefaultQuery("priority", strconv.Itoa(jobs.DefaultPriority)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to parse priority: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	return priority, true
+}
+
+// parseCallbackUrl reads the optional url notified when the submitted jobs
+// finish or fail.
+func parseCallbackUrl(c *gin.Context) (string, bool) {
+	callbackUrl := c.Query("callbackUrl")
+	if callbackUrl == "" {
+		return "", true
+	}
+
+	u, err := url.Parse(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Invalid callback url: " + callbackUrl,
+		})
+		return "", false
+	}
+
+	return callbackUrl, true
+}
+
+// parseListQuery reads the comma separated values of the query parameter.
+func parseListQuery(c *gin.Context, key string) []string {
+	values := []string{}
+	for _, value := range strings.Split(c.DefaultQuery(key, ""), ",") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (server *Server) setRunPriority(c *gin.Context) {
+	runId := c.Param("runId")
+
+	var request struct {
+		Priority int `json:"priority"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to parse priority request: " + err.Error(),
+		})
+		return
+	}
+
+	if _, err := server.JobManager.FindJob(runId); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Job %s not found", runId),
+		})
+		return
+	}
+
+	if err := server.JobManager.SetJobPriority(runId, request.Priority); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to change job priority: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  "",
+		"runId": runId,
+	})
+}
+
+func (server *Server) getQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  server.JobManager.Scheduler.GetQueuedJobs(),
+	})
+}
+
+func (server *Server) runPipeline(c *gin.Context) {
+	appName := c.Param("appName")
+	priority, ok := parsePriority(c)
+	if !ok {
+		return
+	}
+
+	callbackUrl, ok := parseCallbackUrl(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Stages []models.PipelineStage `json:"stages" binding:"required"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to parse pipeline request: " + err.Error(),
+		})
+		return
+	}
+
+	applicationConfig, err := server.ConfigDB.GetApplicationConfig(appName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to get application config: " + err.Error(),
+		})
+		return
+	}
+
+	skipFlag := c.DefaultQuery("skipUnreserveOnFailure", "false") == "true"
+	run, err := runners.NewPipelineRun(
+		server.JobManager,
+		applicationConfig,
+		server.Config,
+		request.Stages,
+		skipFlag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to create pipeline run: " + err.Error(),
+		})
+		return
+	}
+
+	log := run.ProfileLog
+	log.Logger.Infof("Queueing pipeline %s for app %s...", run.Id, appName)
+	run.SetPriority(priority)
+	run.SetCallbackUrl(callbackUrl)
+	run.SetUserId(c.Query("userId"))
+	server.JobManager.AddJob(run)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"error":      false,
+		"data":       "",
+		"pipelineId": run.Id,
+	})
+}
+
+func (server *Server) findPipeline(c *gin.Context, appName string, pipelineId string) (*runners.PipelineRun, bool) {
+	job, err := server.JobManager.FindJob(pipelineId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Pipeline %s not found", pipelineId),
+		})
+		return nil, false
+	}
+
+	pipeline, ok := job.(*runners.PipelineRun)
+	if !ok || pipeline.ApplicationConfig.Name != appName {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Pipeline %s not found for app %s", pipelineId, appName),
+		})
+		return nil, false
+	}
+
+	return pipeline, true
+}
+
+func (server *Server) getPipeline(c *gin.Context) {
+	pipeline, ok := server.findPipeline(c, c.Param("appName"), c.Param("pipelineId"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  pipeline.GetPipelineSummary(),
+	})
+}
+
+func (server *Server) resumePipeline(c *gin.Context) {
+	appName := c.Param("appName")
+
+	var request struct {
+		PipelineId string `json:"pipelineId" binding:"required"`
+		FromStage  *int   `json:"fromStage"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to parse resume pipeline request: " + err.Error(),
+		})
+		return
+	}
+
+	previous, ok := server.findPipeline(c, appName, request.PipelineId)
+	if !ok {
+		return
+	}
+
+	fromStage := -1
+	if request.FromStage != nil {
+		fromStage = *request.FromStage
+	}
+
+	run, err := runners.NewResumedPipelineRun(previous, fromStage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Unable to resume pipeline: " + err.Error(),
+		})
+		return
+	}
+
+	log := run.ProfileLog
+	log.Logger.Infof("Queueing pipeline %s resumed from %s for app %s...", run.Id, previous.Id, appName)
+	run.SetPriority(previous.GetPriority())
+	server.JobManager.AddJob(run)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"error":      false,
+		"data":       "",
+		"pipelineId": run.Id,
+	})
+}
+
+const defaultResultsLimit = 20
+
+// parseMetricsQuery parses the runId, since, until, offset and limit query
+// parameters of a results request. Times are in RFC3339 format.
+func parseMetricsQuery(c *gin.Context) (db.MetricsQuery, bool) {
+	query := db.MetricsQuery{
+		AppName: c.Param("appName"),
+		RunId:   c.Query("runId"),
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": true,
+				"data":  "Unable to parse since: " + err.Error(),
+			})
+			return query, false
+		}
+	}
+
+	if until := c.Query("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": true,
+				"data":  "Unable to parse until: " + err.Error(),
+			})
+			return query, false
+		}
+	}
+
+	if query.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || query.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Invalid offset: " + c.Query("offset"),
+		})
+		return query, false
+	}
+
+	if query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultResultsLimit))); err != nil || query.Limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  "Invalid limit: " + c.Query("limit"),
+		})
+		return query, false
+	}
+
+	return query, true
+}
+
+func (server *Server) getResults(c *gin.Context, dataType string, results interface{}) {
+	query, ok := parseMetricsQuery(c)
+	if !ok {
+		return
+	}
+
+	if err := server.MetricsDB.GetMetrics(dataType, query, results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": true,
+			"data":  "Unable to get " + dataType + " results: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error":  false,
+		"data":   results,
+		"offset": query.Offset,
+		"limit":  query.Limit,
+	})
+}
+
+func (server *Server) getCalibrationResults(c *gin.Context) {
+	results := []models.CalibrationResults{}
+	server.getResults(c, "calibration", &results)
+}
+
+func (server *Server) getProfilingResults(c *gin.Context) {
+	results := []models.BenchmarkRunResults{}
+	server.getResults(c, "profiling", &results)
+}
+
+func (server *Server) getSizingResults(c *gin.Context) {
+	results := []runners.AllInstanceRunResults{}
+	server.getResults(c, "allInstance", &results)
+}
+
+func (server *Server) getCaptureMetricsResults(c *gin.Context) {
+	results := []models.MetricsSnapshot{}
+	server.getResults(c, "captureMetrics", &results)
+}
+
+func (server *Server) getResourceUsageResults(c *gin.Context) {
+	results := []models.ResourceUsageResults{}
+	server.getResults(c, "resourceUsage", &results)
+}
+
+// getSizingRecommendation returns the recommendation of the app's latest all
+// instances sizing run, or of the run with the runId query, with the pricing
+// query option.
+func (server *Server) getSizingRecommendation(c *gin.Context) {
+	appName := c.Param("appName")
+	pricing := c.DefaultQuery("pricing", models.OnDemandPricing)
+	if pricing != models.OnDemandPricing && pricing != models.ReservedPricing {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("Unknown pricing %s, expected %s or %s", pricing, models.OnDemandPricing, models.ReservedPricing),
+		})
+		return
+	}
+
+	recommendation := &models.SizingRecommendation{}
+	var err error
+	if runId := c.Query("runId"); runId != "" {
+		_, err = server.MetricsDB.GetMetricByRunId("sizingRecommendation", runId, recommendation)
+		if err == nil && recommendation.AppName != appName {
+			err = fmt.Errorf("Run %s is not a sizing run of app %s", runId, appName)
+		}
+	} else if region := c.Query("region"); region != "" {
+		recommendations := []models.SizingRecommendation{}
+		err = server.MetricsDB.GetMetrics("sizingRecommendation", db.MetricsQuery{AppName: appName}, &recommendations)
+		if err == nil {
+			err = fmt.Errorf("Unable to find sizing recommendation of app %s in %s", appName, region)
+			for i := range recommendations {
+				if recommendations[i].Region == region {
+					recommendation, err = &recommendations[i], nil
+					break
+				}
+			}
+		}
+	} else {
+		_, err = server.MetricsDB.GetMetric("sizingRecommendation", appName, recommendation)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  "Unable to get sizing recommendation: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data": gin.H{
+			"runId":          recommendation.RunId,
+			"appName":        recommendation.AppName,
+			"region":         recommendation.Region,
+			"slo":            recommendation.SLO,
+			"created":        recommendation.Created,
+			"recommendation": recommendation.GetPricedRecommendation(pricing),
+		},
+	})
+}
+
+// getRunResults returns the results stored by a run, keyed by their data type.
+func (server *Server) getRunResults(c *gin.Context) {
+	runId := c.Param("runId")
+	query := db.MetricsQuery{RunId: runId}
+
+	calibrationResults := []models.CalibrationResults{}
+	profilingResults := []models.BenchmarkRunResults{}
+	sizingResults := []runners.AllInstanceRunResults{}
+	captureMetricsResults := []models.MetricsSnapshot{}
+	resourceUsageResults := []models.ResourceUsageResults{}
+	sizingRecommendations := []models.SizingRecommendation{}
+	results := map[string]interface{}{
+		"calibration":          &calibrationResults,
+		"profiling":            &profilingResults,
+		"allInstance":          &sizingResults,
+		"captureMetrics":       &captureMetricsResults,
+		"resourceUsage":        &resourceUsageResults,
+		"sizingRecommendation": &sizingRecommendations,
+	}
+
+	for dataType, dataTypeResults := range results {
+		if err := server.MetricsDB.GetMetrics(dataType, query, dataTypeResults); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": true,
+				"data":  "Unable to get " + dataType + " results: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	data := gin.H{}
+	if len(calibrationResults) > 0 {
+		data["calibration"] = calibrationResults
+	}
+	if len(profilingResults) > 0 {
+		data["profiling"] = profilingResults
+	}
+	if len(sizingResults) > 0 {
+		data["sizing"] = sizingResults
+	}
+	if len(captureMetricsResults) > 0 {
+		data["captureMetrics"] = captureMetricsResults
+	}
+	if len(resourceUsageResults) > 0 {
+		data["resourceUsage"] = resourceUsageResults
+	}
+	if len(sizingRecommendations) > 0 {
+		data["sizingRecommendation"] = sizingRecommendations
+	}
+
+	if len(data) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  fmt.Sprintf("No results found for run %s", runId),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error": false,
+		"data":  data,
+	})
 }
@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,6 @@ import (
 	"time"
 
 	"github.com/go-resty/resty"
-	"github.com/hyperpilotio/go-utils/funcs"
 	logging "github.com/op/go-logging"
 	"github.com/spf13/viper"
 )
@@ -48,6 +48,7 @@ type GetNextInstanceTypesResponse struct {
 // vm instance types or not. If the return array is empty, then the analyzer has found the
 // optimal choice.
 func (client *AnalyzerClient) GetNextInstanceTypes(
+	ctx context.Context,
 	runId string,
 	appName string,
 	results map[string]float64,
@@ -68,7 +69,7 @@ func (client *AnalyzerClient) GetNextInstanceTypes(
 	restClient := resty.New()
 	restClient.SetCloseConnection(true)
 	var submitResponse GetNextInstanceTypesResponse
-	err := funcs.LoopUntil(time.Minute*5, time.Second*5, func() (bool, error) {
+	err := loopUntil(ctx, time.Minute*5, time.Second*5, func() (bool, error) {
 		logger.Infof("Sending get next instance types request to analyzer %s: %s", requestUrl, request)
 		response, err := restClient.R().SetBody(request).Post(requestUrl)
 		if err != nil {
@@ -100,7 +101,7 @@ func (client *AnalyzerClient) GetNextInstanceTypes(
 	}
 
 	var nextInstanceResponse GetNextInstanceTypesResponse
-	err = funcs.LoopUntil(time.Minute*10, time.Second*10, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*10, time.Second*10, func() (bool, error) {
 		requestUrl := UrlBasePath(client.Url) + path.Join(
 			client.Url.Path, "api", "apps", runId, "get-optimizer-status")
 
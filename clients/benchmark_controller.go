@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,6 @@ import (
 	"time"
 
 	"github.com/go-resty/resty"
-	"github.com/hyperpilotio/go-utils/funcs"
 	"github.com/hyperpilotio/workload-profiler/models"
 	logging "github.com/op/go-logging"
 )
@@ -42,6 +42,7 @@ type BenchmarkControllerBenchmarkResponse struct {
 }
 
 func (client *BenchmarkControllerClient) RunCalibration(
+	ctx context.Context,
 	loadTesterName string,
 	baseUrl string,
 	stageId string,
@@ -68,7 +69,7 @@ func (client *BenchmarkControllerClient) RunCalibration(
 	body["stageId"] = stageId
 	body["parserUrl"] = controller.ParserUrl
 
-	err = funcs.LoopUntil(time.Minute*5, time.Second*5, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*5, time.Second*5, func() (bool, error) {
 		logger.Infof("Sending calibration request to benchmark controller for stage: " + stageId)
 		response, err := resty.R().SetBody(body).Post(u.String())
 		if err != nil {
@@ -90,7 +91,7 @@ func (client *BenchmarkControllerClient) RunCalibration(
 	results := &BenchmarkControllerCalibrationResponse{}
 
 	//TODO: The time duration for looping should be parameterized later
-	err = funcs.LoopUntil(time.Minute*240, time.Second*60, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*240, time.Second*60, func() (bool, error) {
 		response, err := resty.R().Get(u.String() + "/" + stageId)
 		if err != nil {
 			logger.Warningf("Unable to send calibrate results request to controller, retrying: " + err.Error())
@@ -129,6 +130,7 @@ func (client *BenchmarkControllerClient) RunCalibration(
 }
 
 func (client *BenchmarkControllerClient) RunBenchmark(
+	ctx context.Context,
 	loadTesterName string,
 	baseUrl string,
 	stageId string,
@@ -168,7 +170,7 @@ func (client *BenchmarkControllerClient) RunBenchmark(
 	body["stageId"] = stageId
 	body["parserUrl"] = controller.ParserUrl
 
-	err = funcs.LoopUntil(time.Minute*5, time.Second*5, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*5, time.Second*5, func() (bool, error) {
 		logger.Infof("Sending benchmark request to benchmark controller for stage: " + stageId)
 		response, err := resty.R().SetBody(body).Post(u.String())
 		if err != nil {
@@ -189,7 +191,7 @@ func (client *BenchmarkControllerClient) RunBenchmark(
 
 	results := &BenchmarkControllerBenchmarkResponse{}
 
-	err = funcs.LoopUntil(time.Minute*360, time.Second*30, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*360, time.Second*30, func() (bool, error) {
 		response, err := resty.R().Get(u.String() + "/" + stageId)
 		if err != nil {
 			return false, errors.New("Unable to send benchmark results request to controller: " + err.Error())
@@ -1,68 +1,326 @@
 package clients
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
+	"io"
+	"sort"
 	"strings"
+	"time"
 
-	logging "github.com/op/go-logging"
+	"github.com/go-resty/resty"
 )
 
+const influxChunkSize = 10000
+
+// InfluxClient reads the series stored in an InfluxDB through its HTTP API.
 type InfluxClient struct {
-	ScriptPath string
-	Url        string
-	Port       int
-	BackupPort int
+	Url      string
+	User     string
+	Password string
+}
+
+type influxSeries struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
 }
 
-func NewInfluxClient(scriptPath string, url string, port int, backupPort int) (*InfluxClient, error) {
-	if scriptPath == "" {
-		scriptPath = "/usr/local/bin/hyperpilot_influx.sh"
+type influxResult struct {
+	Series []influxSeries `json:"series"`
+	Error  string         `json:"error"`
+}
+
+type influxResponse struct {
+	Results []influxResult `json:"results"`
+	Error   string         `json:"error"`
+}
+
+func NewInfluxClient(url string, user string, password string) *InfluxClient {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
 	}
 
-	// Remove scheme and port from url
-	parts := strings.Split(strings.TrimPrefix(url, "http://"), ":")
-	if len(parts) > 2 || len(parts) == 0 {
-		return nil, errors.New("Unexpected url format: " + url)
+	return &InfluxClient{
+		Url:      strings.TrimSuffix(url, "/"),
+		User:     user,
+		Password: password,
 	}
+}
 
-	url = parts[0]
+// query runs the query on the database, and returns the series of every
+// chunk of the response.
+func (client *InfluxClient) query(database string, query string) ([]influxSeries, error) {
+	request := resty.R().SetQueryParams(map[string]string{
+		"q":          query,
+		"epoch":      "ns",
+		"chunked":    "true",
+		"chunk_size": fmt.Sprintf("%d", influxChunkSize),
+	})
+	if database != "" {
+		request.SetQueryParam("db", database)
+	}
+	if client.User != "" {
+		request.SetBasicAuth(client.User, client.Password)
+	}
 
-	return &InfluxClient{
-		ScriptPath: scriptPath,
-		Url:        url,
-		Port:       port,
-		BackupPort: backupPort,
-	}, nil
+	response, err := request.Get(client.Url + "/query")
+	if err != nil {
+		return nil, errors.New("Unable to send query to influx: " + err.Error())
+	}
+
+	if response.StatusCode() != 200 {
+		return nil, fmt.Errorf("Unexpected response code: %d, body: %s", response.StatusCode(), response.String())
+	}
+
+	// Chunked responses are a stream of json objects, one per chunk.
+	series := []influxSeries{}
+	decoder := json.NewDecoder(bytes.NewReader(response.Body()))
+	decoder.UseNumber()
+	for {
+		chunk := influxResponse{}
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New("Unable to parse influx response: " + err.Error())
+		}
+
+		if chunk.Error != "" {
+			return nil, errors.New("Influx query failed: " + chunk.Error)
+		}
+
+		for _, result := range chunk.Results {
+			if result.Error != "" {
+				return nil, errors.New("Influx query failed: " + result.Error)
+			}
+			series = append(series, result.Series...)
+		}
+	}
+
+	return series, nil
 }
 
-func (client *InfluxClient) BackupDB(key string, logger *logging.Logger) error {
-	// Subprocess to run hyperpilot_influx.sh to backup and
-	// and send backup to s3.
-	var stderrBuf bytes.Buffer
-	var stdoutBuf bytes.Buffer
-	cmd := exec.Command(
-		client.ScriptPath,
-		"-o",
-		"backup",
-		"-h",
-		fmt.Sprintf("%s", client.Url),
-		"-b",
-		fmt.Sprintf("%s:%d", client.Url, client.BackupPort),
-		"-n",
-		key,
-		"-p",
-		"8086",
-	)
-	cmd.Stderr = &stderrBuf
-	cmd.Stdout = &stdoutBuf
-	err := cmd.Run()
-	logger.Infof("Influx script stdout: %s", stdoutBuf.String())
+// queryColumn returns the values of the first column of the query results.
+func (client *InfluxClient) queryColumn(database string, query string) ([]string, error) {
+	series, err := client.query(database, query)
 	if err != nil {
-		return fmt.Errorf("Unable to run backup command, err: %s, stderr: %s", err.Error(), stderrBuf.String())
+		return nil, err
+	}
+
+	values := []string{}
+	for _, s := range series {
+		for _, row := range s.Values {
+			if len(row) > 0 {
+				values = append(values, fmt.Sprintf("%v", row[0]))
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// QuerySeriesSum runs the query, and returns the sum of the first value column
+// of all series at each timestamp ordered by time, e.g: to add up the usage of
+// the pods of a service returned as separate series.
+func (client *InfluxClient) QuerySeriesSum(database string, query string) ([]float64, error) {
+	series, err := client.query(database, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[int64]float64{}
+	for _, s := range series {
+		for _, row := range s.Values {
+			if len(row) < 2 || row[1] == nil {
+				continue
+			}
+
+			timestampNumber, timestampOk := row[0].(json.Number)
+			valueNumber, valueOk := row[1].(json.Number)
+			if !timestampOk || !valueOk {
+				return nil, fmt.Errorf("Unexpected influx row: %v", row)
+			}
+
+			timestamp, err := timestampNumber.Int64()
+			if err != nil {
+				return nil, errors.New("Unable to parse influx timestamp: " + err.Error())
+			}
+
+			value, err := valueNumber.Float64()
+			if err != nil {
+				return nil, errors.New("Unable to parse influx value: " + err.Error())
+			}
+			sums[timestamp] += value
+		}
+	}
+
+	timestamps := int64Slice{}
+	for timestamp := range sums {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Sort(timestamps)
+
+	values := []float64{}
+	for _, timestamp := range timestamps {
+		values = append(values, sums[timestamp])
+	}
+
+	return values, nil
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+
+// GetDatabases returns all the databases except the internal one.
+func (client *InfluxClient) GetDatabases() ([]string, error) {
+	databases, err := client.queryColumn("", "SHOW DATABASES")
+	if err != nil {
+		return nil, errors.New("Unable to get influx databases: " + err.Error())
+	}
+
+	results := []string{}
+	for _, database := range databases {
+		if database != "_internal" {
+			results = append(results, database)
+		}
+	}
+
+	return results, nil
+}
+
+// getFieldTypes returns the type of every field of the measurement, keyed by
+// field name.
+func (client *InfluxClient) getFieldTypes(database string, measurement string) (map[string]string, error) {
+	series, err := client.query(database, "SHOW FIELD KEYS FROM "+quoteInfluxIdentifier(measurement))
+	if err != nil {
+		return nil, err
+	}
+
+	fieldTypes := map[string]string{}
+	for _, s := range series {
+		for _, row := range s.Values {
+			if len(row) > 1 {
+				fieldTypes[fmt.Sprintf("%v", row[0])] = fmt.Sprintf("%v", row[1])
+			}
+		}
+	}
+
+	return fieldTypes, nil
+}
+
+// ExportLineProtocol writes the points of the database within the time range
+// to w in line protocol, in the same format as influx_inspect export so it
+// can be restored with influx -import. It returns the number of points written.
+func (client *InfluxClient) ExportLineProtocol(database string, start time.Time, end time.Time, w io.Writer) (int, error) {
+	measurements, err := client.queryColumn(database, "SHOW MEASUREMENTS")
+	if err != nil {
+		return 0, fmt.Errorf("Unable to get measurements of %s: %s", database, err.Error())
+	}
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "# DML\n# CONTEXT-DATABASE: %s\n", database)
+
+	points := 0
+	for _, measurement := range measurements {
+		fieldTypes, err := client.getFieldTypes(database, measurement)
+		if err != nil {
+			return points, fmt.Errorf("Unable to get fields of %s: %s", measurement, err.Error())
+		}
+
+		query := fmt.Sprintf("SELECT * FROM %s WHERE time >= %d AND time <= %d GROUP BY *",
+			quoteInfluxIdentifier(measurement), start.UnixNano(), end.UnixNano())
+		series, err := client.query(database, query)
+		if err != nil {
+			return points, fmt.Errorf("Unable to query points of %s: %s", measurement, err.Error())
+		}
+
+		for _, s := range series {
+			for _, row := range s.Values {
+				if line, ok := formatInfluxLine(s, row, fieldTypes); ok {
+					writer.WriteString(line)
+					writer.WriteByte('\n')
+					points++
+				}
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return points, errors.New("Unable to write line protocol: " + err.Error())
+	}
+
+	return points, nil
+}
+
+func quoteInfluxIdentifier(name string) string {
+	return `"` + strings.Replace(strings.Replace(name, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// formatInfluxLine formats a row of the series in line protocol. Rows without
+// any field values are skipped.
+func formatInfluxLine(series influxSeries, row []interface{}, fieldTypes map[string]string) (string, bool) {
+	var timestamp string
+	fields := []string{}
+	for i, column := range series.Columns {
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+
+		if column == "time" {
+			timestamp = fmt.Sprintf("%v", row[i])
+			continue
+		}
+
+		var value string
+		switch v := row[i].(type) {
+		case string:
+			value = `"` + stringEscaper.Replace(v) + `"`
+		case bool:
+			value = fmt.Sprintf("%t", v)
+		case json.Number:
+			value = v.String()
+			if fieldTypes[column] == "integer" {
+				value += "i"
+			}
+		default:
+			value = fmt.Sprintf("%v", v)
+		}
+		fields = append(fields, keyEscaper.Replace(column)+"="+value)
+	}
+
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	line := measurementEscaper.Replace(series.Name)
+	// Tags are sorted by key, as recommended for line protocol.
+	tagKeys := []string{}
+	for key := range series.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		if value := series.Tags[key]; value != "" {
+			line += "," + keyEscaper.Replace(key) + "=" + keyEscaper.Replace(value)
+		}
+	}
+	line += " " + strings.Join(fields, ",")
+	if timestamp != "" {
+		line += " " + timestamp
 	}
 
-	return nil
+	return line, true
 }
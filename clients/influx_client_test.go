@@ -1,22 +1,58 @@
 package clients
 
 import (
-	"fmt"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestBackupDB(t *testing.T) {
-	fmt.Println("start testing backup")
-	client := &InfluxClient{
-		influxUrl:        "localhost",
-		influxPort:       "8086",
-		influxBackupUrl:  "localhost",
-		influxBackupPort: "8088",
+func TestExportLineProtocol(t *testing.T) {
+	responses := map[string]string{
+		"SHOW MEASUREMENTS": `{"results":[{"series":[{"name":"measurements","columns":["name"],"values":[["cpu usage"]]}]}]}`,
+		`SHOW FIELD KEYS FROM "cpu usage"`: `{"results":[{"series":[{"name":"cpu usage","columns":["fieldKey","fieldType"],` +
+			`"values":[["value","float"],["count","integer"],["state","string"]]}]}]}`,
 	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("db") != "snap" {
+			t.Errorf("Unexpected database: %s", r.URL.Query().Get("db"))
+		}
 
-	if err := client.BackupDB("Test"); err != nil {
-		fmt.Println(err)
-		t.Error(err)
+		query := r.URL.Query().Get("q")
+		if response, ok := responses[query]; ok {
+			w.Write([]byte(response))
+			return
+		}
+
+		if !strings.HasPrefix(query, `SELECT * FROM "cpu usage" WHERE time >= 1000000000 AND time <= 2000000000`) {
+			t.Errorf("Unexpected query: %s", query)
+		}
+
+		// Points are returned in two chunks.
+		w.Write([]byte(`{"results":[{"series":[{"name":"cpu usage","tags":{"host":"node 1","pod":""},` +
+			`"columns":["time","count","state","value"],"values":[[1500000000,3,"a \"b\"",0.5]]}],"partial":true}]}` + "\n"))
+		w.Write([]byte(`{"results":[{"series":[{"name":"cpu usage","tags":{"host":"node 1","pod":""},` +
+			`"columns":["time","count","state","value"],"values":[[1600000000,null,null,1]]}]}]}` + "\n"))
+	}))
+	defer server.Close()
+
+	client := &InfluxClient{Url: server.URL}
+	var b bytes.Buffer
+	points, err := client.ExportLineProtocol("snap", time.Unix(1, 0), time.Unix(2, 0), &b)
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	if points != 2 {
+		t.Errorf("Expected 2 points, got %d", points)
+	}
+
+	expected := "# DML\n# CONTEXT-DATABASE: snap\n" +
+		`cpu\ usage,host=node\ 1 count=3i,state="a \"b\"",value=0.5 1500000000` + "\n" +
+		`cpu\ usage,host=node\ 1 value=1 1600000000` + "\n"
+	if b.String() != expected {
+		t.Errorf("Unexpected line protocol:\n%s\nexpected:\n%s", b.String(), expected)
+	}
 }
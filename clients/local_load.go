@@ -0,0 +1,361 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/op/go-logging"
+)
+
+// Latencies are recorded in microseconds, and latencies above the max are
+// recorded as the max.
+const (
+	minLocalLoadLatencyUs   = 1
+	maxLocalLoadLatencyUs   = int64(time.Minute / time.Microsecond)
+	localLoadSigFigs        = 3
+	maxLocalCalibrationRuns = 100
+	// maxLocalLoadInFlight caps the requests waiting on a response, beyond
+	// which scheduled requests are dropped.
+	maxLocalLoadInFlight = 10000
+)
+
+// LocalLoadClient generates HTTP load from the profiler itself, so apps can be
+// load tested without deploying a load tester. It follows the slow cooker
+// semantics: the load is qps requests per second for each of the concurrency.
+// The load is open-loop, every request is sent from its own goroutine at its
+// scheduled time and its latency is measured from that time, so a slow server
+// doesn't lower the offered load. Requests scheduled while maxLocalLoadInFlight
+// requests are in flight are dropped, and counted as failures.
+type LocalLoadClient struct{}
+
+type localLoadStats struct {
+	mutex     sync.Mutex
+	histogram *hdrhistogram.Histogram
+	requests  uint64
+	failures  uint64
+	dropped   uint64
+}
+
+func newLocalLoadStats() *localLoadStats {
+	return &localLoadStats{
+		histogram: hdrhistogram.New(minLocalLoadLatencyUs, maxLocalLoadLatencyUs, localLoadSigFigs),
+	}
+}
+
+func (stats *localLoadStats) record(latency time.Duration, failed bool) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.requests++
+	if failed {
+		stats.failures++
+		return
+	}
+
+	latencyUs := int64(latency / time.Microsecond)
+	if latencyUs < minLocalLoadLatencyUs {
+		latencyUs = minLocalLoadLatencyUs
+	} else if latencyUs > maxLocalLoadLatencyUs {
+		latencyUs = maxLocalLoadLatencyUs
+	}
+	stats.histogram.RecordValue(latencyUs)
+}
+
+// drop records a request that wasn't sent as the in flight requests are capped.
+func (stats *localLoadStats) drop() {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.requests++
+	stats.failures++
+	stats.dropped++
+}
+
+// percentileMs returns the latency at the percentile (0-100) in ms.
+func (stats *localLoadStats) percentileMs(percentile float64) int64 {
+	return stats.histogram.ValueAtQuantile(percentile) / 1000
+}
+
+func (stats *localLoadStats) result() *SlowCookerBenchmarkResult {
+	return &SlowCookerBenchmarkResult{
+		Failures:      stats.failures,
+		PercentileMin: stats.histogram.Min() / 1000,
+		Percentile50:  stats.percentileMs(50),
+		Percentile95:  stats.percentileMs(95),
+		Percentile99:  stats.percentileMs(99),
+		PercentileMax: stats.histogram.Max() / 1000,
+	}
+}
+
+func newLocalLoadHttpClient(appLoad *models.SlowCookerAppLoad) *http.Client {
+	return &http.Client{
+		Timeout: time.Duration(maxLocalLoadLatencyUs) * time.Microsecond,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DisableKeepAlives:   appLoad.Noreuse,
+			MaxIdleConnsPerHost: appLoad.Concurrency,
+		},
+	}
+}
+
+func (client *LocalLoadClient) sendRequest(
+	ctx context.Context,
+	httpClient *http.Client,
+	appLoad *models.SlowCookerAppLoad) bool {
+	method := appLoad.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	var body io.Reader
+	if appLoad.Data != "" {
+		body = strings.NewReader(appLoad.Data)
+	}
+
+	request, err := http.NewRequest(method, appLoad.Url, body)
+	if err != nil {
+		return false
+	}
+
+	response, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	return response.StatusCode < 400
+}
+
+// runStep sends qps * concurrency requests per second for the duration, each
+// at its scheduled time regardless of the responses, and records them into stats.
+func (client *LocalLoadClient) runStep(
+	ctx context.Context,
+	httpClient *http.Client,
+	appLoad *models.SlowCookerAppLoad,
+	qps int,
+	concurrency int,
+	duration time.Duration,
+	stats *localLoadStats) error {
+	if qps <= 0 || concurrency <= 0 {
+		return fmt.Errorf("Invalid local load qps %d and concurrency %d", qps, concurrency)
+	}
+
+	interval := time.Second / time.Duration(qps*concurrency)
+	if interval <= 0 {
+		return fmt.Errorf("Local load qps %d with concurrency %d is too high", qps, concurrency)
+	}
+
+	inFlight := make(chan struct{}, maxLocalLoadInFlight)
+	var wg sync.WaitGroup
+	startTime := time.Now()
+	endTime := startTime.Add(duration)
+	for i := 0; ; i++ {
+		sendTime := startTime.Add(time.Duration(i) * interval)
+		if !sendTime.Before(endTime) {
+			break
+		}
+
+		if wait := sendTime.Sub(time.Now()); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			stats.drop()
+			continue
+		}
+
+		wg.Add(1)
+		go func(sendTime time.Time) {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+
+			ok := client.sendRequest(ctx, httpClient, appLoad)
+			if ctx.Err() != nil {
+				return
+			}
+			stats.record(time.Since(sendTime), !ok)
+		}(sendTime)
+	}
+
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// RunLoad sends the app load for the duration, or through every step of the
+// app load plan if it has one, and returns the latency percentiles in ms.
+func (client *LocalLoadClient) RunLoad(
+	ctx context.Context,
+	appLoad *models.SlowCookerAppLoad,
+	duration time.Duration,
+	logger *logging.Logger) (*SlowCookerBenchmarkResult, error) {
+	if appLoad == nil || appLoad.Url == "" {
+		return nil, errors.New("No url found in local load app load")
+	}
+
+	httpClient := newLocalLoadHttpClient(appLoad)
+	stats := newLocalLoadStats()
+	if len(appLoad.Plan.RunningSteps) > 0 {
+		for i, step := range appLoad.Plan.RunningSteps {
+			stepDuration, err := time.ParseDuration(step.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse duration of plan step %d: %s", i, err.Error())
+			}
+
+			logger.Infof("Running local load plan step %d at %d qps with concurrency %d for %s against %s",
+				i, step.Qps, step.Concurrency, stepDuration, appLoad.Url)
+			if err := client.runStep(ctx, httpClient, appLoad, step.Qps, step.Concurrency, stepDuration, stats); err != nil {
+				return nil, fmt.Errorf("Unable to run local load plan step %d: %s", i, err.Error())
+			}
+		}
+	} else {
+		logger.Infof("Running local load at %d qps with concurrency %d for %s against %s",
+			appLoad.Qps, appLoad.Concurrency, duration, appLoad.Url)
+		if err := client.runStep(ctx, httpClient, appLoad, appLoad.Qps, appLoad.Concurrency, duration, stats); err != nil {
+			return nil, errors.New("Unable to run local load: " + err.Error())
+		}
+	}
+
+	if stats.requests == 0 {
+		return nil, errors.New("No requests were sent by local load")
+	}
+
+	if stats.failures == stats.requests {
+		return nil, fmt.Errorf("All %d requests sent by local load failed", stats.requests)
+	}
+
+	result := stats.result()
+	logger.Infof("Local load results after %d requests with %d dropped: %+v", stats.requests, stats.dropped, *result)
+	return result, nil
+}
+
+// RunBenchmark runs the app load with the app intensity as its concurrency for
+// runsPerIntensity runs of the controller's load time.
+func (client *LocalLoadClient) RunBenchmark(
+	ctx context.Context,
+	runId string,
+	appIntensity float64,
+	runsPerIntensity int,
+	controller *models.LocalLoadController,
+	logger *logging.Logger) (*SlowCookerBenchmarkResponse, error) {
+	loadTime, err := time.ParseDuration(controller.LoadTime)
+	if err != nil {
+		return nil, errors.New("Unable to parse local load time: " + err.Error())
+	}
+
+	if runsPerIntensity <= 0 {
+		runsPerIntensity = 1
+	}
+
+	appLoad := *controller.AppLoad
+	appLoad.Concurrency = int(appIntensity)
+
+	response := &SlowCookerBenchmarkResponse{
+		Id:      runId,
+		Results: []SlowCookerBenchmarkResult{},
+	}
+	for i := 0; i < runsPerIntensity; i++ {
+		result, err := client.RunLoad(ctx, &appLoad, loadTime, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to run local load benchmark %d of %d: %s", i+1, runsPerIntensity, err.Error())
+		}
+		response.Results = append(response.Results, *result)
+	}
+	response.State = "finished"
+
+	return response, nil
+}
+
+// RunCalibration increases the app load concurrency from the initial
+// concurrency by the calibrate step until the latency misses the SLO, and
+// returns the highest concurrency that meets it as the final result.
+func (client *LocalLoadClient) RunCalibration(
+	ctx context.Context,
+	runId string,
+	slo models.SLO,
+	controller *models.LocalLoadController,
+	logger *logging.Logger) (*SlowCookerCalibrateResponse, error) {
+	if controller.Calibrate == nil || controller.Calibrate.Step <= 0 {
+		return nil, errors.New("Local load calibrate step must be positive")
+	}
+
+	percentile, err := strconv.ParseFloat(slo.Metric, 64)
+	if err != nil {
+		return nil, errors.New("Unable to parse slo Metric to percentile value")
+	}
+
+	loadTime, err := time.ParseDuration(controller.LoadTime)
+	if err != nil {
+		return nil, errors.New("Unable to parse local load time: " + err.Error())
+	}
+
+	appLoad := *controller.AppLoad
+	if len(appLoad.Plan.RunningSteps) > 0 {
+		return nil, errors.New("Local load calibration doesn't support app load plans")
+	}
+
+	response := &SlowCookerCalibrateResponse{
+		Id:      runId,
+		Results: []*SlowCookerCalibrateResult{},
+	}
+	concurrency := controller.Calibrate.InitialConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	for i := 0; i < maxLocalCalibrationRuns; i++ {
+		appLoad.Concurrency = concurrency
+		stats := newLocalLoadStats()
+		logger.Infof("Calibrating local load with concurrency %d", concurrency)
+		err := client.runStep(ctx, newLocalLoadHttpClient(&appLoad), &appLoad, appLoad.Qps, concurrency, loadTime, stats)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to run local load with concurrency %d: %s", concurrency, err.Error())
+		}
+
+		result := &SlowCookerCalibrateResult{
+			Concurrency: concurrency,
+			LatencyMs:   stats.percentileMs(percentile),
+			Failures:    stats.failures,
+		}
+		response.Results = append(response.Results, result)
+		logger.Infof("Local load calibration result: %+v", *result)
+
+		if stats.requests == 0 || stats.failures == stats.requests || result.LatencyMs > int64(slo.Value) {
+			break
+		}
+
+		response.FinalResult = result
+		response.FinalConcurrency = concurrency
+		concurrency += controller.Calibrate.Step
+	}
+
+	if response.FinalResult == nil {
+		return nil, fmt.Errorf("SLO is not met with the initial concurrency %d", controller.Calibrate.InitialConcurrency)
+	}
+	response.State = "finished"
+
+	return response, nil
+}
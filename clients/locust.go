@@ -0,0 +1,304 @@
+package clients
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/op/go-logging"
+)
+
+// LocustClient drives a load test through the web API of a locust master.
+type LocustClient struct{}
+
+type LocustRequestStats struct {
+	Name               string  `json:"name"`
+	NumRequests        uint64  `json:"num_requests"`
+	NumFailures        uint64  `json:"num_failures"`
+	AvgResponseTime    float64 `json:"avg_response_time"`
+	MedianResponseTime float64 `json:"median_response_time"`
+	MaxResponseTime    float64 `json:"max_response_time"`
+	CurrentRps         float64 `json:"current_rps"`
+}
+
+type LocustStatsResponse struct {
+	Stats     []LocustRequestStats `json:"stats"`
+	TotalRps  float64              `json:"total_rps"`
+	FailRatio float64              `json:"fail_ratio"`
+	State     string               `json:"state"`
+	UserCount int                  `json:"user_count"`
+}
+
+// LocustStepResult is the aggregated stats of running the load test with a
+// number of users for a step duration.
+type LocustStepResult struct {
+	UserCount int
+	Requests  uint64
+	Failures  uint64
+	Rps       float64
+	// Percentiles are the response time percentiles in ms, keyed by percentile, e.g: "95".
+	Percentiles map[string]float64
+}
+
+// GetLocustQos extracts the QoS value for the SLO metric, which is either a
+// response time percentile (e.g: "95") or "rps".
+func GetLocustQos(result *LocustStepResult, metric string) (float64, error) {
+	if metric == "rps" {
+		return result.Rps, nil
+	}
+
+	if value, ok := result.Percentiles[metric]; ok {
+		return value, nil
+	}
+
+	return 0, errors.New("Unsupported locust metric: " + metric)
+}
+
+func locustUrl(baseUrl string, apiPath string) (string, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", errors.New("Unable to parse url: " + err.Error())
+	}
+
+	u.Path = path.Join(u.Path, apiPath)
+	return u.String(), nil
+}
+
+func (client *LocustClient) swarm(baseUrl string, userCount int, hatchRate int, logger *logging.Logger) error {
+	swarmUrl, err := locustUrl(baseUrl, "/swarm")
+	if err != nil {
+		return err
+	}
+
+	if hatchRate <= 0 {
+		hatchRate = userCount
+	}
+
+	logger.Infof("Swarming locust with %d users at hatch rate %d", userCount, hatchRate)
+	response, err := resty.R().
+		SetFormData(map[string]string{
+			"locust_count": strconv.Itoa(userCount),
+			"hatch_rate":   strconv.Itoa(hatchRate),
+		}).
+		Post(swarmUrl)
+	if err != nil {
+		return errors.New("Unable to send swarm request to locust: " + err.Error())
+	}
+
+	if response.StatusCode() >= 300 {
+		return fmt.Errorf("Unexpected response code: %d, body: %s", response.StatusCode(), response.String())
+	}
+
+	return nil
+}
+
+func (client *LocustClient) get(baseUrl string, apiPath string) (*resty.Response, error) {
+	getUrl, err := locustUrl(baseUrl, apiPath)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := resty.R().Get(getUrl)
+	if err != nil {
+		return nil, errors.New("Unable to send request to locust: " + err.Error())
+	}
+
+	if response.StatusCode() != 200 {
+		return nil, fmt.Errorf("Unexpected response code: %d, body: %s", response.StatusCode(), response.String())
+	}
+
+	return response, nil
+}
+
+// Stop stops all the locust users.
+func (client *LocustClient) Stop(baseUrl string) error {
+	if _, err := client.get(baseUrl, "/stop"); err != nil {
+		return errors.New("Unable to stop locust: " + err.Error())
+	}
+
+	return nil
+}
+
+func (client *LocustClient) getStats(baseUrl string) (*LocustStatsResponse, error) {
+	response, err := client.get(baseUrl, "/stats/requests")
+	if err != nil {
+		return nil, errors.New("Unable to get locust stats: " + err.Error())
+	}
+
+	stats := &LocustStatsResponse{}
+	if err := json.Unmarshal(response.Body(), stats); err != nil {
+		return nil, errors.New("Unable to parse locust stats: " + err.Error())
+	}
+
+	return stats, nil
+}
+
+// getPercentiles reads the response time percentiles of all requests from the
+// locust distribution csv, whose total row is the last row.
+func (client *LocustClient) getPercentiles(baseUrl string) (map[string]float64, error) {
+	response, err := client.get(baseUrl, "/stats/distribution/csv")
+	if err != nil {
+		return nil, errors.New("Unable to get locust distribution: " + err.Error())
+	}
+
+	records, err := csv.NewReader(strings.NewReader(response.String())).ReadAll()
+	if err != nil {
+		return nil, errors.New("Unable to parse locust distribution: " + err.Error())
+	}
+
+	if len(records) < 2 {
+		return nil, errors.New("No requests found in locust distribution")
+	}
+
+	header := records[0]
+	total := records[len(records)-1]
+	percentiles := map[string]float64{}
+	for i, column := range header {
+		if !strings.HasSuffix(column, "%") || i >= len(total) {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(total[i], 64)
+		if err != nil {
+			// Locust reports N/A for percentiles without requests
+			continue
+		}
+		percentiles[strings.TrimSuffix(column, "%")] = value
+	}
+
+	return percentiles, nil
+}
+
+// RunStep runs the load test with the number of users for the duration, and
+// returns the stats collected once all users are hatched.
+func (client *LocustClient) RunStep(
+	ctx context.Context,
+	baseUrl string,
+	userCount int,
+	hatchRate int,
+	duration time.Duration,
+	logger *logging.Logger) (*LocustStepResult, error) {
+	if err := client.swarm(baseUrl, userCount, hatchRate, logger); err != nil {
+		return nil, err
+	}
+
+	err := loopUntil(ctx, time.Minute*10, time.Second*5, func() (bool, error) {
+		stats, err := client.getStats(baseUrl)
+		if err != nil {
+			return false, err
+		}
+
+		return stats.State == "running" && stats.UserCount >= userCount, nil
+	})
+	if err != nil {
+		return nil, errors.New("Unable to wait for locust users to hatch: " + err.Error())
+	}
+
+	if _, err := client.get(baseUrl, "/stats/reset"); err != nil {
+		return nil, errors.New("Unable to reset locust stats: " + err.Error())
+	}
+
+	logger.Infof("Running locust with %d users for %s", userCount, duration)
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	stats, err := client.getStats(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	percentiles, err := client.getPercentiles(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LocustStepResult{
+		UserCount:   userCount,
+		Rps:         stats.TotalRps,
+		Percentiles: percentiles,
+	}
+	for _, requestStats := range stats.Stats {
+		if requestStats.Name == "Total" {
+			result.Requests = requestStats.NumRequests
+			result.Failures = requestStats.NumFailures
+		}
+	}
+
+	logger.Infof("Locust step results with %d users: %+v", userCount, *result)
+	return result, nil
+}
+
+// RunSteps steps the number of users from the controller's start count to its
+// end count, and returns the results of every step. Locust is stopped once all
+// steps are done.
+func (client *LocustClient) RunSteps(
+	ctx context.Context,
+	baseUrl string,
+	controller *models.LocustController,
+	logger *logging.Logger) ([]*LocustStepResult, error) {
+	if controller.StepCount <= 0 {
+		return nil, errors.New("Locust controller step count must be positive")
+	}
+
+	duration, err := time.ParseDuration(controller.StepDuration)
+	if err != nil {
+		return nil, errors.New("Unable to parse locust step duration: " + err.Error())
+	}
+
+	defer func() {
+		if err := client.Stop(baseUrl); err != nil {
+			logger.Warningf(err.Error())
+		}
+	}()
+
+	results := []*LocustStepResult{}
+	for userCount := controller.StartCount; userCount <= controller.EndCount; userCount += controller.StepCount {
+		result, err := client.RunStep(ctx, baseUrl, userCount, controller.HatchRate, duration, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to run locust step with %d users: %s", userCount, err.Error())
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// RunLoad runs the load test with a fixed number of users for a step duration,
+// and stops locust afterwards.
+func (client *LocustClient) RunLoad(
+	ctx context.Context,
+	baseUrl string,
+	userCount int,
+	controller *models.LocustController,
+	logger *logging.Logger) (*LocustStepResult, error) {
+	duration, err := time.ParseDuration(controller.StepDuration)
+	if err != nil {
+		return nil, errors.New("Unable to parse locust step duration: " + err.Error())
+	}
+
+	defer func() {
+		if err := client.Stop(baseUrl); err != nil {
+			logger.Warningf(err.Error())
+		}
+	}()
+
+	return client.RunStep(ctx, baseUrl, userCount, controller.HatchRate, duration, logger)
+}
+
+// Start swarms locust with the number of users without waiting for results,
+// the load runs until Stop is called.
+func (client *LocustClient) Start(baseUrl string, userCount int, hatchRate int, logger *logging.Logger) error {
+	return client.swarm(baseUrl, userCount, hatchRate, logger)
+}
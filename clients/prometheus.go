@@ -0,0 +1,207 @@
+package clients
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty"
+)
+
+// PrometheusClient reads series from the Prometheus HTTP API.
+type PrometheusClient struct {
+	Url string
+}
+
+// PrometheusSeries is a series of a range query result, where every value is a
+// [unix timestamp, value string] pair.
+type PrometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+}
+
+type prometheusRangeResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string             `json:"resultType"`
+		Result     []PrometheusSeries `json:"result"`
+	} `json:"data"`
+}
+
+func NewPrometheusClient(url string) *PrometheusClient {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+
+	return &PrometheusClient{
+		Url: strings.TrimSuffix(url, "/"),
+	}
+}
+
+func formatPrometheusTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// QueryRange evaluates the query at every step within the time range.
+func (client *PrometheusClient) QueryRange(
+	query string,
+	start time.Time,
+	end time.Time,
+	step time.Duration) ([]PrometheusSeries, error) {
+	response, err := resty.R().
+		SetQueryParams(map[string]string{
+			"query": query,
+			"start": formatPrometheusTime(start),
+			"end":   formatPrometheusTime(end),
+			"step":  strconv.FormatFloat(step.Seconds(), 'f', -1, 64),
+		}).
+		Get(client.Url + "/api/v1/query_range")
+	if err != nil {
+		return nil, errors.New("Unable to send query to prometheus: " + err.Error())
+	}
+
+	results := prometheusRangeResponse{}
+	if err := json.Unmarshal(response.Body(), &results); err != nil {
+		return nil, fmt.Errorf("Unable to parse prometheus response, code: %d, body: %s", response.StatusCode(), response.String())
+	}
+
+	if results.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed with %s: %s", results.ErrorType, results.Error)
+	}
+
+	if results.Data.ResultType != "matrix" {
+		return nil, errors.New("Unexpected prometheus result type: " + results.Data.ResultType)
+	}
+
+	return results.Data.Result, nil
+}
+
+func parsePrometheusValue(value []interface{}) (float64, float64, error) {
+	if len(value) != 2 {
+		return 0, 0, fmt.Errorf("Unexpected prometheus value: %v", value)
+	}
+
+	timestamp, ok := value[0].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("Unexpected prometheus timestamp: %v", value[0])
+	}
+
+	valueString, ok := value[1].(string)
+	if !ok {
+		return 0, 0, fmt.Errorf("Unexpected prometheus value: %v", value[1])
+	}
+
+	v, err := strconv.ParseFloat(valueString, 64)
+	if err != nil {
+		return 0, 0, errors.New("Unable to parse prometheus value: " + err.Error())
+	}
+
+	return timestamp, v, nil
+}
+
+// QueryRangeValues evaluates the query within the time range, and returns the
+// values of its first series ordered by time. The query is expected to be
+// aggregated into a single series, e.g: with sum().
+func (client *PrometheusClient) QueryRangeValues(
+	query string,
+	start time.Time,
+	end time.Time,
+	step time.Duration) ([]float64, error) {
+	series, err := client.QueryRange(query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []float64{}
+	if len(series) == 0 {
+		return values, nil
+	}
+
+	for _, value := range series[0].Values {
+		_, v, err := parsePrometheusValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+// ExportLineProtocol writes the series matching the selectors within the time
+// range to w in influx line protocol, with the metric name as the measurement,
+// the labels as tags and a single value field. It returns the number of points
+// written.
+func (client *PrometheusClient) ExportLineProtocol(
+	selectors []string,
+	start time.Time,
+	end time.Time,
+	step time.Duration,
+	w io.Writer) (int, error) {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "# DML\n# CONTEXT-DATABASE: prometheus\n")
+
+	points := 0
+	for _, selector := range selectors {
+		series, err := client.QueryRange(selector, start, end, step)
+		if err != nil {
+			return points, fmt.Errorf("Unable to query %s: %s", selector, err.Error())
+		}
+
+		for _, s := range series {
+			name := s.Metric["__name__"]
+			if name == "" {
+				continue
+			}
+
+			labels := []string{}
+			for label := range s.Metric {
+				if label != "__name__" && s.Metric[label] != "" {
+					labels = append(labels, label)
+				}
+			}
+			sort.Strings(labels)
+
+			prefix := measurementEscaper.Replace(name)
+			for _, label := range labels {
+				prefix += "," + keyEscaper.Replace(label) + "=" + keyEscaper.Replace(s.Metric[label])
+			}
+
+			for _, value := range s.Values {
+				timestamp, v, err := parsePrometheusValue(value)
+				if err != nil {
+					return points, err
+				}
+
+				// Line protocol doesn't support NaN and infinite values.
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					continue
+				}
+
+				// Prometheus timestamps have millisecond precision.
+				timestampMs := int64(timestamp*1000 + 0.5)
+				fmt.Fprintf(writer, "%s value=%s %d\n",
+					prefix, strconv.FormatFloat(v, 'g', -1, 64), timestampMs*int64(time.Millisecond))
+				points++
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return points, errors.New("Unable to write line protocol: " + err.Error())
+	}
+
+	return points, nil
+}
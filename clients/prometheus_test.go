@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrometheusExportLineProtocol(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+
+		if r.URL.Query().Get("query") != `{__name__=~"container_.+"}` {
+			t.Errorf("Unexpected query: %s", r.URL.Query().Get("query"))
+		}
+
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"container_memory_usage_bytes","pod":"app-1","container":""},` +
+			`"values":[[1.5,"1024"],[2,"NaN"],[2.5,"2048"]]}]}}`))
+	}))
+	defer server.Close()
+
+	client := NewPrometheusClient(server.URL)
+	var b bytes.Buffer
+	points, err := client.ExportLineProtocol(
+		[]string{`{__name__=~"container_.+"}`}, time.Unix(1, 0), time.Unix(3, 0), time.Second, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if points != 2 {
+		t.Errorf("Expected 2 points, got %d", points)
+	}
+
+	expected := "# DML\n# CONTEXT-DATABASE: prometheus\n" +
+		"container_memory_usage_bytes,pod=app-1 value=1024 1500000000\n" +
+		"container_memory_usage_bytes,pod=app-1 value=2048 2500000000\n"
+	if b.String() != expected {
+		t.Errorf("Unexpected line protocol:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,6 @@ import (
 	"time"
 
 	"github.com/go-resty/resty"
-	"github.com/hyperpilotio/go-utils/funcs"
 	"github.com/hyperpilotio/workload-profiler/models"
 	"github.com/op/go-logging"
 )
@@ -53,6 +53,7 @@ func (request SlowCookerCalibrateRequest) PrintVerbose(logger *logging.Logger) {
 }
 
 func (client *SlowCookerClient) RunCalibration(
+	ctx context.Context,
 	baseUrl string,
 	runId string,
 	slo models.SLO,
@@ -93,7 +94,7 @@ func (client *SlowCookerClient) RunCalibration(
 
 	results := &SlowCookerCalibrateResponse{}
 
-	err = funcs.LoopUntil(time.Minute*90, time.Second*30, func() (bool, error) {
+	err = loopUntil(ctx, time.Minute*90, time.Second*30, func() (bool, error) {
 		response, err := resty.R().Get(u.String())
 		if err != nil {
 			return false, errors.New("Unable to get calibration status from slow cooker: " + err.Error())
@@ -159,6 +160,7 @@ func (request SlowCookerBenchmarkRequest) PrintVerbose(logger *logging.Logger) {
 }
 
 func (client *SlowCookerClient) RunBenchmark(
+	ctx context.Context,
 	baseUrl string,
 	runId string,
 	appIntensity float64,
@@ -195,7 +197,7 @@ func (client *SlowCookerClient) RunBenchmark(
 	results := &SlowCookerBenchmarkResponse{}
 
 	if waitResults {
-		err = funcs.LoopUntil(time.Minute*90, time.Second*30, func() (bool, error) {
+		err = loopUntil(ctx, time.Minute*90, time.Second*30, func() (bool, error) {
 			response, err := resty.R().Get(u.String())
 			if err != nil {
 				return false, errors.New("Unable to get benchmark status from slow cooker: " + err.Error())
@@ -1,9 +1,56 @@
 package clients
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
+	"strings"
+	"time"
 )
 
 func UrlBasePath(u *url.URL) string {
 	return u.Scheme + "://" + u.Host + "/"
 }
+
+// ReplaceUrlPort returns the http url of the host of serviceUrl with the port,
+// e.g: to reach another port of a service url returned by the deployer.
+func ReplaceUrlPort(serviceUrl string, port int) (string, error) {
+	// Remove scheme and port from url
+	parts := strings.Split(strings.TrimPrefix(serviceUrl, "http://"), ":")
+	if len(parts) > 2 || len(parts) == 0 {
+		return "", errors.New("Unexpected url format: " + serviceUrl)
+	}
+
+	return fmt.Sprintf("http://%s:%d", parts[0], port), nil
+}
+
+// loopUntil behaves like funcs.LoopUntil, but stops polling and returns the
+// context error as soon as ctx is cancelled.
+func loopUntil(ctx context.Context, timeout time.Duration, interval time.Duration, f func() (bool, error)) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done, err := f()
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return errors.New("Timed out waiting for condition")
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/spf13/viper"
+)
+
+// ArtifactStore stores the files produced by runs, e.g: metrics snapshots, and
+// returns the location each file is stored at.
+type ArtifactStore interface {
+	StoreArtifact(key string, content io.Reader) (string, error)
+}
+
+// FileArtifactStore stores artifacts as files under the artifacts.path directory.
+type FileArtifactStore struct {
+	Path string
+}
+
+// S3ArtifactStore stores artifacts in a S3 bucket. Setting an endpoint allows
+// using S3 compatible stores, e.g: minio.
+type S3ArtifactStore struct {
+	BucketName string
+	Prefix     string
+	Region     string
+	Endpoint   string
+	AwsId      string
+	AwsSecret  string
+}
+
+// NewArtifactStore creates the artifact store selected by the artifacts.type
+// config, which is either file (the default) or s3.
+func NewArtifactStore(config *viper.Viper) (ArtifactStore, error) {
+	switch config.GetString("artifacts.type") {
+	case "", "file":
+		artifactsPath := config.GetString("artifacts.path")
+		if artifactsPath == "" {
+			artifactsPath = path.Join(config.GetString("filesPath"), "artifacts")
+		}
+		return &FileArtifactStore{
+			Path: artifactsPath,
+		}, nil
+	case "s3":
+		if config.GetString("artifacts.bucketName") == "" {
+			return nil, errors.New("artifacts.bucketName is not specified in the configuration file")
+		}
+		return &S3ArtifactStore{
+			BucketName: config.GetString("artifacts.bucketName"),
+			Prefix:     config.GetString("artifacts.prefix"),
+			Region:     config.GetString("artifacts.region"),
+			Endpoint:   config.GetString("artifacts.endpoint"),
+			AwsId:      config.GetString("artifacts.awsId"),
+			AwsSecret:  config.GetString("artifacts.awsSecret"),
+		}, nil
+	}
+
+	return nil, errors.New("Unsupported artifacts type: " + config.GetString("artifacts.type"))
+}
+
+func (store *FileArtifactStore) StoreArtifact(key string, content io.Reader) (string, error) {
+	filePath := path.Join(store.Path, key)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return "", errors.New("Unable to create artifact directory: " + err.Error())
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", errors.New("Unable to create artifact file: " + err.Error())
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, content); err != nil {
+		return "", fmt.Errorf("Unable to write artifact %s: %s", key, err.Error())
+	}
+
+	return "file://" + filePath, nil
+}
+
+func (store *S3ArtifactStore) StoreArtifact(key string, content io.Reader) (string, error) {
+	config := &aws.Config{
+		Region: aws.String(store.Region),
+	}
+	if store.AwsId != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(store.AwsId, store.AwsSecret, ""))
+	}
+	if store.Endpoint != "" {
+		config = config.WithEndpoint(store.Endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return "", errors.New("Unable to create aws session: " + err.Error())
+	}
+
+	objectKey := path.Join(store.Prefix, key)
+	uploader := s3manager.NewUploader(sess)
+	if _, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(store.BucketName),
+		Key:    aws.String(objectKey),
+		Body:   content,
+	}); err != nil {
+		return "", fmt.Errorf("Unable to upload artifact %s: %s", key, err.Error())
+	}
+
+	return fmt.Sprintf("s3://%s/%s", store.BucketName, objectKey), nil
+}
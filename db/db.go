@@ -23,17 +23,21 @@ type ConfigDB struct {
 	DeploymentCollection         string
 	NodeTypeCollection           string
 	PreviousGenerationCollection string
+	GCPMachineTypeCollection     string
 }
 
 type MetricsDB struct {
-	Url                   string
-	User                  string
-	Password              string
-	Database              string
-	CalibrationCollection string
-	ProfilingCollection   string
-	SizingCollection      string
-	AllInstanceCollection string
+	Url                            string
+	User                           string
+	Password                       string
+	Database                       string
+	CalibrationCollection          string
+	ProfilingCollection            string
+	SizingCollection               string
+	AllInstanceCollection          string
+	CaptureMetricsCollection       string
+	ResourceUsageCollection        string
+	SizingRecommendationCollection string
 }
 
 func NewConfigDB(config *viper.Viper) *ConfigDB {
@@ -47,6 +51,7 @@ func NewConfigDB(config *viper.Viper) *ConfigDB {
 		NodeTypeCollection:           config.GetString("database.nodeTypeCollection"),
 		PreviousGenerationCollection: config.GetString("database.previousGenerationCollection"),
 		DeploymentCollection:         config.GetString("database.deploymentCollection"),
+		GCPMachineTypeCollection:     getCollectionName(config, "database.gcpMachineTypeCollection", "gcpmachinetypes"),
 	}
 }
 
@@ -133,6 +138,23 @@ func (configDb *ConfigDB) GetPreviousGenerationConfig(region string) (*models.AW
 	return &nodeTypeConfig, nil
 }
 
+func (configDb *ConfigDB) GetGCPMachineTypeConfig(region string) (*models.GCPRegionMachineTypeConfig, error) {
+	session, sessionErr := connectMongo(configDb.Url, configDb.Database, configDb.User, configDb.Password)
+	if sessionErr != nil {
+		return nil, errors.New("Unable to create mongo session: " + sessionErr.Error())
+	}
+	glog.V(1).Infof("Successfully connected to the config DB for region %s", region)
+	defer session.Close()
+
+	collection := session.DB(configDb.Database).C(configDb.GCPMachineTypeCollection)
+	var machineTypeConfig models.GCPRegionMachineTypeConfig
+	if err := collection.Find(bson.M{"region": region}).One(&machineTypeConfig); err != nil {
+		return nil, errors.New("Unable to find machine type from db: " + err.Error())
+	}
+
+	return &machineTypeConfig, nil
+}
+
 func (configDb *ConfigDB) GetBenchmarks() ([]models.Benchmark, error) {
 	session, sessionErr := connectMongo(configDb.Url, configDb.Database, configDb.User, configDb.Password)
 	if sessionErr != nil {
@@ -151,14 +173,18 @@ func (configDb *ConfigDB) GetBenchmarks() ([]models.Benchmark, error) {
 
 func NewMetricsDB(config *viper.Viper) *MetricsDB {
 	return &MetricsDB{
-		Url:                   config.GetString("database.url"),
-		User:                  config.GetString("database.user"),
-		Password:              config.GetString("database.password"),
-		Database:              config.GetString("database.metricDatabase"),
-		CalibrationCollection: config.GetString("database.calibrationCollection"),
-		ProfilingCollection:   config.GetString("database.profilingCollection"),
-		SizingCollection:      config.GetString("database.sizingCollection"),
-		AllInstanceCollection: config.GetString("database.allInstanceCollection"),
+		Url:                      config.GetString("database.url"),
+		User:                     config.GetString("database.user"),
+		Password:                 config.GetString("database.password"),
+		Database:                 config.GetString("database.metricDatabase"),
+		CalibrationCollection:    config.GetString("database.calibrationCollection"),
+		ProfilingCollection:      config.GetString("database.profilingCollection"),
+		SizingCollection:         config.GetString("database.sizingCollection"),
+		AllInstanceCollection:    config.GetString("database.allInstanceCollection"),
+		CaptureMetricsCollection: getCollectionName(config, "database.captureMetricsCollection", "capturemetrics"),
+		ResourceUsageCollection:  getCollectionName(config, "database.resourceUsageCollection", "resourceusage"),
+		SizingRecommendationCollection: getCollectionName(
+			config, "database.sizingRecommendationCollection", "sizingrecommendation"),
 	}
 }
 
@@ -172,6 +198,12 @@ func (metricsDb *MetricsDB) getCollection(dataType string) (string, error) {
 		return metricsDb.SizingCollection, nil
 	case "allInstance":
 		return metricsDb.AllInstanceCollection, nil
+	case "captureMetrics":
+		return metricsDb.CaptureMetricsCollection, nil
+	case "resourceUsage":
+		return metricsDb.ResourceUsageCollection, nil
+	case "sizingRecommendation":
+		return metricsDb.SizingRecommendationCollection, nil
 	default:
 		return "", errors.New("Unable to find collection for: " + dataType)
 	}
@@ -198,12 +230,17 @@ func (metricsDb *MetricsDB) WriteMetrics(dataType string, obj interface{}) error
 	return nil
 }
 
-func (metricsDb *MetricsDB) UpsertMetrics(dataType string, appName string, obj interface{}) error {
+func (metricsDb *MetricsDB) UpsertMetrics(dataType string, runId string, obj interface{}) error {
 	collectionName, collectionErr := metricsDb.getCollection(dataType)
 	if collectionErr != nil {
 		return collectionErr
 	}
 
+	runIdField, err := getMongoRunIdField(dataType)
+	if err != nil {
+		return err
+	}
+
 	session, sessionErr := connectMongo(metricsDb.Url, metricsDb.Database, metricsDb.User, metricsDb.Password)
 	if sessionErr != nil {
 		return errors.New("Unable to create mongo session: " + sessionErr.Error())
@@ -212,14 +249,13 @@ func (metricsDb *MetricsDB) UpsertMetrics(dataType string, appName string, obj i
 	defer session.Close()
 
 	collection := session.DB(metricsDb.Database).C(collectionName)
-	if _, err := collection.Upsert(bson.M{"appName": appName}, obj); err != nil {
+	if _, err := collection.Upsert(bson.M{runIdField: runId}, obj); err != nil {
 		return fmt.Errorf("Unable to upsert %s into metrics db: %s", dataType, err.Error())
 	}
 
 	return nil
 }
 
-// TODO: Need to support use of filter when one collection contains multiple documents
 func (metricsDb *MetricsDB) GetMetric(dataType string, appName string, metric interface{}) (interface{}, error) {
 	collectionName, collectionErr := metricsDb.getCollection(dataType)
 	if collectionErr != nil {
@@ -233,10 +269,85 @@ func (metricsDb *MetricsDB) GetMetric(dataType string, appName string, metric in
 
 	defer session.Close()
 
+	// Documents stored before the created field was added are ordered by their object id.
 	collection := session.DB(metricsDb.Database).C(collectionName)
-	if err := collection.Find(bson.M{"appName": appName}).One(metric); err != nil {
+	if err := collection.Find(bson.M{"appName": appName}).Sort("-created", "-_id").One(metric); err != nil {
 		return nil, fmt.Errorf("Unable to read %s from metrics db: %s", dataType, err.Error())
 	}
 
 	return metric, nil
 }
+
+func (metricsDb *MetricsDB) GetMetricByRunId(dataType string, runId string, metric interface{}) (interface{}, error) {
+	collectionName, collectionErr := metricsDb.getCollection(dataType)
+	if collectionErr != nil {
+		return nil, collectionErr
+	}
+
+	runIdField, err := getMongoRunIdField(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	session, sessionErr := connectMongo(metricsDb.Url, metricsDb.Database, metricsDb.User, metricsDb.Password)
+	if sessionErr != nil {
+		return nil, errors.New("Unable to create mongo session: " + sessionErr.Error())
+	}
+
+	defer session.Close()
+
+	collection := session.DB(metricsDb.Database).C(collectionName)
+	if err := collection.Find(bson.M{runIdField: runId}).One(metric); err != nil {
+		return nil, fmt.Errorf("Unable to read %s of run %s from metrics db: %s", dataType, runId, err.Error())
+	}
+
+	return metric, nil
+}
+
+func (metricsDb *MetricsDB) GetMetrics(dataType string, query MetricsQuery, metrics interface{}) error {
+	collectionName, collectionErr := metricsDb.getCollection(dataType)
+	if collectionErr != nil {
+		return collectionErr
+	}
+
+	runIdField, err := getMongoRunIdField(dataType)
+	if err != nil {
+		return err
+	}
+
+	session, sessionErr := connectMongo(metricsDb.Url, metricsDb.Database, metricsDb.User, metricsDb.Password)
+	if sessionErr != nil {
+		return errors.New("Unable to create mongo session: " + sessionErr.Error())
+	}
+
+	defer session.Close()
+
+	filter := bson.M{}
+	if query.AppName != "" {
+		filter["appName"] = query.AppName
+	}
+	if query.RunId != "" {
+		filter[runIdField] = query.RunId
+	}
+	created := bson.M{}
+	if !query.Since.IsZero() {
+		created["$gte"] = query.Since
+	}
+	if !query.Until.IsZero() {
+		created["$lte"] = query.Until
+	}
+	if len(created) > 0 {
+		filter["created"] = created
+	}
+
+	collection := session.DB(metricsDb.Database).C(collectionName)
+	find := collection.Find(filter).Sort("-created", "-_id").Skip(query.Offset)
+	if query.Limit > 0 {
+		find = find.Limit(query.Limit)
+	}
+	if err := find.All(metrics); err != nil {
+		return fmt.Errorf("Unable to read %s from metrics db: %s", dataType, err.Error())
+	}
+
+	return nil
+}
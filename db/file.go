@@ -0,0 +1,465 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	deployer "github.com/hyperpilotio/deployer/apis"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+// fileMutex serializes access to the store files, as every run creates its own store.
+var fileMutex sync.Mutex
+
+// FileConfigDB reads configs from json files in the database.path directory,
+// so the profiler can run without a mongo database. Applications and deployments
+// are stored as <collection>/<name>.json, node types, previous generations and
+// GCP machine types as <collection>/<region>.json, and benchmarks as a list in
+// benchmarks.json.
+type FileConfigDB struct {
+	Path                         string
+	ApplicationsCollection       string
+	BenchmarksCollection         string
+	DeploymentCollection         string
+	NodeTypeCollection           string
+	PreviousGenerationCollection string
+	GCPMachineTypeCollection     string
+}
+
+// FileMetricsDB stores the documents of each data type as a json list in
+// <collection>.json files in the database.path directory.
+type FileMetricsDB struct {
+	Path                           string
+	CalibrationCollection          string
+	ProfilingCollection            string
+	SizingCollection               string
+	AllInstanceCollection          string
+	CaptureMetricsCollection       string
+	ResourceUsageCollection        string
+	SizingRecommendationCollection string
+}
+
+func getDatabasePath(config *viper.Viper) (string, error) {
+	databasePath := config.GetString("database.path")
+	if databasePath == "" {
+		return "", errors.New("database.path is not specified in the configuration file")
+	}
+
+	if err := os.MkdirAll(databasePath, 0755); err != nil {
+		return "", errors.New("Unable to create database directory: " + err.Error())
+	}
+
+	return databasePath, nil
+}
+
+func getCollectionName(config *viper.Viper, key string, defaultName string) string {
+	if name := config.GetString(key); name != "" {
+		return name
+	}
+
+	return defaultName
+}
+
+func NewFileConfigDB(config *viper.Viper) (*FileConfigDB, error) {
+	databasePath, err := getDatabasePath(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileConfigDB{
+		Path:                         path.Join(databasePath, getCollectionName(config, "database.configDatabase", "configdb")),
+		ApplicationsCollection:       getCollectionName(config, "database.applicationCollection", "applications"),
+		BenchmarksCollection:         getCollectionName(config, "database.benchmarkCollection", "benchmarks"),
+		NodeTypeCollection:           getCollectionName(config, "database.nodeTypeCollection", "nodetypes"),
+		PreviousGenerationCollection: getCollectionName(config, "database.previousGenerationCollection", "previousgenerations"),
+		DeploymentCollection:         getCollectionName(config, "database.deploymentCollection", "deployments"),
+		GCPMachineTypeCollection:     getCollectionName(config, "database.gcpMachineTypeCollection", "gcpmachinetypes"),
+	}, nil
+}
+
+func NewFileMetricsDB(config *viper.Viper) (*FileMetricsDB, error) {
+	databasePath, err := getDatabasePath(config)
+	if err != nil {
+		return nil, err
+	}
+
+	metricsPath := path.Join(databasePath, getCollectionName(config, "database.metricDatabase", "metricdb"))
+	if err := os.MkdirAll(metricsPath, 0755); err != nil {
+		return nil, errors.New("Unable to create metrics directory: " + err.Error())
+	}
+
+	return &FileMetricsDB{
+		Path:                     metricsPath,
+		CalibrationCollection:    getCollectionName(config, "database.calibrationCollection", "calibration"),
+		ProfilingCollection:      getCollectionName(config, "database.profilingCollection", "profiling"),
+		SizingCollection:         getCollectionName(config, "database.sizingCollection", "sizing"),
+		AllInstanceCollection:    getCollectionName(config, "database.allInstanceCollection", "allinstance"),
+		CaptureMetricsCollection: getCollectionName(config, "database.captureMetricsCollection", "capturemetrics"),
+		ResourceUsageCollection:  getCollectionName(config, "database.resourceUsageCollection", "resourceusage"),
+		SizingRecommendationCollection: getCollectionName(
+			config, "database.sizingRecommendationCollection", "sizingrecommendation"),
+	}, nil
+}
+
+func readJsonFile(filePath string, obj interface{}) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, obj); err != nil {
+		return fmt.Errorf("Unable to parse %s: %s", filePath, err.Error())
+	}
+
+	return nil
+}
+
+func (configDb *FileConfigDB) GetApplicationConfig(name string) (*models.ApplicationConfig, error) {
+	var appConfig models.ApplicationConfig
+	filePath := path.Join(configDb.Path, configDb.ApplicationsCollection, name+".json")
+	if err := readJsonFile(filePath, &appConfig); err != nil {
+		return nil, errors.New("Unable to find app config from db: " + err.Error())
+	}
+
+	return &appConfig, nil
+}
+
+func (configDb *FileConfigDB) GetDeploymentConfig(name string) (*deployer.Deployment, error) {
+	var deployment deployer.Deployment
+	filePath := path.Join(configDb.Path, configDb.DeploymentCollection, name+".json")
+	if err := readJsonFile(filePath, &deployment); err != nil {
+		return nil, errors.New("Unable to find deployment config from db: " + err.Error())
+	}
+
+	return &deployment, nil
+}
+
+func (configDb *FileConfigDB) GetNodeTypeConfig(region string) (*models.AWSRegionNodeTypeConfig, error) {
+	var nodeTypeConfig models.AWSRegionNodeTypeConfig
+	filePath := path.Join(configDb.Path, configDb.NodeTypeCollection, region+".json")
+	if err := readJsonFile(filePath, &nodeTypeConfig); err != nil {
+		return nil, errors.New("Unable to find node type from db: " + err.Error())
+	}
+
+	return &nodeTypeConfig, nil
+}
+
+func (configDb *FileConfigDB) GetPreviousGenerationConfig(region string) (*models.AWSRegionNodeTypeConfig, error) {
+	var nodeTypeConfig models.AWSRegionNodeTypeConfig
+	filePath := path.Join(configDb.Path, configDb.PreviousGenerationCollection, region+".json")
+	if err := readJsonFile(filePath, &nodeTypeConfig); err != nil {
+		return nil, errors.New("Unable to find previous generation from db: " + err.Error())
+	}
+
+	return &nodeTypeConfig, nil
+}
+
+func (configDb *FileConfigDB) GetGCPMachineTypeConfig(region string) (*models.GCPRegionMachineTypeConfig, error) {
+	var machineTypeConfig models.GCPRegionMachineTypeConfig
+	filePath := path.Join(configDb.Path, configDb.GCPMachineTypeCollection, region+".json")
+	if err := readJsonFile(filePath, &machineTypeConfig); err != nil {
+		return nil, errors.New("Unable to find machine type from db: " + err.Error())
+	}
+
+	return &machineTypeConfig, nil
+}
+
+func (configDb *FileConfigDB) GetBenchmarks() ([]models.Benchmark, error) {
+	var benchmarks []models.Benchmark
+	filePath := path.Join(configDb.Path, configDb.BenchmarksCollection+".json")
+	if err := readJsonFile(filePath, &benchmarks); err != nil {
+		return nil, errors.New("Unable to read benchmarks from config db: " + err.Error())
+	}
+
+	return benchmarks, nil
+}
+
+func (metricsDb *FileMetricsDB) getCollection(dataType string) (string, error) {
+	var collectionName string
+	switch dataType {
+	case "calibration":
+		collectionName = metricsDb.CalibrationCollection
+	case "profiling":
+		collectionName = metricsDb.ProfilingCollection
+	case "sizing":
+		collectionName = metricsDb.SizingCollection
+	case "allInstance":
+		collectionName = metricsDb.AllInstanceCollection
+	case "captureMetrics":
+		collectionName = metricsDb.CaptureMetricsCollection
+	case "resourceUsage":
+		collectionName = metricsDb.ResourceUsageCollection
+	case "sizingRecommendation":
+		collectionName = metricsDb.SizingRecommendationCollection
+	default:
+		return "", errors.New("Unable to find collection for: " + dataType)
+	}
+
+	return path.Join(metricsDb.Path, collectionName+".json"), nil
+}
+
+// loadDocuments loads all documents of a collection. It must be called while
+// holding the file mutex.
+func loadDocuments(filePath string) ([]json.RawMessage, error) {
+	documents := []json.RawMessage{}
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return documents, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &documents); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", filePath, err.Error())
+	}
+
+	return documents, nil
+}
+
+// storeDocuments writes all documents of a collection. It must be called while
+// holding the file mutex.
+func storeDocuments(filePath string, documents []json.RawMessage) error {
+	b, err := json.MarshalIndent(documents, "", "  ")
+	if err != nil {
+		return errors.New("Unable to marshal documents: " + err.Error())
+	}
+
+	// Write to a temporary file first, so a crash doesn't leave a partial collection.
+	tmpPath := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// documentFields are the fields used to query the stored documents.
+type documentFields struct {
+	AppName string
+	RunId   string
+	Created time.Time
+}
+
+func parseDocumentFields(document json.RawMessage, runIdField string) documentFields {
+	fields := documentFields{}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(document, &values); err != nil {
+		return fields
+	}
+
+	// Documents missing a field are only matched by queries not filtering on it.
+	if value, ok := values["appName"]; ok {
+		json.Unmarshal(value, &fields.AppName)
+	}
+	if value, ok := values[runIdField]; ok {
+		json.Unmarshal(value, &fields.RunId)
+	}
+	if value, ok := values["created"]; ok {
+		json.Unmarshal(value, &fields.Created)
+	}
+
+	return fields
+}
+
+func (fields documentFields) matches(query MetricsQuery) bool {
+	if query.AppName != "" && fields.AppName != query.AppName {
+		return false
+	}
+	if query.RunId != "" && fields.RunId != query.RunId {
+		return false
+	}
+	if !query.Since.IsZero() && fields.Created.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && fields.Created.After(query.Until) {
+		return false
+	}
+
+	return true
+}
+
+type queriedDocument struct {
+	document json.RawMessage
+	created  time.Time
+}
+
+type byCreated []queriedDocument
+
+func (documents byCreated) Len() int      { return len(documents) }
+func (documents byCreated) Swap(i, j int) { documents[i], documents[j] = documents[j], documents[i] }
+func (documents byCreated) Less(i, j int) bool {
+	return documents[i].created.After(documents[j].created)
+}
+
+// findDocuments returns the documents matching the query, ordered from the latest created.
+func (metricsDb *FileMetricsDB) findDocuments(dataType string, query MetricsQuery) ([]json.RawMessage, error) {
+	filePath, err := metricsDb.getCollection(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	runIdField, err := getRunIdField(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.Lock()
+	documents, err := loadDocuments(filePath)
+	fileMutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s from metrics db: %s", dataType, err.Error())
+	}
+
+	// Iterate from the last inserted document, so documents stored without a
+	// created time are still ordered from the latest.
+	queried := []queriedDocument{}
+	for i := len(documents) - 1; i >= 0; i-- {
+		fields := parseDocumentFields(documents[i], runIdField)
+		if fields.matches(query) {
+			queried = append(queried, queriedDocument{
+				document: documents[i],
+				created:  fields.Created,
+			})
+		}
+	}
+	sort.Stable(byCreated(queried))
+
+	results := []json.RawMessage{}
+	for i, queriedDocument := range queried {
+		if i < query.Offset {
+			continue
+		}
+		if query.Limit > 0 && len(results) >= query.Limit {
+			break
+		}
+		results = append(results, queriedDocument.document)
+	}
+
+	return results, nil
+}
+
+func (metricsDb *FileMetricsDB) WriteMetrics(dataType string, obj interface{}) error {
+	filePath, err := metricsDb.getCollection(dataType)
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(obj)
+	if err != nil {
+		return errors.New("Unable to marshal metrics: " + err.Error())
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	documents, err := loadDocuments(filePath)
+	if err != nil {
+		return errors.New("Unable to load collection: " + err.Error())
+	}
+
+	documents = append(documents, document)
+	if err := storeDocuments(filePath, documents); err != nil {
+		return errors.New("Unable to insert into collection: " + err.Error())
+	}
+
+	return nil
+}
+
+func (metricsDb *FileMetricsDB) UpsertMetrics(dataType string, runId string, obj interface{}) error {
+	filePath, err := metricsDb.getCollection(dataType)
+	if err != nil {
+		return err
+	}
+
+	runIdField, err := getRunIdField(dataType)
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(obj)
+	if err != nil {
+		return errors.New("Unable to marshal metrics: " + err.Error())
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	documents, err := loadDocuments(filePath)
+	if err != nil {
+		return fmt.Errorf("Unable to upsert %s into metrics db: %s", dataType, err.Error())
+	}
+
+	updated := false
+	for i, existingDocument := range documents {
+		if parseDocumentFields(existingDocument, runIdField).RunId == runId {
+			documents[i] = document
+			updated = true
+			break
+		}
+	}
+
+	if !updated {
+		documents = append(documents, document)
+	}
+
+	if err := storeDocuments(filePath, documents); err != nil {
+		return fmt.Errorf("Unable to upsert %s into metrics db: %s", dataType, err.Error())
+	}
+
+	return nil
+}
+
+func (metricsDb *FileMetricsDB) GetMetric(dataType string, appName string, metric interface{}) (interface{}, error) {
+	return metricsDb.getFirstMetric(dataType, MetricsQuery{AppName: appName}, metric)
+}
+
+func (metricsDb *FileMetricsDB) GetMetricByRunId(dataType string, runId string, metric interface{}) (interface{}, error) {
+	return metricsDb.getFirstMetric(dataType, MetricsQuery{RunId: runId}, metric)
+}
+
+func (metricsDb *FileMetricsDB) getFirstMetric(dataType string, query MetricsQuery, metric interface{}) (interface{}, error) {
+	documents, err := metricsDb.findDocuments(dataType, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("Unable to read %s from metrics db: not found", dataType)
+	}
+
+	if err := json.Unmarshal(documents[0], metric); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s from metrics db: %s", dataType, err.Error())
+	}
+
+	return metric, nil
+}
+
+func (metricsDb *FileMetricsDB) GetMetrics(dataType string, query MetricsQuery, metrics interface{}) error {
+	documents, err := metricsDb.findDocuments(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(documents)
+	if err != nil {
+		return errors.New("Unable to marshal documents: " + err.Error())
+	}
+
+	if err := json.Unmarshal(b, metrics); err != nil {
+		return fmt.Errorf("Unable to parse %s from metrics db: %s", dataType, err.Error())
+	}
+
+	return nil
+}
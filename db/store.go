@@ -0,0 +1,109 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	deployer "github.com/hyperpilotio/deployer/apis"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+// ConfigStore reads the application, benchmark, node type and machine type configs used to profile apps.
+type ConfigStore interface {
+	GetApplicationConfig(name string) (*models.ApplicationConfig, error)
+	GetDeploymentConfig(name string) (*deployer.Deployment, error)
+	GetNodeTypeConfig(region string) (*models.AWSRegionNodeTypeConfig, error)
+	GetPreviousGenerationConfig(region string) (*models.AWSRegionNodeTypeConfig, error)
+	GetGCPMachineTypeConfig(region string) (*models.GCPRegionMachineTypeConfig, error)
+	GetBenchmarks() ([]models.Benchmark, error)
+}
+
+// MetricsQuery selects the stored results of an app. Empty fields are not
+// used to filter the results.
+type MetricsQuery struct {
+	AppName string
+	RunId   string
+	// Since and Until select the results created within the time range.
+	Since time.Time
+	Until time.Time
+	// Offset skips the latest results, and Limit caps the number of results
+	// returned if it's positive.
+	Offset int
+	Limit  int
+}
+
+// MetricsStore stores the profiling results of each data type, i.e:
+// calibration, profiling, sizing, allInstance, captureMetrics, resourceUsage
+// and sizingRecommendation. Every result is stored with the id of the run that
+// created it and its created timestamp.
+type MetricsStore interface {
+	WriteMetrics(dataType string, obj interface{}) error
+	// UpsertMetrics replaces the results stored by the given run.
+	UpsertMetrics(dataType string, runId string, obj interface{}) error
+	// GetMetric reads the latest results of the app.
+	GetMetric(dataType string, appName string, metric interface{}) (interface{}, error)
+	GetMetricByRunId(dataType string, runId string, metric interface{}) (interface{}, error)
+	// GetMetrics reads all the results matching the query into the metrics
+	// slice pointer, ordered from the latest results.
+	GetMetrics(dataType string, query MetricsQuery, metrics interface{}) error
+}
+
+// runIdFields are the document fields storing the run id of each data type.
+var runIdFields = map[string]string{
+	"calibration":          "testId",
+	"profiling":            "testId",
+	"sizing":               "runId",
+	"allInstance":          "runId",
+	"captureMetrics":       "runId",
+	"resourceUsage":        "runId",
+	"sizingRecommendation": "runId",
+}
+
+func getRunIdField(dataType string) (string, error) {
+	if field, ok := runIdFields[dataType]; ok {
+		return field, nil
+	}
+
+	return "", errors.New("Unable to find run id field for: " + dataType)
+}
+
+// mongoRunIdFields are the bson fields storing the run id of the data types
+// whose bson field differs from their json field.
+var mongoRunIdFields = map[string]string{
+	"sizing": "runID",
+}
+
+func getMongoRunIdField(dataType string) (string, error) {
+	if field, ok := mongoRunIdFields[dataType]; ok {
+		return field, nil
+	}
+
+	return getRunIdField(dataType)
+}
+
+// NewConfigStore creates the config store selected by the database.type config,
+// which is either mongo (the default) or file.
+func NewConfigStore(config *viper.Viper) (ConfigStore, error) {
+	switch config.GetString("database.type") {
+	case "", "mongo":
+		return NewConfigDB(config), nil
+	case "file":
+		return NewFileConfigDB(config)
+	}
+
+	return nil, errors.New("Unsupported database type: " + config.GetString("database.type"))
+}
+
+// NewMetricsStore creates the metrics store selected by the database.type config,
+// which is either mongo (the default) or file.
+func NewMetricsStore(config *viper.Viper) (MetricsStore, error) {
+	switch config.GetString("database.type") {
+	case "", "mongo":
+		return NewMetricsDB(config), nil
+	case "file":
+		return NewFileMetricsDB(config)
+	}
+
+	return nil, errors.New("Unsupported database type: " + config.GetString("database.type"))
+}
@@ -3,6 +3,7 @@ package jobs
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +30,10 @@ const (
 	FAILED      = 4
 
 	ErrMaxClusters = "Max clusters reached"
+
+	defaultClusterIdleTTL = 30 * time.Minute
+	defaultMaxClusters    = 5
+	defaultClusterRegion  = "us-east-1"
 )
 
 var clusterStates = map[clusterState]string{
@@ -54,9 +59,46 @@ type cluster struct {
 	deploymentFile     string
 	deploymentId       string
 	runId              string
+	userId             string
+	region             string
+	nodes              []deployer.ClusterNode
 	state              clusterState
 	failure            string
+	forceDeleted       bool
 	created            time.Time
+	lastUsed           time.Time
+}
+
+// ClusterLimits configures the max number of clusters the profiler can deploy,
+// in total and for each deployment template and user id. Template and user limits
+// are optional, and template names and user ids are matched case insensitively.
+type ClusterLimits struct {
+	Max       int            `mapstructure:"max"`
+	Templates map[string]int `mapstructure:"templates"`
+	Users     map[string]int `mapstructure:"users"`
+}
+
+func NewClusterLimits(config *viper.Viper) (*ClusterLimits, error) {
+	limits := &ClusterLimits{}
+	if err := config.UnmarshalKey("clusterLimits", limits); err != nil {
+		return nil, errors.New("Unable to parse cluster limits: " + err.Error())
+	}
+
+	if limits.Max <= 0 {
+		limits.Max = defaultMaxClusters
+	}
+
+	return limits, nil
+}
+
+func (limits *ClusterLimits) GetTemplateLimit(deploymentTemplate string) (int, bool) {
+	limit, ok := limits.Templates[strings.ToLower(deploymentTemplate)]
+	return limit, ok
+}
+
+func (limits *ClusterLimits) GetUserLimit(userId string) (int, bool) {
+	limit, ok := limits.Users[strings.ToLower(userId)]
+	return limit, ok
 }
 
 type Clusters struct {
@@ -64,8 +106,14 @@ type Clusters struct {
 	Config         *viper.Viper
 	DeployerClient *clients.DeployerClient
 	mutex          sync.Mutex
-	MaxClusters    int
-	Deployments    []*cluster
+	Limits         *ClusterLimits
+	// IdleTTL is how long an unreserved cluster is kept available for reuse
+	// before it's deleted. Clusters are deleted right after unreserving if it's not positive.
+	IdleTTL     time.Duration
+	Deployments []*cluster
+	// capacityFreed is closed and replaced every time a cluster is removed or
+	// becomes available, to wake up jobs waiting for cluster capacity.
+	capacityFreed chan struct{}
 }
 
 func GetStateString(state clusterState) string {
@@ -86,13 +134,31 @@ func ParseStateString(state string) clusterState {
 	return -1
 }
 
+// ClusterSummary describes a cluster managed by the profiler.
+type ClusterSummary struct {
+	DeploymentId       string    `json:"deploymentId"`
+	DeploymentTemplate string    `json:"deploymentTemplate"`
+	DeploymentFile     string    `json:"deploymentFile"`
+	RunId              string    `json:"runId"`
+	UserId             string    `json:"userId"`
+	Region             string    `json:"region"`
+	State              string    `json:"state"`
+	Created            time.Time `json:"created"`
+	Age                string    `json:"age"`
+	Failure            string    `json:"failure"`
+}
+
 type storeCluster struct {
 	DeploymentTemplate string
 	DeploymentFile     string
 	DeploymentId       string
 	RunId              string
+	UserId             string
+	Region             string
+	Nodes              []deployer.ClusterNode
 	State              string
 	Created            string
+	LastUsed           string
 }
 
 func NewClusters(deployerClient *clients.DeployerClient, config *viper.Viper) (*Clusters, error) {
@@ -101,12 +167,28 @@ func NewClusters(deployerClient *clients.DeployerClient, config *viper.Viper) (*
 		return nil, errors.New("Unable to create deployments store: " + err.Error())
 	}
 
+	idleTTL := defaultClusterIdleTTL
+	if config.IsSet("clusterIdleTTL") {
+		ttl, err := time.ParseDuration(config.GetString("clusterIdleTTL"))
+		if err != nil {
+			return nil, errors.New("Unable to parse clusterIdleTTL: " + err.Error())
+		}
+		idleTTL = ttl
+	}
+
+	limits, err := NewClusterLimits(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Clusters{
 		ClusterStore:   clusterStore,
 		Config:         config,
 		DeployerClient: deployerClient,
 		Deployments:    []*cluster{},
-		MaxClusters:    5,
+		Limits:         limits,
+		IdleTTL:        idleTTL,
+		capacityFreed:  make(chan struct{}),
 	}, nil
 }
 
@@ -134,15 +216,32 @@ func (clusters *Clusters) ReloadClusterState() error {
 				deploymentFile:     storeCluster.DeploymentFile,
 				deploymentId:       storeCluster.DeploymentId,
 				runId:              storeCluster.RunId,
+				userId:             storeCluster.UserId,
+				region:             storeCluster.Region,
+				nodes:              storeCluster.Nodes,
 				state:              ParseStateString(storeCluster.State),
 			}
 
-			if createdTime, err := time.Parse(time.RFC822, storeCluster.Created); err == nil {
+			// Clusters stored before regions were recorded are in the default region.
+			if reloadCluster.region == "" {
+				reloadCluster.region = clusters.clusterRegion(JobDeploymentConfig{})
+			}
+
+			if createdTime, err := parseStoreTime(storeCluster.Created); err == nil {
 				reloadCluster.created = createdTime
 			} else {
 				glog.Warningf("Unable to parse created time %s: %s", storeCluster.Created, err.Error())
 			}
 
+			reloadCluster.lastUsed = reloadCluster.created
+			if storeCluster.LastUsed != "" {
+				if lastUsedTime, err := parseStoreTime(storeCluster.LastUsed); err == nil {
+					reloadCluster.lastUsed = lastUsedTime
+				} else {
+					glog.Warningf("Unable to parse last used time %s: %s", storeCluster.LastUsed, err.Error())
+				}
+			}
+
 			storeClusters = append(storeClusters, reloadCluster)
 		} else {
 			glog.V(1).Infof("Found recovered cluster %s to be not available, deleting from store", storeCluster.DeploymentId)
@@ -183,13 +282,67 @@ func (clusters *Clusters) newStoreCluster(selectedCluster *cluster) (*storeClust
 		DeploymentFile:     selectedCluster.deploymentFile,
 		DeploymentId:       selectedCluster.deploymentId,
 		RunId:              selectedCluster.runId,
+		UserId:             selectedCluster.userId,
+		Region:             selectedCluster.region,
+		Nodes:              selectedCluster.nodes,
 		State:              GetStateString(selectedCluster.state),
-		Created:            selectedCluster.created.Format(time.RFC822),
+		Created:            selectedCluster.created.Format(time.RFC3339),
+		LastUsed:           selectedCluster.lastUsed.Format(time.RFC3339),
 	}
 
 	return cluster, nil
 }
 
+// removeCluster removes the cluster from the tracked clusters, unless it's a
+// failed cluster that is kept until it's garbage collected or force deleted,
+// so the failure can be inspected.
+func (clusters *Clusters) removeCluster(target *cluster) {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+
+	if target.failure != "" && !target.forceDeleted {
+		target.state = FAILED
+		clusters.notifyCapacityFreed()
+		return
+	}
+
+	for i, deployment := range clusters.Deployments {
+		if deployment == target {
+			clusters.Deployments = append(clusters.Deployments[:i], clusters.Deployments[i+1:]...)
+			clusters.notifyCapacityFreed()
+			return
+		}
+	}
+}
+
+// removeFailedClusters removes the failed clusters of a job, as they're replaced
+// by the cluster the job reserves when it retries or is resumed. It must be called
+// while holding the clusters lock.
+func (clusters *Clusters) removeFailedClusters(runId string) {
+	deployments := []*cluster{}
+	for _, deployment := range clusters.Deployments {
+		if deployment.runId == runId && deployment.state == FAILED {
+			continue
+		}
+		deployments = append(deployments, deployment)
+	}
+	clusters.Deployments = deployments
+}
+
+// SetFailure records the error of the job running on its cluster, which keeps the
+// cluster listed as failed once the job unreserves it.
+func (clusters *Clusters) SetFailure(runId string, failure string) {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+
+	for _, deployment := range clusters.Deployments {
+		if deployment.runId == runId && deployment.state != FAILED {
+			deployment.failure = failure
+			return
+		}
+	}
+}
+
 func (clusters *Clusters) removeDeployment(runId string) bool {
 	clusters.mutex.Lock()
 	defer clusters.mutex.Unlock()
@@ -199,31 +352,212 @@ func (clusters *Clusters) removeDeployment(runId string) bool {
 			clusters.Deployments[i] = clusters.Deployments[len(clusters.Deployments)-1]
 			clusters.Deployments[len(clusters.Deployments)-1] = nil
 			clusters.Deployments = clusters.Deployments[:len(clusters.Deployments)-1]
+			clusters.notifyCapacityFreed()
 			return true
 		}
 	}
 	return false
 }
 
+// findReusableCluster returns an available cluster that was deployed for the user with the
+// same deployment template, region and nodes, so it can be reused without creating a new deployment.
+func (clusters *Clusters) findReusableCluster(
+	applicationConfig *models.ApplicationConfig,
+	jobDeploymentConfig JobDeploymentConfig,
+	userId string) *cluster {
+	for _, deployment := range clusters.Deployments {
+		if deployment.state != AVAILABLE || !deployment.isReusable() {
+			continue
+		}
+
+		// Clusters are deployed for their user, and are only reused by the same user.
+		if deployment.userId != userId {
+			continue
+		}
+
+		if deployment.deploymentTemplate != applicationConfig.DeploymentTemplate ||
+			applicationConfig.DeploymentFile != "" {
+			continue
+		}
+
+		if deployment.region != clusters.clusterRegion(jobDeploymentConfig) {
+			continue
+		}
+
+		if !isNodesCompatible(deployment.nodes, jobDeploymentConfig.GetNodes()) {
+			continue
+		}
+
+		return deployment
+	}
+
+	return nil
+}
+
+// isReusable returns if the cluster can be reset and reused by another job.
+// Only clusters deployed from a deployment template can be reset.
+func (cluster *cluster) isReusable() bool {
+	return cluster.deploymentTemplate != "" && cluster.deploymentFile == ""
+}
+
+func isNodesCompatible(clusterNodes []deployer.ClusterNode, jobNodes []deployer.ClusterNode) bool {
+	if len(clusterNodes) != len(jobNodes) {
+		return false
+	}
+
+	instanceTypes := map[int]string{}
+	for _, node := range clusterNodes {
+		instanceTypes[node.Id] = node.InstanceType
+	}
+
+	for _, node := range jobNodes {
+		if instanceType, ok := instanceTypes[node.Id]; !ok || instanceType != node.InstanceType {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CapacityFreed returns a channel that is closed the next time a cluster is
+// removed or becomes available. It should be fetched before reserving a deployment,
+// so capacity freed during the reservation isn't missed.
+func (clusters *Clusters) CapacityFreed() <-chan struct{} {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+	return clusters.capacityFreed
+}
+
+// notifyCapacityFreed wakes up jobs waiting for cluster capacity. It must be called
+// while holding the clusters lock.
+func (clusters *Clusters) notifyCapacityFreed() {
+	close(clusters.capacityFreed)
+	clusters.capacityFreed = make(chan struct{})
+}
+
+// IsCapacityError returns if a reserve error is caused by a cluster limit.
+func IsCapacityError(err string) bool {
+	return strings.HasPrefix(err, ErrMaxClusters)
+}
+
+// clusterUserId returns the user a job's cluster is deployed for, which
+// defaults to the defaultClusterUserId config.
+func (clusters *Clusters) clusterUserId(userId string) string {
+	if userId != "" {
+		return userId
+	}
+
+	return clusters.Config.GetString("defaultClusterUserId")
+}
+
+// clusterRegion returns the region the job's cluster is deployed in, which
+// defaults to the aws.region config.
+func (clusters *Clusters) clusterRegion(jobDeploymentConfig JobDeploymentConfig) string {
+	if jobDeploymentConfig.Region != "" {
+		return jobDeploymentConfig.Region
+	}
+
+	if region := clusters.Config.GetString("aws.region"); region != "" {
+		return region
+	}
+
+	return defaultClusterRegion
+}
+
+// checkClusterLimits returns the reason a new cluster cannot be deployed for the
+// application, or an empty string if none of the cluster limits are reached.
+// An idle cluster counting toward the reached limit is evicted to make room.
+func (clusters *Clusters) checkClusterLimits(applicationConfig *models.ApplicationConfig, userId string) string {
+	limits := clusters.Limits
+	if clusters.countClusters(func(deployment *cluster) bool { return true }) >= limits.Max {
+		clusters.evictIdleCluster(func(deployment *cluster) bool { return true })
+		return fmt.Sprintf("%s: global limit of %d clusters", ErrMaxClusters, limits.Max)
+	}
+
+	deploymentTemplate := applicationConfig.DeploymentTemplate
+	if limit, ok := limits.GetTemplateLimit(deploymentTemplate); ok && deploymentTemplate != "" {
+		sameTemplate := func(deployment *cluster) bool {
+			return deployment.deploymentTemplate == deploymentTemplate
+		}
+		if clusters.countClusters(sameTemplate) >= limit {
+			clusters.evictIdleCluster(sameTemplate)
+			return fmt.Sprintf("%s: limit of %d clusters for deployment template %s",
+				ErrMaxClusters, limit, deploymentTemplate)
+		}
+	}
+
+	if limit, ok := limits.GetUserLimit(userId); ok && userId != "" {
+		sameUser := func(deployment *cluster) bool {
+			return deployment.userId == userId
+		}
+		if clusters.countClusters(sameUser) >= limit {
+			clusters.evictIdleCluster(sameUser)
+			return fmt.Sprintf("%s: limit of %d clusters for user %s", ErrMaxClusters, limit, userId)
+		}
+	}
+
+	return ""
+}
+
+// countClusters returns the number of clusters that match the filter. Failed
+// clusters don't count toward the cluster limits.
+func (clusters *Clusters) countClusters(filter func(deployment *cluster) bool) int {
+	count := 0
+	for _, deployment := range clusters.Deployments {
+		if deployment.state != FAILED && filter(deployment) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// evictIdleCluster deletes the least recently used available cluster that matches
+// the filter, to make room for a cluster with a different deployment template.
+func (clusters *Clusters) evictIdleCluster(filter func(deployment *cluster) bool) {
+	var idleCluster *cluster
+	for _, deployment := range clusters.Deployments {
+		if deployment.state != AVAILABLE || !filter(deployment) {
+			continue
+		}
+
+		if idleCluster == nil || deployment.lastUsed.Before(idleCluster.lastUsed) {
+			idleCluster = deployment
+		}
+	}
+
+	if idleCluster == nil {
+		return
+	}
+
+	glog.Infof("Evicting idle cluster %s to make room for new clusters", idleCluster.deploymentId)
+	idleCluster.state = UNRESERVING
+	go clusters.deleteClusterDeployment(idleCluster)
+}
+
 func (clusters *Clusters) ReserveDeployment(
 	config *viper.Viper,
 	applicationConfig *models.ApplicationConfig,
 	jobDeploymentConfig JobDeploymentConfig,
 	runId string,
+	userId string,
 	log *logging.Logger) <-chan ReserveResult {
 	clusters.mutex.Lock()
 	defer clusters.mutex.Unlock()
 
-	// TODO: Find a cluster that has the same deployment template base, and reserve it.
-	// If not, launch a new one up to the configured limit.
-	var selectedCluster *cluster
+	reserveResult := make(chan ReserveResult, 1)
+	clusters.removeFailedClusters(runId)
+	userId = clusters.clusterUserId(userId)
 
-	reserveResult := make(chan ReserveResult)
+	// Find an available cluster of the user that has the same deployment template base,
+	// and reserve it. If not, launch a new one up to the configured limits.
+	selectedCluster := clusters.findReusableCluster(applicationConfig, jobDeploymentConfig, userId)
 
 	if selectedCluster == nil {
-		if len(clusters.Deployments) == clusters.MaxClusters {
+		if limitErr := clusters.checkClusterLimits(applicationConfig, userId); limitErr != "" {
+			log.Infof("Unable to deploy new cluster for job %s: %s", runId, limitErr)
 			reserveResult <- ReserveResult{
-				Err: ErrMaxClusters,
+				Err: limitErr,
 			}
 			return reserveResult
 		}
@@ -232,17 +566,25 @@ func (clusters *Clusters) ReserveDeployment(
 			deploymentTemplate: applicationConfig.DeploymentTemplate,
 			deploymentFile:     applicationConfig.DeploymentFile,
 			runId:              runId,
+			userId:             userId,
+			region:             clusters.clusterRegion(jobDeploymentConfig),
+			nodes:              jobDeploymentConfig.GetNodes(),
 			state:              DEPLOYING,
 			created:            time.Now(),
+			lastUsed:           time.Now(),
 		}
 
 		clusters.Deployments = append(clusters.Deployments, selectedCluster)
 
 		go func() {
 			deploymentId, deploymentErr :=
-				clusters.createDeployment(applicationConfig, jobDeploymentConfig, runId, log)
+				clusters.createDeployment(applicationConfig, jobDeploymentConfig, runId, userId, log)
 			if deploymentErr != nil {
-				clusters.removeDeployment(runId)
+				clusters.mutex.Lock()
+				selectedCluster.state = FAILED
+				selectedCluster.failure = deploymentErr.Error()
+				clusters.notifyCapacityFreed()
+				clusters.mutex.Unlock()
 				reserveResult <- ReserveResult{
 					Err: deploymentErr.Error(),
 				}
@@ -250,8 +592,10 @@ func (clusters *Clusters) ReserveDeployment(
 			}
 
 			glog.Infof("New cluster deployed successfully with deployment id %s", deploymentId)
+			clusters.mutex.Lock()
 			selectedCluster.deploymentId = deploymentId
 			selectedCluster.state = RESERVED
+			clusters.mutex.Unlock()
 
 			if err := clusters.storeCluster(selectedCluster); err != nil {
 				log.Errorf("Unable to store %s cluster during reserve deployment: %s", runId, err.Error())
@@ -262,60 +606,58 @@ func (clusters *Clusters) ReserveDeployment(
 			}
 		}()
 	} else {
-		go func() {
-			if selectedCluster.state == UNRESERVING {
-				glog.Infof("Waiting for deployment %s to be unreserved...")
-				for {
-					if selectedCluster.state != UNRESERVING {
-						break
-					}
-
-					time.Sleep(5 * time.Second)
-				}
-
-				if selectedCluster.state != AVAILABLE {
-					message := "Cluster after unreserving is not in available state, new state: " +
-						GetStateString(selectedCluster.state)
-					log.Errorf(message)
-					reserveResult <- ReserveResult{
-						Err: message,
-					}
-					return
-				}
-			}
+		log.Infof("Reusing available cluster %s for job %s", selectedCluster.deploymentId, runId)
+		originRunId := selectedCluster.runId
+		selectedCluster.state = DEPLOYING
+		selectedCluster.runId = runId
+		selectedCluster.failure = ""
 
+		go func() {
 			if err := clusters.deployExtensions(applicationConfig,
-				selectedCluster.deploymentId, runId, log); err != nil {
+				selectedCluster.deploymentId, selectedCluster.region, runId, log); err != nil {
+				message := fmt.Sprintf("Unable to deploy extensions on cluster %s: %s",
+					selectedCluster.deploymentId, err.Error())
+				log.Errorf(message)
+				clusters.mutex.Lock()
 				selectedCluster.state = FAILED
 				selectedCluster.failure = err.Error()
+				clusters.mutex.Unlock()
 				reserveResult <- ReserveResult{
-					Err: err.Error(),
-				}
-			} else {
-				originRunId := selectedCluster.runId
-				selectedCluster.state = RESERVED
-				selectedCluster.runId = runId
-
-				if originRunId != "" {
-					if err := clusters.ClusterStore.Delete(originRunId); err != nil {
-						log.Errorf("Unable to delete profiler cluster: %s", err.Error())
-					}
+					Err: message,
 				}
+				clusters.deleteClusterDeployment(selectedCluster)
+				return
+			}
 
-				if err := clusters.storeCluster(selectedCluster); err != nil {
-					log.Errorf("Unable to store %s cluster during reserve deployment: %s", runId, err.Error())
-				}
+			clusters.mutex.Lock()
+			selectedCluster.state = RESERVED
+			selectedCluster.lastUsed = time.Now()
+			clusters.mutex.Unlock()
 
-				reserveResult <- ReserveResult{
-					DeploymentId: selectedCluster.deploymentId,
+			if originRunId != "" && originRunId != runId {
+				if err := clusters.ClusterStore.Delete(originRunId); err != nil {
+					log.Errorf("Unable to delete profiler cluster: %s", err.Error())
 				}
 			}
+
+			if err := clusters.storeCluster(selectedCluster); err != nil {
+				log.Errorf("Unable to store %s cluster during reserve deployment: %s", runId, err.Error())
+			}
+
+			reserveResult <- ReserveResult{
+				DeploymentId: selectedCluster.deploymentId,
+			}
 		}()
 	}
 
 	return reserveResult
 }
 
+// unreserveCluster releases the cluster reserved by a job. If deleteCluster is false
+// the deployment is left running, so it can be inspected after a failure, and it's
+// listed as failed until it's force deleted. Otherwise reusable clusters are reset
+// and become available to other jobs until they're idle longer than the idle TTL,
+// and other clusters are deleted.
 func (clusters *Clusters) unreserveCluster(cluster *cluster, deleteCluster bool, log *logging.Logger) <-chan UnreserveResult {
 	unreserveResult := make(chan UnreserveResult, 2)
 
@@ -324,17 +666,21 @@ func (clusters *Clusters) unreserveCluster(cluster *cluster, deleteCluster bool,
 			Err: fmt.Sprintf("Unable to find cluster"),
 		}
 		return unreserveResult
-	} else if cluster.state == UNRESERVING {
+	}
+
+	clusters.mutex.Lock()
+	if cluster.state == UNRESERVING {
+		clusters.mutex.Unlock()
 		unreserveResult <- UnreserveResult{
-			Err: fmt.Sprintf("Cluster %s is already unreserved"),
+			Err: fmt.Sprintf("Cluster %s is already unreserved", cluster.deploymentId),
 		}
 		return unreserveResult
 	}
-
 	cluster.state = UNRESERVING
+	clusters.mutex.Unlock()
 
 	if !deleteCluster {
-		clusters.removeDeployment(cluster.runId)
+		clusters.removeCluster(cluster)
 		unreserveResult <- UnreserveResult{
 			RunId: cluster.runId,
 		}
@@ -345,29 +691,108 @@ func (clusters *Clusters) unreserveCluster(cluster *cluster, deleteCluster bool,
 		return unreserveResult
 	}
 
-	go func() {
-		if err := clusters.DeployerClient.DeleteDeployment(cluster.deploymentId, log); err != nil {
-			unreserveResult <- UnreserveResult{
-				Err: err.Error(),
+	// Clusters of failed jobs aren't reused, as they might be left in a broken state.
+	if clusters.IdleTTL > 0 && cluster.isReusable() && cluster.failure == "" {
+		go func() {
+			if err := clusters.resetTemplateDeployment(
+				cluster.deploymentTemplate, cluster.deploymentId, log); err != nil {
+				log.Warningf("Unable to reset cluster %s, deleting it: %s", cluster.deploymentId, err.Error())
+				clusters.deleteCluster(cluster, log, unreserveResult)
+				return
 			}
-		} else {
+
+			clusters.mutex.Lock()
+			cluster.state = AVAILABLE
+			cluster.lastUsed = time.Now()
+			clusters.notifyCapacityFreed()
+			clusters.mutex.Unlock()
+
+			if err := clusters.storeCluster(cluster); err != nil {
+				glog.Errorf("Unable to store available cluster %s: %s", cluster.deploymentId, err.Error())
+			}
+
+			log.Infof("Cluster %s is available for reuse", cluster.deploymentId)
 			unreserveResult <- UnreserveResult{
 				RunId: cluster.runId,
 			}
+		}()
+
+		return unreserveResult
+	}
+
+	go clusters.deleteCluster(cluster, log, unreserveResult)
+
+	return unreserveResult
+}
+
+func (clusters *Clusters) deleteCluster(
+	cluster *cluster,
+	log *logging.Logger,
+	unreserveResult chan<- UnreserveResult) {
+	if err := clusters.DeployerClient.DeleteDeployment(cluster.deploymentId, log); err != nil {
+		unreserveResult <- UnreserveResult{
+			Err: err.Error(),
 		}
+	} else {
+		unreserveResult <- UnreserveResult{
+			RunId: cluster.runId,
+		}
+	}
 
-		clusters.removeDeployment(cluster.runId)
+	clusters.removeCluster(cluster)
 
-		if err := clusters.ClusterStore.Delete(cluster.runId); err != nil {
-			glog.Errorf("Unable to delete profiler cluster: %s", err.Error())
+	if err := clusters.ClusterStore.Delete(cluster.runId); err != nil {
+		glog.Errorf("Unable to delete profiler cluster: %s", err.Error())
+	}
+}
+
+// deleteClusterDeployment deletes a cluster outside of a job unreserving it,
+// e.g: idle or evicted clusters. It logs to a separate cluster log file.
+func (clusters *Clusters) deleteClusterDeployment(cluster *cluster) {
+	log, logErr := log.NewLogger(clusters.Config.GetString("filesPath"), "cluster-"+cluster.deploymentId)
+	if logErr != nil {
+		glog.Errorf("Error creating deployment logger: " + logErr.Error())
+		return
+	}
+	defer log.LogFile.Close()
+
+	unreserveResult := make(chan UnreserveResult, 1)
+	clusters.deleteCluster(cluster, log.Logger, unreserveResult)
+	if result := <-unreserveResult; result.Err != "" {
+		glog.Warningf("Unable to delete idle cluster %s: %s", cluster.deploymentId, result.Err)
+	} else {
+		glog.Infof("Idle cluster %s deleted", cluster.deploymentId)
+	}
+}
+
+// RunIdleClusterCleaner periodically deletes available clusters that
+// haven't been reserved by any job longer than the idle TTL.
+func (clusters *Clusters) RunIdleClusterCleaner() {
+	if clusters.IdleTTL <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			clusters.mutex.Lock()
+			idleClusters := []*cluster{}
+			for _, deployment := range clusters.Deployments {
+				if deployment.state == AVAILABLE && time.Since(deployment.lastUsed) > clusters.IdleTTL {
+					deployment.state = UNRESERVING
+					idleClusters = append(idleClusters, deployment)
+				}
+			}
+			clusters.mutex.Unlock()
+
+			for _, idleCluster := range idleClusters {
+				glog.Infof("Deleting cluster %s idle since %s", idleCluster.deploymentId, idleCluster.lastUsed)
+				clusters.deleteClusterDeployment(idleCluster)
+			}
 		}
 	}()
-
-	return unreserveResult
 }
 
 func (clusters *Clusters) UnreserveDeployment(runId string, deleteCluster bool, log *logging.Logger) <-chan UnreserveResult {
-	// TODO: Unreserve a deployment. After certain time also try to delete deployments.
 	clusters.mutex.Lock()
 
 	var selectedCluster *cluster
@@ -399,12 +824,12 @@ func (clusters *Clusters) createDeployment(
 	applicationConfig *models.ApplicationConfig,
 	jobDeploymentConfig JobDeploymentConfig,
 	runId string,
+	userId string,
 	log *logging.Logger) (string, error) {
 	clusterDefinition := &deployer.ClusterDefinition{
 		Nodes: jobDeploymentConfig.GetNodes(),
 	}
 
-	userId := clusters.Config.GetString("defaultClusterUserId")
 	if applicationConfig.DeploymentFile != "" {
 		deploymentFiles, err := NewDeploymentFiles(clusters.Config)
 		if err != nil {
@@ -422,6 +847,9 @@ func (clusters *Clusters) createDeployment(
 		}
 
 		deployment.Name = "workload-profiler-" + runId
+		if jobDeploymentConfig.Region != "" {
+			deployment.Region = jobDeploymentConfig.Region
+		}
 
 		deploymentId, err := clusters.DeployerClient.CreateDeployment(
 			deployment, applicationConfig.LoadTester.Name, log)
@@ -434,6 +862,7 @@ func (clusters *Clusters) createDeployment(
 
 	deployment := &deployer.Deployment{
 		Name:              "workload-profiler-" + runId,
+		Region:            jobDeploymentConfig.Region,
 		NodeMapping:       []deployer.NodeMapping{},
 		ClusterDefinition: *clusterDefinition,
 		KubernetesDeployment: &deployer.KubernetesDeployment{
@@ -482,6 +911,9 @@ func (clusters *Clusters) resetTemplateDeployment(
 	deploymentTemplate string,
 	deploymentId string,
 	log *logging.Logger) error {
+	if err := clusters.DeployerClient.ResetTemplateDeployment(deploymentTemplate, deploymentId, log); err != nil {
+		return errors.New("Unable to reset template deployment: " + err.Error())
+	}
 
 	return nil
 }
@@ -489,13 +921,14 @@ func (clusters *Clusters) resetTemplateDeployment(
 func (clusters *Clusters) deployExtensions(
 	applicationConfig *models.ApplicationConfig,
 	deploymentId string,
+	region string,
 	runId string,
 	log *logging.Logger) error {
 	clusterDefinition := &deployer.ClusterDefinition{
 		Nodes: []deployer.ClusterNode{},
 	}
 	deployment := &deployer.Deployment{
-		Region:            "us-east-1",
+		Region:            region,
 		Name:              "workload-profiler-" + applicationConfig.Name,
 		NodeMapping:       []deployer.NodeMapping{},
 		ClusterDefinition: *clusterDefinition,
@@ -579,3 +1012,146 @@ func (clusters *Clusters) GetState(runId string) clusterState {
 
 	return -1
 }
+
+func (clusters *Clusters) GetClusterSummaries() []ClusterSummary {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+
+	summaries := []ClusterSummary{}
+	for _, deployment := range clusters.Deployments {
+		summaries = append(summaries, ClusterSummary{
+			DeploymentId:       deployment.deploymentId,
+			DeploymentTemplate: deployment.deploymentTemplate,
+			DeploymentFile:     deployment.deploymentFile,
+			RunId:              deployment.runId,
+			UserId:             deployment.userId,
+			Region:             deployment.region,
+			State:              GetStateString(deployment.state),
+			Created:            deployment.created,
+			Age:                time.Since(deployment.created).String(),
+			Failure:            deployment.failure,
+		})
+	}
+
+	return summaries
+}
+
+// findClusterRunId returns the run id of the job that reserved the cluster of
+// the deployment id.
+func (clusters *Clusters) findClusterRunId(deploymentId string) (string, error) {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+
+	for _, deployment := range clusters.Deployments {
+		if deployment.deploymentId == deploymentId {
+			return deployment.runId, nil
+		}
+	}
+
+	return "", errors.New("Unable to find cluster with deployment id: " + deploymentId)
+}
+
+// ForceDeleteCluster deletes a cluster regardless of its state, e.g: a cluster
+// stuck in unreserving or failed state. The job that reserved the cluster won't be
+// able to unreserve it afterwards, use JobManager.ForceDeleteCluster to cancel it first.
+func (clusters *Clusters) ForceDeleteCluster(deploymentId string) error {
+	clusters.mutex.Lock()
+	defer clusters.mutex.Unlock()
+
+	for _, deployment := range clusters.Deployments {
+		if deployment.deploymentId == deploymentId {
+			glog.Infof("Force deleting cluster %s in %s state", deploymentId, GetStateString(deployment.state))
+			deployment.state = UNRESERVING
+			deployment.forceDeleted = true
+			go clusters.deleteClusterDeployment(deployment)
+			return nil
+		}
+	}
+
+	return errors.New("Unable to find cluster with deployment id: " + deploymentId)
+}
+
+// GarbageCollect reconciles the stored and tracked clusters with the deployer,
+// and removes clusters which deployments no longer exist. It returns the run ids
+// of the removed clusters.
+func (clusters *Clusters) GarbageCollect() ([]string, error) {
+	existingClusters, err := clusters.ClusterStore.LoadAll(func() interface{} {
+		return &storeCluster{}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load profiler clusters: %s", err.Error())
+	}
+
+	leakedRunIds := map[string]bool{}
+	for _, deployment := range existingClusters.([]interface{}) {
+		storeCluster := deployment.(*storeCluster)
+		if storeCluster.DeploymentId == "" {
+			continue
+		}
+
+		deploymentReady, err := clusters.DeployerClient.IsDeploymentReady(storeCluster.DeploymentId)
+		if err != nil {
+			glog.Warningf("Skip collecting cluster %s, unable to get deployment state: %s",
+				storeCluster.DeploymentId, err.Error())
+			continue
+		}
+
+		if !deploymentReady {
+			leakedRunIds[storeCluster.RunId] = true
+		}
+	}
+
+	// Snapshot the tracked clusters, as their state is changed by jobs while
+	// the deployer is queried.
+	type trackedCluster struct {
+		runId        string
+		deploymentId string
+		state        clusterState
+	}
+	clusters.mutex.Lock()
+	deployments := []trackedCluster{}
+	for _, deployment := range clusters.Deployments {
+		deployments = append(deployments, trackedCluster{
+			runId:        deployment.runId,
+			deploymentId: deployment.deploymentId,
+			state:        deployment.state,
+		})
+	}
+	clusters.mutex.Unlock()
+
+	for _, deployment := range deployments {
+		// Clusters that failed to deploy have nothing left to delete.
+		if deployment.state == FAILED && deployment.deploymentId == "" {
+			leakedRunIds[deployment.runId] = true
+			continue
+		}
+
+		// Clusters that are still deploying don't have a deployment id yet.
+		if deployment.state == DEPLOYING || deployment.deploymentId == "" || leakedRunIds[deployment.runId] {
+			continue
+		}
+
+		deploymentReady, err := clusters.DeployerClient.IsDeploymentReady(deployment.deploymentId)
+		if err != nil {
+			glog.Warningf("Skip collecting cluster %s, unable to get deployment state: %s",
+				deployment.deploymentId, err.Error())
+			continue
+		}
+
+		if !deploymentReady {
+			leakedRunIds[deployment.runId] = true
+		}
+	}
+
+	removedRunIds := []string{}
+	for runId := range leakedRunIds {
+		glog.Infof("Removing leaked cluster for run %s", runId)
+		clusters.removeDeployment(runId)
+		if err := clusters.ClusterStore.Delete(runId); err != nil {
+			glog.Errorf("Unable to delete profiler cluster: %s", err.Error())
+		}
+		removedRunIds = append(removedRunIds, runId)
+	}
+
+	return removedRunIds, nil
+}
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	StateEventType    = "state"
+	ProgressEventType = "progress"
+
+	// maxJobEvents bounds the events kept per job, which are replayed to new
+	// subscribers.
+	maxJobEvents = 100
+	// subscriberBuffer is the number of events a subscriber can fall behind
+	// before events are dropped for it.
+	subscriberBuffer = 100
+)
+
+// JobProgress is the progress of a job within its current stage. Current and
+// Total count the items of the stage, e.g: the benchmarks of a benchmark run
+// or the instance types of a sizing run.
+type JobProgress struct {
+	Stage        string `json:"stage"`
+	Message      string `json:"message,omitempty"`
+	Current      int    `json:"current,omitempty"`
+	Total        int    `json:"total,omitempty"`
+	Service      string `json:"service,omitempty"`
+	Benchmark    string `json:"benchmark,omitempty"`
+	InstanceType string `json:"instanceType,omitempty"`
+	// Intensity is the benchmark intensity being run, which is the
+	// IntensityStep-th of IntensitySteps intensities of the benchmark.
+	Intensity      int `json:"intensity,omitempty"`
+	IntensityStep  int `json:"intensityStep,omitempty"`
+	IntensitySteps int `json:"intensitySteps,omitempty"`
+}
+
+// JobEvent is a state transition or a progress update of a job.
+type JobEvent struct {
+	Type     string       `json:"type"`
+	RunId    string       `json:"runId"`
+	State    string       `json:"state,omitempty"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	Time     time.Time    `json:"time"`
+}
+
+// ProgressReporter is implemented by jobs that publish their progress. The
+// job manager sets the events of every job it's given.
+type ProgressReporter interface {
+	SetJobEvents(events *JobEvents)
+}
+
+// JobEvents keeps the recent events of every job, and fans them out to the
+// subscribers of the job.
+type JobEvents struct {
+	events      map[string][]JobEvent
+	subscribers map[string]map[chan JobEvent]bool
+	mutex       sync.Mutex
+}
+
+func NewJobEvents() *JobEvents {
+	return &JobEvents{
+		events:      make(map[string][]JobEvent),
+		subscribers: make(map[string]map[chan JobEvent]bool),
+	}
+}
+
+func (jobEvents *JobEvents) Publish(event JobEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	jobEvents.mutex.Lock()
+	defer jobEvents.mutex.Unlock()
+
+	events := append(jobEvents.events[event.RunId], event)
+	if len(events) > maxJobEvents {
+		events = events[len(events)-maxJobEvents:]
+	}
+	jobEvents.events[event.RunId] = events
+
+	for subscriber := range jobEvents.subscribers[event.RunId] {
+		select {
+		case subscriber <- event:
+		default:
+			glog.Warningf("Dropping %s event of job %s for a slow subscriber", event.Type, event.RunId)
+		}
+	}
+}
+
+// PublishState publishes the job's state transition.
+func (jobEvents *JobEvents) PublishState(runId string, state string) {
+	jobEvents.Publish(JobEvent{
+		Type:  StateEventType,
+		RunId: runId,
+		State: state,
+	})
+}
+
+// PublishProgress publishes the job's progress.
+func (jobEvents *JobEvents) PublishProgress(runId string, progress JobProgress) {
+	jobEvents.Publish(JobEvent{
+		Type:     ProgressEventType,
+		RunId:    runId,
+		Progress: &progress,
+	})
+}
+
+// Subscribe returns the recent events of the job, and a channel receiving its
+// next events until Unsubscribe is called.
+func (jobEvents *JobEvents) Subscribe(runId string) ([]JobEvent, chan JobEvent) {
+	jobEvents.mutex.Lock()
+	defer jobEvents.mutex.Unlock()
+
+	subscriber := make(chan JobEvent, subscriberBuffer)
+	if _, ok := jobEvents.subscribers[runId]; !ok {
+		jobEvents.subscribers[runId] = make(map[chan JobEvent]bool)
+	}
+	jobEvents.subscribers[runId][subscriber] = true
+
+	return append([]JobEvent{}, jobEvents.events[runId]...), subscriber
+}
+
+func (jobEvents *JobEvents) Unsubscribe(runId string, subscriber chan JobEvent) {
+	jobEvents.mutex.Lock()
+	defer jobEvents.mutex.Unlock()
+
+	delete(jobEvents.subscribers[runId], subscriber)
+	if len(jobEvents.subscribers[runId]) == 0 {
+		delete(jobEvents.subscribers, runId)
+	}
+}
+
+// GetProgress returns the latest progress of the job, or nil if the job
+// hasn't reported any.
+func (jobEvents *JobEvents) GetProgress(runId string) *JobProgress {
+	jobEvents.mutex.Lock()
+	defer jobEvents.mutex.Unlock()
+
+	events := jobEvents.events[runId]
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Progress != nil {
+			return events[i].Progress
+		}
+	}
+
+	return nil
+}
+
+// IsFinalState returns if the job won't transition to another state.
+func IsFinalState(state string) bool {
+	return state == JOB_FINISHED || state == JOB_FAILED || state == JOB_CANCELLED
+}
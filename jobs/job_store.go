@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperpilotio/blobstore"
+	"github.com/hyperpilotio/go-utils/log"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+const ErrJobInterrupted = "Job interrupted by profiler restart"
+
+// JobRequest describes how a job was submitted, so the job can be recreated
+// after the profiler restarts.
+type JobRequest struct {
+	Type                   string `json:"type"`
+	AppName                string `json:"appName"`
+	SkipUnreserveOnFailure bool   `json:"skipUnreserveOnFailure"`
+	// CalibrationRunId pins the calibration results the job uses, instead of
+	// the latest calibration results of the app.
+	CalibrationRunId string `json:"calibrationRunId,omitempty"`
+	// CallbackUrl is notified when the job finishes or fails.
+	CallbackUrl string `json:"callbackUrl,omitempty"`
+	// UserId is the user the job's clusters are deployed for, which counts
+	// toward the user's cluster limit. The defaultClusterUserId config is used
+	// if it's empty.
+	UserId string `json:"userId,omitempty"`
+	// PipelineId is the pipeline run the job is a stage of. Pipeline stages
+	// aren't restored on their own, their pipeline reruns them when it's restored.
+	PipelineId string `json:"pipelineId,omitempty"`
+	// Parameters is the json encoded job type specific parameters.
+	Parameters string `json:"parameters"`
+}
+
+// JobLoader recreates a job from its stored request. Jobs that cannot be
+// recreated (e.g: jobs spawned by another job) should return an error.
+type JobLoader func(manager *JobManager, runId string, request JobRequest) (Job, error)
+
+type storeJob struct {
+	RunId        string
+	DeploymentId string
+	State        string
+	Priority     int
+	Failure      string
+	Created      string
+	Request      JobRequest
+	Deliveries   []WebhookDelivery
+}
+
+// JobStore persists the state of every job submitted to the job manager,
+// publishes its state transitions and notifies the job's webhooks when it
+// finishes or fails.
+type JobStore struct {
+	Store    blobstore.BlobStore
+	Notifier *WebhookNotifier
+	Events   *JobEvents
+
+	// deliveries tracks the webhook deliveries of each job.
+	deliveries map[string][]WebhookDelivery
+	mutex      sync.Mutex
+}
+
+func NewJobStore(config *viper.Viper) (*JobStore, error) {
+	store, err := blobstore.NewBlobStore("WorkloadProfilerJobs", config)
+	if err != nil {
+		return nil, errors.New("Unable to create jobs store: " + err.Error())
+	}
+
+	return &JobStore{
+		Store:      store,
+		Events:     NewJobEvents(),
+		deliveries: make(map[string][]WebhookDelivery),
+	}, nil
+}
+
+func (store *JobStore) newStoreJob(job Job, failure string) *storeJob {
+	summary := job.GetSummary()
+	return &storeJob{
+		RunId:        job.GetId(),
+		DeploymentId: summary.DeploymentId,
+		State:        job.GetState(),
+		Priority:     job.GetPriority(),
+		Failure:      failure,
+		Created:      summary.Create.Format(time.RFC3339),
+		Request:      job.GetJobRequest(),
+		Deliveries:   store.GetDeliveries(job.GetId()),
+	}
+}
+
+func (store *JobStore) StoreJob(job Job) {
+	if err := store.Store.Store(job.GetId(), store.newStoreJob(job, "")); err != nil {
+		glog.Warningf("Unable to store job %s: %s", job.GetId(), err.Error())
+	}
+}
+
+// SetState updates the job's state and stores the transition. The job's
+// webhooks are notified when it finishes.
+func (store *JobStore) SetState(job Job, state string) {
+	job.SetState(state)
+	store.StoreJob(job)
+	store.Events.PublishState(job.GetId(), state)
+	if state == JOB_FINISHED {
+		store.notify(job, "")
+	}
+}
+
+// SetFailed marks the job as failed, stores the failure message and notifies
+// the job's webhooks.
+func (store *JobStore) SetFailed(job Job, failure string) {
+	job.SetState(JOB_FAILED)
+	if err := store.Store.Store(job.GetId(), store.newStoreJob(job, failure)); err != nil {
+		glog.Warningf("Unable to store job %s: %s", job.GetId(), err.Error())
+	}
+	store.Events.PublishState(job.GetId(), JOB_FAILED)
+	store.notify(job, failure)
+}
+
+func (store *JobStore) notify(job Job, failure string) {
+	if store.Notifier != nil {
+		store.Notifier.Notify(job, failure)
+	}
+}
+
+// GetDeliveries returns the webhook deliveries of the job.
+func (store *JobStore) GetDeliveries(jobId string) []WebhookDelivery {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append([]WebhookDelivery{}, store.deliveries[jobId]...)
+}
+
+// recordDelivery adds the delivery to the job's history and stores it, along
+// with the failure message of failed jobs.
+func (store *JobStore) recordDelivery(job Job, failure string, delivery WebhookDelivery) {
+	store.mutex.Lock()
+	store.deliveries[job.GetId()] = append(store.deliveries[job.GetId()], delivery)
+	store.mutex.Unlock()
+
+	if err := store.Store.Store(job.GetId(), store.newStoreJob(job, failure)); err != nil {
+		glog.Warningf("Unable to store job %s: %s", job.GetId(), err.Error())
+	}
+}
+
+func (store *JobStore) loadJobs() ([]*storeJob, error) {
+	existingJobs, err := store.Store.LoadAll(func() interface{} {
+		return &storeJob{}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load profiler jobs: %s", err.Error())
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	storeJobs := []*storeJob{}
+	for _, existingJob := range existingJobs.([]interface{}) {
+		storeJob := existingJob.(*storeJob)
+		if len(storeJob.Deliveries) > 0 {
+			store.deliveries[storeJob.RunId] = storeJob.Deliveries
+		}
+		storeJobs = append(storeJobs, storeJob)
+	}
+
+	return storeJobs, nil
+}
+
+// StoredJob is a finished job restored from the job store. It's only kept
+// for the job history and cannot be run again.
+type StoredJob struct {
+	RunId        string
+	DeploymentId string
+	State        string
+	Priority     int
+	Failure      string
+	Created      time.Time
+	Request      JobRequest
+}
+
+// parseStoreTime parses a time stored in RFC3339 format, or in the RFC822 format
+// times were stored in before.
+func parseStoreTime(value string) (time.Time, error) {
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if oldTime, oldErr := time.Parse(time.RFC822, value); oldErr == nil {
+			return oldTime, nil
+		}
+	}
+
+	return parsedTime, err
+}
+
+func newStoredJob(storeJob *storeJob) *StoredJob {
+	job := &StoredJob{
+		RunId:        storeJob.RunId,
+		DeploymentId: storeJob.DeploymentId,
+		State:        storeJob.State,
+		Priority:     storeJob.Priority,
+		Failure:      storeJob.Failure,
+		Request:      storeJob.Request,
+	}
+
+	if createdTime, err := parseStoreTime(storeJob.Created); err == nil {
+		job.Created = createdTime
+	} else {
+		glog.Warningf("Unable to parse created time %s: %s", storeJob.Created, err.Error())
+	}
+
+	return job
+}
+
+func (job *StoredJob) GetId() string {
+	return job.RunId
+}
+
+func (job *StoredJob) GetApplicationConfig() *models.ApplicationConfig {
+	return &models.ApplicationConfig{
+		Name: job.Request.AppName,
+	}
+}
+
+func (job *StoredJob) GetJobDeploymentConfig() JobDeploymentConfig {
+	return JobDeploymentConfig{}
+}
+
+func (job *StoredJob) GetJobRequest() JobRequest {
+	return job.Request
+}
+
+func (job *StoredJob) GetLog() *log.FileLog {
+	return nil
+}
+
+func (job *StoredJob) Run(ctx context.Context, deploymentId string) error {
+	return errors.New("Stored job " + job.RunId + " cannot be run")
+}
+
+func (job *StoredJob) GetState() string {
+	return job.State
+}
+
+func (job *StoredJob) SetState(state string) {
+	job.State = state
+}
+
+func (job *StoredJob) GetPriority() int {
+	return job.Priority
+}
+
+func (job *StoredJob) SetPriority(priority int) {
+	job.Priority = priority
+}
+
+func (job *StoredJob) GetSummary() JobSummary {
+	return JobSummary{
+		DeploymentId: job.DeploymentId,
+		RunId:        job.RunId,
+		Status:       job.State,
+		Create:       job.Created,
+	}
+}
+
+func (job *StoredJob) SetFailed(error string) {
+	job.Failure = error
+}
+
+func (job *StoredJob) GetResults() <-chan *JobResults {
+	return nil
+}
+
+func (job *StoredJob) IsSkipUnreserveOnFailure() bool {
+	return job.Request.SkipUnreserveOnFailure
+}
+
+func (job *StoredJob) IsDirectJob() bool {
+	return false
+}
@@ -1,7 +1,9 @@
 package jobs
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"github.com/hyperpilotio/go-utils/log"
 	"github.com/hyperpilotio/workload-profiler/clients"
 	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
 	"github.com/spf13/viper"
 )
 
@@ -20,6 +23,11 @@ const (
 	JOB_RUNNING   = "RUNNING"
 	JOB_FINISHED  = "FINISHED"
 	JOB_FAILED    = "FAILED"
+	JOB_CANCELLED = "CANCELLED"
+
+	// forceDeleteJobTimeout is how long force deleting a cluster waits for
+	// the cancelled job that reserved it to unreserve it.
+	forceDeleteJobTimeout = 10 * time.Minute
 )
 
 type JobSummary struct {
@@ -27,6 +35,8 @@ type JobSummary struct {
 	RunId        string    `json:"runId"`
 	Status       string    `json:"status"`
 	Create       time.Time `json:"create"`
+	// Results summarizes the results of job types that report them.
+	Results interface{} `json:"results,omitempty"`
 }
 
 type JobResults struct {
@@ -39,9 +49,12 @@ type Job interface {
 	GetApplicationConfig() *models.ApplicationConfig
 	GetJobDeploymentConfig() JobDeploymentConfig
 	GetLog() *log.FileLog
-	Run(deploymentId string) error
+	GetJobRequest() JobRequest
+	Run(ctx context.Context, deploymentId string) error
 	GetState() string
 	SetState(state string)
+	GetPriority() int
+	SetPriority(priority int)
 	GetSummary() JobSummary
 	SetFailed(error string)
 	GetResults() <-chan *JobResults
@@ -66,8 +79,101 @@ func (jobs *FailedJobs) AddJob(job Job) {
 	jobs.Jobs = append(jobs.Jobs, job)
 }
 
+// RunningJobs tracks the cancel function of every job a worker has picked up,
+// so jobs can be cancelled while they are reserving a cluster or running.
+type RunningJobs struct {
+	Cancels map[string]context.CancelFunc
+	// Finished has a channel for each running job, closed when the job returns.
+	Finished map[string]chan struct{}
+	JobStore *JobStore
+	mutex    sync.Mutex
+}
+
+func NewRunningJobs(jobStore *JobStore) *RunningJobs {
+	return &RunningJobs{
+		Cancels:  make(map[string]context.CancelFunc),
+		Finished: make(map[string]chan struct{}),
+		JobStore: jobStore,
+	}
+}
+
+// Start registers a cancellable context for the job. It returns false if the
+// job has already been cancelled while it was waiting in the queue.
+func (jobs *RunningJobs) Start(job Job) (context.Context, bool) {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+
+	if job.GetState() == JOB_CANCELLED {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs.Cancels[job.GetId()] = cancel
+	jobs.Finished[job.GetId()] = make(chan struct{})
+	return ctx, true
+}
+
+func (jobs *RunningJobs) Finish(jobId string) {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+
+	if cancel, ok := jobs.Cancels[jobId]; ok {
+		cancel()
+		delete(jobs.Cancels, jobId)
+	}
+
+	if finished, ok := jobs.Finished[jobId]; ok {
+		close(finished)
+		delete(jobs.Finished, jobId)
+	}
+}
+
+// WaitFinished returns a channel that is closed once the running job returns,
+// after it has unreserved its cluster. It returns nil if the job isn't running.
+func (jobs *RunningJobs) WaitFinished(jobId string) <-chan struct{} {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+
+	if finished, ok := jobs.Finished[jobId]; ok {
+		return finished
+	}
+
+	return nil
+}
+
+// Cancel signals a running job to stop, or marks a queued job as cancelled
+// so workers skip it when it's dequeued.
+func (jobs *RunningJobs) Cancel(job Job) error {
+	jobs.mutex.Lock()
+	if cancel, ok := jobs.Cancels[job.GetId()]; ok {
+		cancel()
+		jobs.mutex.Unlock()
+		return nil
+	}
+
+	state := job.GetState()
+	if state != JOB_QUEUED {
+		jobs.mutex.Unlock()
+		return fmt.Errorf("Job %s is not cancellable in %s state", job.GetId(), state)
+	}
+
+	// The state is set under the lock so workers starting the job skip it,
+	// while storing and publishing it is left out of the lock.
+	job.SetState(JOB_CANCELLED)
+	jobs.mutex.Unlock()
+
+	jobs.JobStore.SetState(job, JOB_CANCELLED)
+	// Notify anyone waiting on the job results, e.g: sizing runs waiting on their single runs.
+	job.SetFailed("Job cancelled before it started")
+	return nil
+}
+
 type JobDeploymentConfig struct {
 	Nodes []deployer.ClusterNode
+	// Region is the region the job's cluster is deployed in. If it's empty the
+	// region of the deployment template or file is used, which is assumed to be
+	// the aws.region config, or us-east-1.
+	Region string
 }
 
 func (config JobDeploymentConfig) GetNodes() []deployer.ClusterNode {
@@ -80,8 +186,10 @@ func (config JobDeploymentConfig) GetNodes() []deployer.ClusterNode {
 
 type Worker struct {
 	Id               int
-	Jobs             <-chan Job
+	Scheduler        *JobScheduler
 	FailedJobs       *FailedJobs
+	RunningJobs      *RunningJobs
+	JobStore         *JobStore
 	RetryReservation bool
 	Config           *viper.Viper
 	Clusters         *Clusters
@@ -89,41 +197,60 @@ type Worker struct {
 
 func (worker *Worker) Run() {
 	go func() {
-		for job := range worker.Jobs {
-			var err error
+		for {
+			job := worker.Scheduler.Next()
+			ctx, ok := worker.RunningJobs.Start(job)
+			if !ok {
+				glog.V(1).Infof("Skipping cancelled job %s", job.GetId())
+				worker.Scheduler.Done(job, false)
+				continue
+			}
 
+			var err error
 			if job.IsDirectJob() {
-				err = worker.RunDirectJob(job)
+				err = worker.RunDirectJob(ctx, job)
 			} else {
-				err = worker.RunJob(job)
+				err = worker.RunJob(ctx, job)
 			}
+			// Direct jobs run in the background, their duration doesn't hold up workers.
+			worker.Scheduler.Done(job, !job.IsDirectJob() && err == nil)
 			if err != nil {
 				job.SetFailed(err.Error())
 				worker.FailedJobs.AddJob(job)
+				worker.JobStore.SetFailed(job, err.Error())
 			}
 		}
 	}()
 }
 
-func (Worker *Worker) RunDirectJob(job Job) error {
+func (worker *Worker) RunDirectJob(ctx context.Context, job Job) error {
 	// Run direct job in non-blocking mode so worker can continue to process
 	// other jobs.
 	go func() {
-		job.SetState(JOB_RESERVING)
+		defer worker.RunningJobs.Finish(job.GetId())
+		worker.JobStore.SetState(job, JOB_RESERVING)
 		log := job.GetLog()
 		defer log.LogFile.Close()
-		job.SetState(JOB_RUNNING)
-		if err := job.Run(""); err != nil {
+		worker.JobStore.SetState(job, JOB_RUNNING)
+		err := job.Run(ctx, "")
+		if ctx.Err() != nil {
+			log.Logger.Infof("Job %s cancelled", job.GetId())
+			worker.JobStore.SetState(job, JOB_CANCELLED)
+		} else if err != nil {
 			job.SetFailed(err.Error())
+			worker.FailedJobs.AddJob(job)
+			worker.JobStore.SetFailed(job, err.Error())
+		} else {
+			worker.JobStore.SetState(job, JOB_FINISHED)
 		}
-		job.SetState(JOB_FINISHED)
 	}()
 
 	return nil
 }
 
-func (worker *Worker) RunJob(job Job) error {
-	job.SetState(JOB_RESERVING)
+func (worker *Worker) RunJob(ctx context.Context, job Job) error {
+	defer worker.RunningJobs.Finish(job.GetId())
+	worker.JobStore.SetState(job, JOB_RESERVING)
 	log := job.GetLog()
 	defer log.LogFile.Close()
 
@@ -133,13 +260,39 @@ func (worker *Worker) RunJob(job Job) error {
 	backOff := time.Duration(60) * time.Second
 	maxBackOff := time.Duration(960) * time.Second
 	for {
-		result := <-worker.Clusters.ReserveDeployment(
+		capacityFreed := worker.Clusters.CapacityFreed()
+		reserveResult := worker.Clusters.ReserveDeployment(
 			worker.Config,
 			job.GetApplicationConfig(),
 			job.GetJobDeploymentConfig(),
 			runId,
+			job.GetJobRequest().UserId,
 			log.Logger)
-		if result.Err != "" {
+
+		var result ReserveResult
+		select {
+		case result = <-reserveResult:
+		case <-ctx.Done():
+			log.Logger.Infof("Job %s cancelled while reserving deployment", runId)
+			go worker.releaseDeployment(reserveResult, runId, log.Logger)
+			worker.JobStore.SetState(job, JOB_CANCELLED)
+			job.SetFailed("Job cancelled while reserving deployment")
+			return nil
+		}
+
+		if IsCapacityError(result.Err) {
+			// Wait until a cluster is removed or becomes available, instead of
+			// backing off, as the reservation can only succeed after that.
+			log.Logger.Infof("Waiting for cluster capacity to reserve deployment: %s", result.Err)
+			select {
+			case <-capacityFreed:
+			case <-ctx.Done():
+				log.Logger.Infof("Job %s cancelled while waiting for cluster capacity", runId)
+				worker.JobStore.SetState(job, JOB_CANCELLED)
+				job.SetFailed("Job cancelled while reserving deployment")
+				return nil
+			}
+		} else if result.Err != "" {
 			log.Logger.Warningf("Unable to reserve deployment for job: %s", result.Err)
 			if !worker.RetryReservation {
 				message := "Unable to reserve deployment: " + result.Err
@@ -149,7 +302,14 @@ func (worker *Worker) RunJob(job Job) error {
 
 			log.Logger.Warningf("Sleeping %s seconds to retry...", backOff)
 			// Try reserving again after sleep
-			time.Sleep(backOff)
+			select {
+			case <-time.After(backOff):
+			case <-ctx.Done():
+				log.Logger.Infof("Job %s cancelled while waiting to retry reservation", runId)
+				worker.JobStore.SetState(job, JOB_CANCELLED)
+				job.SetFailed("Job cancelled while reserving deployment")
+				return nil
+			}
 			backOff *= 2
 			if backOff > maxBackOff {
 				message := "Unable to reserve deployment after retries: " + result.Err
@@ -163,38 +323,73 @@ func (worker *Worker) RunJob(job Job) error {
 		}
 	}
 
-	job.SetState(JOB_RUNNING)
+	worker.JobStore.SetState(job, JOB_RUNNING)
 	log.Logger.Infof("Running %s job", job.GetId())
-	jobErr := job.Run(deploymentId)
-	if jobErr != nil {
+	jobErr := job.Run(ctx, deploymentId)
+	cancelled := ctx.Err() != nil
+	if cancelled {
+		log.Logger.Infof("Job %s cancelled", runId)
+		worker.JobStore.SetState(job, JOB_CANCELLED)
+		if jobErr == nil {
+			job.SetFailed("Job cancelled")
+		}
+	} else if jobErr != nil {
 		log.Logger.Errorf(
 			"Unable to run %s job: %s, skip unreserve on failure: %s",
 			runId,
 			jobErr,
 			strconv.FormatBool(job.IsSkipUnreserveOnFailure()))
 		job.SetFailed(jobErr.Error())
+		worker.Clusters.SetFailure(runId, jobErr.Error())
 	} else {
-		job.SetState(JOB_FINISHED)
+		worker.JobStore.SetState(job, JOB_FINISHED)
 	}
 
-	deleteCluster := jobErr == nil || !job.IsSkipUnreserveOnFailure()
+	deleteCluster := jobErr == nil || cancelled || !job.IsSkipUnreserveOnFailure()
 	unreserveResult := <-worker.Clusters.UnreserveDeployment(runId, deleteCluster, log.Logger)
 	if unreserveResult.Err != "" {
 		log.Logger.Errorf("Unable to unreserve %s deployment: %s", runId, unreserveResult.Err)
 	}
 
+	if cancelled {
+		return nil
+	}
+
 	return jobErr
 }
 
+// releaseDeployment waits for a reservation abandoned by a cancelled job to
+// complete, and unreserves the deployment if one was created.
+func (worker *Worker) releaseDeployment(
+	reserveResult <-chan ReserveResult,
+	runId string,
+	log *logging.Logger) {
+	result := <-reserveResult
+	if result.Err != "" {
+		return
+	}
+
+	glog.Infof("Unreserving deployment %s reserved by cancelled job %s", result.DeploymentId, runId)
+	unreserveResult := <-worker.Clusters.UnreserveDeployment(runId, true, log)
+	if unreserveResult.Err != "" {
+		glog.Warningf("Unable to unreserve %s deployment: %s", runId, unreserveResult.Err)
+	}
+}
+
 type JobManager struct {
-	Queue      chan Job
-	Jobs       map[string]Job
-	Workers    []*Worker
-	FailedJobs *FailedJobs
-	mutex      sync.Mutex
+	Scheduler   *JobScheduler
+	Jobs        map[string]Job
+	Workers     []*Worker
+	FailedJobs  *FailedJobs
+	RunningJobs *RunningJobs
+	JobStore    *JobStore
+	Clusters    *Clusters
+	mutex       sync.Mutex
 }
 
-func NewJobManager(config *viper.Viper) (*JobManager, error) {
+// NewJobManager creates the job manager and its workers, and restores the jobs
+// from the job store. Queued jobs are recreated with the loader and enqueued again.
+func NewJobManager(config *viper.Viper, loader JobLoader) (*JobManager, error) {
 	deployerClient, err := clients.NewDeployerClient(config)
 	if err != nil {
 		return nil, errors.New("Unable to create new deployer client: " + err.Error())
@@ -208,6 +403,7 @@ func NewJobManager(config *viper.Viper) (*JobManager, error) {
 	if err := clusters.ReloadClusterState(); err != nil {
 		return nil, errors.New("Unable to reload cluster state: " + err.Error())
 	}
+	clusters.RunIdleClusterCleaner()
 
 	workerCount := config.GetInt("workerCount")
 	if workerCount <= 0 {
@@ -215,9 +411,21 @@ func NewJobManager(config *viper.Viper) (*JobManager, error) {
 	}
 	glog.Infof("Initialized job queue with %d workers", workerCount)
 
+	jobStore, err := NewJobStore(config)
+	if err != nil {
+		return nil, errors.New("Unable to create job store: " + err.Error())
+	}
+
+	notifier, err := NewWebhookNotifier(config, jobStore)
+	if err != nil {
+		return nil, errors.New("Unable to create webhook notifier: " + err.Error())
+	}
+	jobStore.Notifier = notifier
+
 	failedJobs := NewFailedJobs()
+	runningJobs := NewRunningJobs(jobStore)
 
-	queue := make(chan Job, 100)
+	scheduler := NewJobScheduler(workerCount)
 	workers := []*Worker{}
 	for i := 1; i <= workerCount; i++ {
 		worker := &Worker{
@@ -226,25 +434,170 @@ func NewJobManager(config *viper.Viper) (*JobManager, error) {
 			Clusters:         clusters,
 			RetryReservation: config.GetBool("retryReservation"),
 			FailedJobs:       failedJobs,
-			Jobs:             queue,
+			RunningJobs:      runningJobs,
+			JobStore:         jobStore,
+			Scheduler:        scheduler,
 		}
 		worker.Run()
 		workers = append(workers, worker)
 	}
 
-	return &JobManager{
-		Queue:      queue,
-		Jobs:       make(map[string]Job),
-		FailedJobs: failedJobs,
-		Workers:    workers,
-	}, nil
+	manager := &JobManager{
+		Scheduler:   scheduler,
+		Jobs:        make(map[string]Job),
+		FailedJobs:  failedJobs,
+		RunningJobs: runningJobs,
+		JobStore:    jobStore,
+		Clusters:    clusters,
+		Workers:     workers,
+	}
+
+	if err := manager.ReloadJobState(loader, config.GetBool("resumeInterruptedJobs")); err != nil {
+		return nil, errors.New("Unable to reload job state: " + err.Error())
+	}
+
+	return manager, nil
+}
+
+// ReloadJobState restores the jobs from the job store. Queued jobs are enqueued
+// again, and jobs that were interrupted while reserving or running are either
+// enqueued again when resumeInterrupted is set, or marked as failed. Unfinished
+// pipeline stages are marked as failed, as their pipeline reruns them when it's resumed.
+// Finished jobs are kept for the job history.
+func (manager *JobManager) ReloadJobState(loader JobLoader, resumeInterrupted bool) error {
+	storeJobs, err := manager.JobStore.loadJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, storeJob := range storeJobs {
+		switch storeJob.State {
+		case JOB_QUEUED, JOB_RESERVING, JOB_RUNNING:
+			if pipelineId := storeJob.Request.PipelineId; pipelineId != "" {
+				manager.restoreFailedJob(storeJob, ErrJobInterrupted+" as a stage of pipeline "+pipelineId)
+				continue
+			}
+
+			if storeJob.State != JOB_QUEUED && !resumeInterrupted {
+				manager.restoreFailedJob(storeJob, ErrJobInterrupted)
+				continue
+			}
+
+			job, err := loader(manager, storeJob.RunId, storeJob.Request)
+			if err != nil {
+				manager.restoreFailedJob(storeJob, "Unable to restore job: "+err.Error())
+				continue
+			}
+
+			glog.Infof("Enqueuing restored %s job %s", storeJob.State, storeJob.RunId)
+			job.SetPriority(storeJob.Priority)
+			manager.AddJob(job)
+		case JOB_FAILED:
+			job := newStoredJob(storeJob)
+			manager.addStoredJob(job)
+			manager.FailedJobs.AddJob(job)
+		default:
+			manager.addStoredJob(newStoredJob(storeJob))
+		}
+	}
+
+	return nil
+}
+
+func (manager *JobManager) restoreFailedJob(storeJob *storeJob, failure string) {
+	glog.Warningf("Marking restored job %s as failed: %s", storeJob.RunId, failure)
+	job := newStoredJob(storeJob)
+	manager.addStoredJob(job)
+	manager.FailedJobs.AddJob(job)
+	manager.JobStore.SetFailed(job, failure)
+}
+
+func (manager *JobManager) addStoredJob(job *StoredJob) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.Jobs[job.GetId()] = job
 }
 
 func (manager *JobManager) AddJob(job Job) {
 	manager.mutex.Lock()
 	defer manager.mutex.Unlock()
+	if reporter, ok := job.(ProgressReporter); ok {
+		reporter.SetJobEvents(manager.JobStore.Events)
+	}
 	manager.Jobs[job.GetId()] = job
-	manager.Queue <- job
+	manager.JobStore.SetState(job, JOB_QUEUED)
+	manager.Scheduler.Enqueue(job)
+}
+
+// SetJobPriority changes the priority of a queued job, and stores it so the
+// priority is kept if the profiler restarts.
+func (manager *JobManager) SetJobPriority(id string, priority int) error {
+	job, err := manager.FindJob(id)
+	if err != nil {
+		return err
+	}
+
+	if state := job.GetState(); state != JOB_QUEUED {
+		return fmt.Errorf("Unable to change priority of job %s in %s state", id, state)
+	}
+
+	if err := manager.Scheduler.SetPriority(id, priority); err != nil {
+		return err
+	}
+
+	manager.JobStore.StoreJob(job)
+	return nil
+}
+
+// CancelJob removes a queued job from being run, or stops a job that is
+// reserving a cluster or running. The cluster reserved by a running job is
+// unreserved once the job returns.
+func (manager *JobManager) CancelJob(id string) error {
+	job, err := manager.FindJob(id)
+	if err != nil {
+		return err
+	}
+
+	if err := manager.RunningJobs.Cancel(job); err != nil {
+		return err
+	}
+
+	manager.Scheduler.Remove(id)
+	return nil
+}
+
+// ForceDeleteCluster cancels the job that reserved the cluster if it's still
+// running, waits for the job to unreserve the cluster, and force deletes the
+// cluster if it's still tracked afterwards.
+func (manager *JobManager) ForceDeleteCluster(deploymentId string) error {
+	runId, err := manager.Clusters.findClusterRunId(deploymentId)
+	if err != nil {
+		return err
+	}
+
+	if job, err := manager.FindJob(runId); err == nil && !IsFinalState(job.GetState()) {
+		finished := manager.RunningJobs.WaitFinished(runId)
+		glog.Infof("Cancelling job %s reserving cluster %s", runId, deploymentId)
+		if err := manager.CancelJob(runId); err != nil {
+			return fmt.Errorf("Unable to cancel job %s reserving cluster %s: %s", runId, deploymentId, err.Error())
+		}
+
+		if finished != nil {
+			select {
+			case <-finished:
+			case <-time.After(forceDeleteJobTimeout):
+				glog.Warningf("Job %s didn't stop after %s, force deleting cluster %s",
+					runId, forceDeleteJobTimeout, deploymentId)
+			}
+
+			if _, err := manager.Clusters.findClusterRunId(deploymentId); err != nil {
+				glog.Infof("Cluster %s was deleted by cancelled job %s", deploymentId, runId)
+				return nil
+			}
+		}
+	}
+
+	return manager.Clusters.ForceDeleteCluster(deploymentId)
 }
 
 func (manager *JobManager) FindJob(id string) (Job, error) {
@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPriority = 0
+
+	// defaultJobDuration is used to estimate start times before any job
+	// of the same type has finished.
+	defaultJobDuration = 30 * time.Minute
+)
+
+// QueuedJob describes a job waiting in the scheduler.
+type QueuedJob struct {
+	RunId          string    `json:"runId"`
+	AppName        string    `json:"appName"`
+	Type           string    `json:"type"`
+	Priority       int       `json:"priority"`
+	Position       int       `json:"position"`
+	Queued         time.Time `json:"queued"`
+	EstimatedStart time.Time `json:"estimatedStart"`
+}
+
+type scheduledJob struct {
+	job    Job
+	seq    int64
+	queued time.Time
+}
+
+func (scheduledJob *scheduledJob) group() string {
+	return scheduledJob.job.GetApplicationConfig().Name + "/" + scheduledJob.job.GetJobRequest().Type
+}
+
+type runningJob struct {
+	jobType string
+	started time.Time
+}
+
+// JobScheduler replaces the FIFO job queue. Workers always take a job with the
+// highest priority, and jobs with the same priority are taken round-robin across
+// applications and job types, so a burst of jobs for one app doesn't starve others.
+// Jobs with the same app and type are taken in submission order.
+type JobScheduler struct {
+	Workers int
+
+	jobs   []*scheduledJob
+	seq    int64
+	served int64
+	// lastServed tracks when a job group was last taken by a worker.
+	lastServed map[string]int64
+	running    map[string]runningJob
+	// durations tracks the average run duration of each job type.
+	durations map[string]time.Duration
+	finished  map[string]int64
+	mutex     sync.Mutex
+	cond      *sync.Cond
+}
+
+func NewJobScheduler(workers int) *JobScheduler {
+	scheduler := &JobScheduler{
+		Workers:    workers,
+		jobs:       []*scheduledJob{},
+		lastServed: make(map[string]int64),
+		running:    make(map[string]runningJob),
+		durations:  make(map[string]time.Duration),
+		finished:   make(map[string]int64),
+	}
+	scheduler.cond = sync.NewCond(&scheduler.mutex)
+	return scheduler
+}
+
+func (scheduler *JobScheduler) Enqueue(job Job) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	scheduler.seq++
+	scheduler.jobs = append(scheduler.jobs, &scheduledJob{
+		job:    job,
+		seq:    scheduler.seq,
+		queued: time.Now(),
+	})
+	scheduler.cond.Signal()
+}
+
+// Next blocks until a job is queued, and returns the next job to run.
+func (scheduler *JobScheduler) Next() Job {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	for len(scheduler.jobs) == 0 {
+		scheduler.cond.Wait()
+	}
+
+	index := nextJobIndex(scheduler.jobs, scheduler.lastServed)
+	next := scheduler.jobs[index]
+	scheduler.jobs = append(scheduler.jobs[:index], scheduler.jobs[index+1:]...)
+
+	scheduler.served++
+	scheduler.lastServed[next.group()] = scheduler.served
+	scheduler.running[next.job.GetId()] = runningJob{
+		jobType: next.job.GetJobRequest().Type,
+		started: time.Now(),
+	}
+
+	return next.job
+}
+
+// Done marks a job taken from the scheduler as finished. The run duration is
+// recorded to estimate start times of queued jobs of the same type.
+func (scheduler *JobScheduler) Done(job Job, recordDuration bool) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	running, ok := scheduler.running[job.GetId()]
+	if !ok {
+		return
+	}
+	delete(scheduler.running, job.GetId())
+
+	if recordDuration {
+		count := scheduler.finished[running.jobType]
+		average := scheduler.durations[running.jobType]
+		duration := time.Since(running.started)
+		scheduler.durations[running.jobType] =
+			time.Duration((int64(average)*count + int64(duration)) / (count + 1))
+		scheduler.finished[running.jobType] = count + 1
+	}
+}
+
+// Remove takes a queued job out of the scheduler, e.g: when it's cancelled.
+func (scheduler *JobScheduler) Remove(id string) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	for i, scheduledJob := range scheduler.jobs {
+		if scheduledJob.job.GetId() == id {
+			scheduler.jobs = append(scheduler.jobs[:i], scheduler.jobs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (scheduler *JobScheduler) SetPriority(id string, priority int) error {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	for _, scheduledJob := range scheduler.jobs {
+		if scheduledJob.job.GetId() == id {
+			scheduledJob.job.SetPriority(priority)
+			return nil
+		}
+	}
+
+	return errors.New("Unable to find queued job: " + id)
+}
+
+// GetQueuedJobs returns the queued jobs in the order they will be run, with
+// their start times estimated from the average duration of each job type.
+func (scheduler *JobScheduler) GetQueuedJobs() []QueuedJob {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	now := time.Now()
+	workers := scheduler.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// Estimate when each worker will be free to take the next job.
+	workerAvailable := []time.Time{}
+	for _, running := range scheduler.running {
+		available := running.started.Add(scheduler.averageDuration(running.jobType))
+		if available.Before(now) {
+			available = now
+		}
+		workerAvailable = append(workerAvailable, available)
+	}
+	for len(workerAvailable) < workers {
+		workerAvailable = append(workerAvailable, now)
+	}
+	sortTimes(workerAvailable)
+	workerAvailable = workerAvailable[:workers]
+
+	jobs := make([]*scheduledJob, len(scheduler.jobs))
+	copy(jobs, scheduler.jobs)
+	lastServed := make(map[string]int64)
+	for group, served := range scheduler.lastServed {
+		lastServed[group] = served
+	}
+	served := scheduler.served
+
+	queuedJobs := []QueuedJob{}
+	for len(jobs) > 0 {
+		index := nextJobIndex(jobs, lastServed)
+		next := jobs[index]
+		jobs = append(jobs[:index], jobs[index+1:]...)
+		served++
+		lastServed[next.group()] = served
+
+		jobType := next.job.GetJobRequest().Type
+		queuedJobs = append(queuedJobs, QueuedJob{
+			RunId:          next.job.GetId(),
+			AppName:        next.job.GetApplicationConfig().Name,
+			Type:           jobType,
+			Priority:       next.job.GetPriority(),
+			Position:       len(queuedJobs) + 1,
+			Queued:         next.queued,
+			EstimatedStart: workerAvailable[0],
+		})
+
+		// Direct jobs run in the background and don't hold up a worker.
+		if !next.job.IsDirectJob() {
+			workerAvailable[0] = workerAvailable[0].Add(scheduler.averageDuration(jobType))
+			sortTimes(workerAvailable)
+		}
+	}
+
+	return queuedJobs
+}
+
+func (scheduler *JobScheduler) averageDuration(jobType string) time.Duration {
+	if duration, ok := scheduler.durations[jobType]; ok {
+		return duration
+	}
+
+	return defaultJobDuration
+}
+
+// nextJobIndex returns the index of the job to run next: the highest priority
+// job of the group that was served least recently.
+func nextJobIndex(jobs []*scheduledJob, lastServed map[string]int64) int {
+	selected := -1
+	for i, scheduledJob := range jobs {
+		if selected == -1 {
+			selected = i
+			continue
+		}
+
+		current := jobs[selected]
+		priority := scheduledJob.job.GetPriority()
+		currentPriority := current.job.GetPriority()
+		if priority != currentPriority {
+			if priority > currentPriority {
+				selected = i
+			}
+			continue
+		}
+
+		served := lastServed[scheduledJob.group()]
+		currentServed := lastServed[current.group()]
+		if served != currentServed {
+			if served < currentServed {
+				selected = i
+			}
+			continue
+		}
+
+		if scheduledJob.seq < current.seq {
+			selected = i
+		}
+	}
+
+	return selected
+}
+
+type byTime []time.Time
+
+func (t byTime) Len() int           { return len(t) }
+func (t byTime) Less(i, j int) bool { return t[i].Before(t[j]) }
+func (t byTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+func sortTimes(times []time.Time) {
+	sort.Sort(byTime(times))
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+// directJob is a stored job run in the background, like direct sizing runs.
+type directJob struct {
+	*StoredJob
+}
+
+func (job directJob) IsDirectJob() bool {
+	return true
+}
+
+func TestJobSchedulerOrder(t *testing.T) {
+	scheduler := NewJobScheduler(1)
+	scheduler.Enqueue(&StoredJob{RunId: "redis-1", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "redis-2", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "redis-3", Request: JobRequest{AppName: "redis", Type: "calibration"}})
+	scheduler.Enqueue(&StoredJob{RunId: "mongo-1", Request: JobRequest{AppName: "mongo", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "mongo-2", Request: JobRequest{AppName: "mongo", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "urgent", Priority: 5, Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+
+	// The urgent job goes first, then the others take turns by app and job
+	// type, in submission order within the same app and job type.
+	expected := []string{"urgent", "redis-3", "mongo-1", "redis-1", "mongo-2", "redis-2"}
+	queuedJobs := scheduler.GetQueuedJobs()
+	if len(queuedJobs) != len(expected) {
+		t.Fatalf("Expected %d queued jobs, got %d", len(expected), len(queuedJobs))
+	}
+	for i, queuedJob := range queuedJobs {
+		if queuedJob.RunId != expected[i] || queuedJob.Position != i+1 {
+			t.Errorf("Expected job %s at position %d, got %s at %d", expected[i], i+1, queuedJob.RunId, queuedJob.Position)
+		}
+	}
+
+	for _, runId := range expected {
+		if job := scheduler.Next(); job.GetId() != runId {
+			t.Errorf("Expected next job %s, got %s", runId, job.GetId())
+		}
+	}
+}
+
+func TestJobSchedulerRemove(t *testing.T) {
+	scheduler := NewJobScheduler(1)
+	scheduler.Enqueue(&StoredJob{RunId: "a", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "b", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+
+	if !scheduler.Remove("a") {
+		t.Error("Expected queued job a to be removed")
+	}
+	if scheduler.Remove("a") || scheduler.Remove("unknown") {
+		t.Error("Expected only queued jobs to be removed")
+	}
+
+	if queuedJobs := scheduler.GetQueuedJobs(); len(queuedJobs) != 1 || queuedJobs[0].RunId != "b" {
+		t.Errorf("Expected only job b to be queued, got %+v", queuedJobs)
+	}
+	if job := scheduler.Next(); job.GetId() != "b" {
+		t.Errorf("Expected next job b, got %s", job.GetId())
+	}
+}
+
+func TestJobSchedulerSetPriority(t *testing.T) {
+	scheduler := NewJobScheduler(1)
+	scheduler.Enqueue(&StoredJob{RunId: "a", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "b", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+
+	if err := scheduler.SetPriority("b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.SetPriority("unknown", 1); err == nil {
+		t.Error("Expected unknown job priority not to be set")
+	}
+
+	job := scheduler.Next()
+	if job.GetId() != "b" || job.GetPriority() != 1 {
+		t.Errorf("Expected job b with priority 1 first, got %s with priority %d", job.GetId(), job.GetPriority())
+	}
+	if err := scheduler.SetPriority("b", 2); err == nil {
+		t.Error("Expected running job priority not to be set")
+	}
+}
+
+func TestJobSchedulerEstimatedStart(t *testing.T) {
+	scheduler := NewJobScheduler(2)
+	scheduler.durations["benchmark"] = 10 * time.Minute
+
+	// A calibration job without recorded durations takes one of the workers.
+	scheduler.Enqueue(&StoredJob{RunId: "running", Request: JobRequest{AppName: "mongo", Type: "calibration"}})
+	scheduler.Next()
+
+	scheduler.Enqueue(&StoredJob{RunId: "benchmark-1", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(&StoredJob{RunId: "benchmark-2", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+	scheduler.Enqueue(directJob{&StoredJob{RunId: "sizing", Request: JobRequest{AppName: "redis", Type: "sizing"}}})
+	scheduler.Enqueue(&StoredJob{RunId: "benchmark-3", Request: JobRequest{AppName: "redis", Type: "benchmark"}})
+
+	now := time.Now()
+	expected := map[string]time.Duration{
+		"benchmark-1": 0,
+		// The direct job starts once the free worker is done, without holding it up.
+		"sizing":      10 * time.Minute,
+		"benchmark-2": 10 * time.Minute,
+		"benchmark-3": 20 * time.Minute,
+	}
+	for _, queuedJob := range scheduler.GetQueuedJobs() {
+		start := queuedJob.EstimatedStart.Sub(now)
+		if start < expected[queuedJob.RunId]-time.Second || start > expected[queuedJob.RunId]+time.Second {
+			t.Errorf("Expected job %s to start in %s, got %s", queuedJob.RunId, expected[queuedJob.RunId], start)
+		}
+	}
+
+	scheduler.Done(scheduler.Next(), true)
+	if count := scheduler.finished["benchmark"]; count != 1 {
+		t.Errorf("Expected 1 finished benchmark job, got %d", count)
+	}
+	if duration := scheduler.durations["benchmark"]; duration >= 10*time.Minute {
+		t.Errorf("Expected benchmark duration to be averaged with the finished job, got %s", duration)
+	}
+}
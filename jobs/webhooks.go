@@ -0,0 +1,242 @@
+package jobs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty"
+	"github.com/golang/glog"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+const (
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the payload,
+	// signed with the webhook's secret.
+	WebhookSignatureHeader = "X-Profiler-Signature"
+	WebhookEventHeader     = "X-Profiler-Event"
+)
+
+// WebhookPayload is posted to the webhooks of a job when it finishes or fails.
+// The duration is measured from when the job was submitted.
+type WebhookPayload struct {
+	RunId    string      `json:"runId"`
+	AppName  string      `json:"appName"`
+	Type     string      `json:"type"`
+	State    string      `json:"state"`
+	Created  time.Time   `json:"created"`
+	Finished time.Time   `json:"finished"`
+	Duration string      `json:"duration"`
+	Failure  string      `json:"failure,omitempty"`
+	Results  interface{} `json:"results,omitempty"`
+}
+
+// WebhookDelivery records an attempt to post a job's payload to a webhook.
+type WebhookDelivery struct {
+	Url        string    `json:"url"`
+	State      string    `json:"state"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Time       time.Time `json:"time"`
+}
+
+// WebhookNotifier posts the payloads of finished and failed jobs to the
+// webhooks configured globally, in the job's application config and in the
+// job's callback url. Failed deliveries are retried with exponential backoff.
+type WebhookNotifier struct {
+	Webhooks []models.WebhookConfig
+	// Secret signs the payloads posted to callback urls.
+	Secret         string
+	MaxAttempts    int
+	InitialBackOff time.Duration
+	MaxBackOff     time.Duration
+	JobStore       *JobStore
+}
+
+// NewWebhookNotifier reads the webhooks config, which defaults to 5 attempts
+// per delivery with backoff from 10s up to 5m.
+func NewWebhookNotifier(config *viper.Viper, jobStore *JobStore) (*WebhookNotifier, error) {
+	webhooks := []models.WebhookConfig{}
+	if err := config.UnmarshalKey("webhooks.hooks", &webhooks); err != nil {
+		return nil, errors.New("Unable to parse webhooks config: " + err.Error())
+	}
+
+	notifier := &WebhookNotifier{
+		Webhooks:       webhooks,
+		Secret:         config.GetString("webhooks.secret"),
+		MaxAttempts:    config.GetInt("webhooks.maxAttempts"),
+		InitialBackOff: 10 * time.Second,
+		MaxBackOff:     5 * time.Minute,
+		JobStore:       jobStore,
+	}
+	if notifier.MaxAttempts <= 0 {
+		notifier.MaxAttempts = 5
+	}
+
+	if backOff := config.GetString("webhooks.initialBackOff"); backOff != "" {
+		duration, err := time.ParseDuration(backOff)
+		if err != nil {
+			return nil, errors.New("Unable to parse webhooks initialBackOff: " + err.Error())
+		}
+		notifier.InitialBackOff = duration
+	}
+
+	if backOff := config.GetString("webhooks.maxBackOff"); backOff != "" {
+		duration, err := time.ParseDuration(backOff)
+		if err != nil {
+			return nil, errors.New("Unable to parse webhooks maxBackOff: " + err.Error())
+		}
+		notifier.MaxBackOff = duration
+	}
+
+	return notifier, nil
+}
+
+// getWebhooks returns the webhooks notified of the job. Jobs restored from
+// the job store only keep their callback url and the global webhooks, as
+// their application config isn't restored.
+func (notifier *WebhookNotifier) getWebhooks(job Job) []models.WebhookConfig {
+	request := job.GetJobRequest()
+	candidates := []models.WebhookConfig{}
+	if request.CallbackUrl != "" {
+		candidates = append(candidates, models.WebhookConfig{
+			Url:    request.CallbackUrl,
+			Secret: notifier.Secret,
+		})
+	}
+	if applicationConfig := job.GetApplicationConfig(); applicationConfig != nil {
+		candidates = append(candidates, applicationConfig.Webhooks...)
+	}
+	candidates = append(candidates, notifier.Webhooks...)
+
+	webhooks := []models.WebhookConfig{}
+	for _, webhook := range candidates {
+		if webhook.Url == "" || !matchesJobType(webhook, request.Type) {
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks
+}
+
+func matchesJobType(webhook models.WebhookConfig, jobType string) bool {
+	if len(webhook.JobTypes) == 0 {
+		return true
+	}
+
+	for _, webhookJobType := range webhook.JobTypes {
+		if webhookJobType == jobType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Notify posts the job's payload to each of its webhooks in the background.
+func (notifier *WebhookNotifier) Notify(job Job, failure string) {
+	webhooks := notifier.getWebhooks(job)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	summary := job.GetSummary()
+	finished := time.Now()
+	payload := WebhookPayload{
+		RunId:    job.GetId(),
+		AppName:  job.GetApplicationConfig().Name,
+		Type:     job.GetJobRequest().Type,
+		State:    job.GetState(),
+		Created:  summary.Create,
+		Finished: finished,
+		Duration: finished.Sub(summary.Create).String(),
+		Failure:  failure,
+		Results:  summary.Results,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		glog.Warningf("Unable to marshal webhook payload of job %s: %s", job.GetId(), err.Error())
+		return
+	}
+
+	for _, webhook := range webhooks {
+		go notifier.deliver(job, failure, webhook, body)
+	}
+}
+
+// deliver posts the body to the webhook until it's accepted or the attempts
+// run out, and records every attempt in the job store.
+func (notifier *WebhookNotifier) deliver(job Job, failure string, webhook models.WebhookConfig, body []byte) {
+	state := job.GetState()
+	backOff := notifier.InitialBackOff
+	for attempt := 1; attempt <= notifier.MaxAttempts; attempt++ {
+		delivery := WebhookDelivery{
+			Url:     webhook.Url,
+			State:   state,
+			Attempt: attempt,
+			Time:    time.Now(),
+		}
+
+		statusCode, err := postWebhook(webhook, state, body)
+		delivery.StatusCode = statusCode
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Delivered = true
+		}
+		notifier.JobStore.recordDelivery(job, failure, delivery)
+
+		if delivery.Delivered {
+			return
+		}
+
+		glog.Warningf("Unable to deliver webhook %s of job %s (attempt %d/%d): %s",
+			webhook.Url, job.GetId(), attempt, notifier.MaxAttempts, delivery.Error)
+		if attempt < notifier.MaxAttempts {
+			time.Sleep(backOff)
+			backOff *= 2
+			if backOff > notifier.MaxBackOff {
+				backOff = notifier.MaxBackOff
+			}
+		}
+	}
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of the body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(webhook models.WebhookConfig, state string, body []byte) (int, error) {
+	request := resty.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(WebhookEventHeader, "job."+strings.ToLower(state)).
+		SetBody(body)
+	if webhook.Secret != "" {
+		request.SetHeader(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.Secret, body))
+	}
+
+	response, err := request.Post(webhook.Url)
+	if err != nil {
+		return 0, errors.New("Unable to post webhook: " + err.Error())
+	}
+
+	if response.StatusCode() < 200 || response.StatusCode() >= 300 {
+		return response.StatusCode(), fmt.Errorf("Unexpected response code: %d, body: %s",
+			response.StatusCode(), response.String())
+	}
+
+	return response.StatusCode(), nil
+}
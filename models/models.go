@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	benchmarkagent "github.com/hyperpilotio/container-benchmarks/benchmark-agent/apis"
 	deployer "github.com/hyperpilotio/deployer/apis"
 )
@@ -63,11 +65,24 @@ type SlowCookerController struct {
 	LoadTime  string               `bson:"loadTime" json:"loadTime"`
 }
 
+// LocalLoadController generates the app load from the profiler itself against
+// the app load url, instead of from a deployed load tester.
+type LocalLoadController struct {
+	AppLoad   *SlowCookerAppLoad   `bson:"appLoad" json:"appLoad"`
+	Calibrate *SlowCookerCalibrate `bson:"calibrate" json:"calibrate"`
+	LoadTime  string               `bson:"loadTime" json:"loadTime"`
+}
+
+// LocustController steps the number of locust users from StartCount to EndCount
+// by StepCount, running each step for StepDuration.
 type LocustController struct {
 	StartCount   int    `bson:"startCount" json:"startCount"`
 	EndCount     int    `bson:"endCount" json:"endCount"`
 	StepCount    int    `bson:"stepCount" json:"stepCount"`
 	StepDuration string `bson:"stepDuration" json:"stepDuration"`
+	// HatchRate is the number of users spawned per second, all users are
+	// spawned at once if it's not set.
+	HatchRate int `bson:"hatchRate" json:"hatchRate"`
 }
 
 type SLO struct {
@@ -76,6 +91,20 @@ type SLO struct {
 	Type   string  `bson:"type" json:"type"`
 }
 
+// Throughput SLOs are met by QoS values above the SLO value, while other SLO
+// types (e.g: latency) are met by QoS values below it.
+const ThroughputSLOType = "throughput"
+
+// IsMetWithTolerance returns if the QoS value meets the SLO, allowing the QoS
+// to degrade by the tolerance ratio of the SLO value.
+func (slo SLO) IsMetWithTolerance(qosValue float64, tolerance float64) bool {
+	if slo.Type == ThroughputSLOType {
+		return qosValue >= slo.Value*(1-tolerance)
+	}
+
+	return qosValue <= slo.Value*(1+tolerance)
+}
+
 type ApplicationTask struct {
 	NodeMapping    interface{} `bson:"nodeMapping" json:"nodeMapping"`
 	TaskDefinition interface{} `bson:"taskDefinition" json:"taskDefinition"`
@@ -105,15 +134,36 @@ type Benchmark struct {
 	Configs      []BenchmarkConfig `bson:"configs" json:"configs"`
 }
 
+// MetricsSourceConfig selects where capture metrics runs read the app's
+// metrics from, which is either influx (the default) or prometheus. The source
+// is reached through its deployed service, unless its url is set.
+type MetricsSourceConfig struct {
+	Type    string `bson:"type" json:"type"`
+	Service string `bson:"service" json:"service"`
+	Port    int    `bson:"port" json:"port"`
+	Url     string `bson:"url" json:"url"`
+}
+
+// WebhookConfig is an url notified when jobs finish or fail. Payloads are
+// signed with the secret if it's set, and JobTypes limits the notifications to
+// jobs of those types.
+type WebhookConfig struct {
+	Url      string   `bson:"url" json:"url" mapstructure:"url"`
+	Secret   string   `bson:"secret" json:"secret" mapstructure:"secret"`
+	JobTypes []string `bson:"jobTypes" json:"jobTypes" mapstructure:"jobTypes"`
+}
+
 type ApplicationConfig struct {
-	Name               string            `bson:"name" json:"name"`
-	DeploymentFile     string            `bson:"deploymentFile" json:"deploymentFile"`
-	DeploymentTemplate string            `bson:"deploymentTemplate" json:"deploymentTemplate"`
-	TaskDefinitions    []ApplicationTask `bson:"taskDefinitions" json:"taskDefinitions"`
-	ServiceNames       []string          `bson:"serviceNames" json:"serviceNames"`
-	LoadTester         LoadTester        `bson:"loadTester" json:"loadTester"`
-	Type               string            `bson:"type" json:"type"`
-	SLO                SLO               `bson:"slo" json:"slo"`
+	Name               string               `bson:"name" json:"name"`
+	DeploymentFile     string               `bson:"deploymentFile" json:"deploymentFile"`
+	DeploymentTemplate string               `bson:"deploymentTemplate" json:"deploymentTemplate"`
+	TaskDefinitions    []ApplicationTask    `bson:"taskDefinitions" json:"taskDefinitions"`
+	ServiceNames       []string             `bson:"serviceNames" json:"serviceNames"`
+	LoadTester         LoadTester           `bson:"loadTester" json:"loadTester"`
+	Type               string               `bson:"type" json:"type"`
+	SLO                SLO                  `bson:"slo" json:"slo"`
+	MetricsSource      *MetricsSourceConfig `bson:"metricsSource,omitempty" json:"metricsSource,omitempty"`
+	Webhooks           []WebhookConfig      `bson:"webhooks,omitempty" json:"webhooks,omitempty"`
 }
 
 type IntensityArgument struct {
@@ -138,6 +188,7 @@ type LoadTester struct {
 	LocustController     *LocustController     `bson:"locustController" json:"locustController"`
 	SlowCookerController *SlowCookerController `bson:"slowCookerController" json:"slowCookerController"`
 	DemoUiController     *DemoUiController     `bson:"demoUiController" json:"demoUiController"`
+	LocalLoadController  *LocalLoadController  `bson:"localLoadController" json:"localLoadController"`
 }
 
 type CalibrationTestResult struct {
@@ -154,6 +205,7 @@ type CalibrationResults struct {
 	TestDuration string                  `bson:"testDuration" json:"testDuration"`
 	TestResults  []CalibrationTestResult `bson:"testResult" json:"testResult"`
 	FinalResult  *CalibrationTestResult  `bson:"finalResult" json:"finalResult"`
+	Created      time.Time               `bson:"created" json:"created"`
 }
 
 type BenchmarkResult struct {
@@ -161,24 +213,78 @@ type BenchmarkResult struct {
 	Intensity int     `bson:"intensity" json:"intensity"`
 	QosValue  float64 `bson:"qosValue" json:"qosValue"`
 	Failures  uint64  `bson:"failures" json:"failures"`
+	Trial     int     `bson:"trial" json:"trial"`
+	// Outlier is set if the QoS value is an outlier among the trial results.
+	Outlier bool `bson:"outlier" json:"outlier"`
+}
+
+// QosStats summarizes the QoS values of repeated load test trials.
+type QosStats struct {
+	Trials   int     `bson:"trials" json:"trials"`
+	Samples  int     `bson:"samples" json:"samples"`
+	Outliers int     `bson:"outliers" json:"outliers"`
+	Mean     float64 `bson:"mean" json:"mean"`
+	Stddev   float64 `bson:"stddev" json:"stddev"`
+	P50      float64 `bson:"p50" json:"p50"`
+	// CV is the coefficient of variation, i.e: stddev / mean.
+	CV float64 `bson:"cv" json:"cv"`
+	// CILow and CIHigh bound the 95% confidence interval of the mean.
+	CILow  float64 `bson:"ciLow" json:"ciLow"`
+	CIHigh float64 `bson:"ciHigh" json:"ciHigh"`
+}
+
+// BenchmarkStats are the QoS stats of the app with a benchmark intensity.
+type BenchmarkStats struct {
+	Benchmark string   `bson:"benchmark" json:"benchmark"`
+	Intensity int      `bson:"intensity" json:"intensity"`
+	Stats     QosStats `bson:"stats" json:"stats"`
 }
 
 type BenchmarkRunResults struct {
-	TestId                string             `bson:"testId" json:"testId"`
-	AppName               string             `bson:"appName" json:"appName"`
-	NumServices           int                `bson:"numServices" json:"numServices"`
-	Services              []string           `bson:"services" json:"services"`
-	ServiceInTest         string             `bson:"serviceInTest" json:"serviceInTest"`
-	ServiceNode           string             `bson:"serviceNode" json:"serviceNode"`
-	LoadTester            string             `bson:"loadTester" json:"loadTester"`
-	AppCapacity           float64            `bson:"appCapacity" json:"appCapacity"`
-	SloMetric             string             `bson:"sloMetric" json:"sloMetric"`
-	SloTolerance          float64            `bson:"sloTolerance" json:"sloTolerance"`
-	TestDuration          string             `bson:"testDuration" json:"testDuration"`
-	Benchmarks            []string           `bson:"benchmarks" json:"benchmarks"`
-	TestResult            []*BenchmarkResult `bson:"testResult" json:"testResult"`
-	ToleratedInterference []struct {
-		Benchmark string `bson:"benchmark" json:"benchmark"`
-		Intensity int    `bson:"intensity" json:"intensity"`
-	} `bson:"toleratedInterference" json: "toleratedInterference"`
+	TestId                string                   `bson:"testId" json:"testId"`
+	AppName               string                   `bson:"appName" json:"appName"`
+	NumServices           int                      `bson:"numServices" json:"numServices"`
+	Services              []string                 `bson:"services" json:"services"`
+	ServiceInTest         string                   `bson:"serviceInTest" json:"serviceInTest"`
+	ServiceNode           string                   `bson:"serviceNode" json:"serviceNode"`
+	LoadTester            string                   `bson:"loadTester" json:"loadTester"`
+	AppCapacity           float64                  `bson:"appCapacity" json:"appCapacity"`
+	SloMetric             string                   `bson:"sloMetric" json:"sloMetric"`
+	SloTolerance          float64                  `bson:"sloTolerance" json:"sloTolerance"`
+	TestDuration          string                   `bson:"testDuration" json:"testDuration"`
+	Benchmarks            []string                 `bson:"benchmarks" json:"benchmarks"`
+	TestResult            []*BenchmarkResult       `bson:"testResult" json:"testResult"`
+	TestStats             []*BenchmarkStats        `bson:"testStats" json:"testStats"`
+	Created               time.Time                `bson:"created" json:"created"`
+	ToleratedInterference []*ToleratedInterference `bson:"toleratedInterference" json:"toleratedInterference"`
+}
+
+// MetricsArtifact is a snapshot of a metrics database stored in the artifact store.
+type MetricsArtifact struct {
+	Database string `bson:"database" json:"database"`
+	Format   string `bson:"format" json:"format"`
+	Location string `bson:"location" json:"location"`
+	Points   int    `bson:"points" json:"points"`
+}
+
+// MetricsSnapshot records the metrics captured by a capture metrics run within
+// its capture window.
+type MetricsSnapshot struct {
+	RunId       string            `bson:"runId" json:"runId"`
+	AppName     string            `bson:"appName" json:"appName"`
+	SnapshotId  string            `bson:"snapshotId" json:"snapshotId"`
+	ServiceName string            `bson:"serviceName" json:"serviceName"`
+	Scenario    string            `bson:"scenario" json:"scenario"`
+	Benchmark   string            `bson:"benchmark" json:"benchmark"`
+	StartTime   time.Time         `bson:"startTime" json:"startTime"`
+	EndTime     time.Time         `bson:"endTime" json:"endTime"`
+	Artifacts   []MetricsArtifact `bson:"artifacts" json:"artifacts"`
+	Created     time.Time         `bson:"created" json:"created"`
+}
+
+// ToleratedInterference is the highest intensity of a benchmark the app can run
+// along with while meeting its SLO within the run's SLO tolerance.
+type ToleratedInterference struct {
+	Benchmark string `bson:"benchmark" json:"benchmark"`
+	Intensity int    `bson:"intensity" json:"intensity"`
 }
@@ -0,0 +1,39 @@
+package models
+
+// PipelineStage declares a profiling stage of a pipeline, and the parameters
+// of the run it launches.
+type PipelineStage struct {
+	// Type is one of calibration, benchmark or awsSizing.
+	Type string `json:"type" binding:"required"`
+
+	// Benchmark stage parameters
+	StartingIntensity int     `json:"startingIntensity,omitempty"`
+	Step              int     `json:"step,omitempty"`
+	SloTolerance      float64 `json:"sloTolerance,omitempty"`
+	SearchMode        string  `json:"searchMode,omitempty"`
+	Precision         int     `json:"precision,omitempty"`
+
+	// AWS sizing stage parameters
+	AllInstances bool     `json:"allInstances,omitempty"`
+	Instances    []string `json:"instances,omitempty"`
+	// Region and AvailabilityZone default to the aws config, or to the
+	// location the profiler runs in.
+	Region           string `json:"region,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+}
+
+type PipelineStageStatus struct {
+	Stage PipelineStage `json:"stage"`
+	RunId string        `json:"runId"`
+	// InputRunId is the run id of the calibration consumed by this stage.
+	InputRunId string `json:"inputRunId"`
+	State      string `json:"state"`
+	Failure    string `json:"failure"`
+}
+
+type PipelineSummary struct {
+	PipelineId string                `json:"pipelineId"`
+	AppName    string                `json:"appName"`
+	State      string                `json:"state"`
+	Stages     []PipelineStageStatus `json:"stages"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type AWSCost struct {
 	LinuxOnDemand   float32 `bson:"linuxOnDemand" json:"linuxOnDemand", binding:"required"`
 	LinuxReserved   float32 `bson:"linuxReserved" json:"linuxReserved", binding:"required"`
@@ -45,33 +47,145 @@ type AWSNodeType struct {
 	StorageConfig  AWSStorageConfig `bson:"storageConfig" json:"storageConfig", binding:"required"`
 }
 
+// UsageStats summarizes the samples of a resource usage metric over time.
+type UsageStats struct {
+	Mean    float64 `bson:"mean" json:"mean"`
+	P95     float64 `bson:"p95" json:"p95"`
+	Max     float64 `bson:"max" json:"max"`
+	Samples int     `bson:"samples" json:"samples"`
+}
+
 type NetUsage struct {
-	BytesReceivedPerSec int `bson:"bytesReceivedPerSec" json:"bytesReceivedPerSec", binding:"required"`
-	BytesSentPerSec     int `bson:"bytesSentPerSec" json:"bytesSentPerSec", binding:"required"`
+	BytesReceivedPerSec UsageStats `bson:"bytesReceivedPerSec" json:"bytesReceivedPerSec", binding:"required"`
+	BytesSentPerSec     UsageStats `bson:"bytesSentPerSec" json:"bytesSentPerSec", binding:"required"`
 }
 
 type DiskUsage struct {
-	BytesReadPerSec  int `bson:"bytesReadPerSec" json:"bytesReadPerSec", binding:"required"`
-	BytesWritePerSec int `bson:"bytesWritePerSec" json:"bytesWritePerSec", binding:"required"`
-	OpsReadPerSec    int `bson:"OpsReadPerSec" json:"OpsReadPerSec", binding:"required"`
-	OpsWritePerSec   int `bson:"OpsWritePerSec" json:"OpsWritePerSec", binding:"required"`
+	BytesReadPerSec  UsageStats `bson:"bytesReadPerSec" json:"bytesReadPerSec", binding:"required"`
+	BytesWritePerSec UsageStats `bson:"bytesWritePerSec" json:"bytesWritePerSec", binding:"required"`
+	OpsReadPerSec    UsageStats `bson:"OpsReadPerSec" json:"OpsReadPerSec", binding:"required"`
+	OpsWritePerSec   UsageStats `bson:"OpsWritePerSec" json:"OpsWritePerSec", binding:"required"`
 }
 
+// ResourceUsage is the usage of all the pods of a service. CpuUtilization is
+// in percent of a core, and MemUsage in bytes.
 type ResourceUsage struct {
-	CpuUtilization float64   `bson:"cpuUtilization" json:"cpuUtilization", binding:"required"`
-	MemUsage       float64   `bson:"memUsage" json:"memUsage", binding:"required"`
-	NetUsage       NetUsage  `bson:"netUsage" json:"netUsage", binding:"required"`
-	DiskUsage      DiskUsage `bson:"diskUsage" json:"diskUsage", binding:"required"`
+	CpuUtilization UsageStats `bson:"cpuUtilization" json:"cpuUtilization", binding:"required"`
+	MemUsage       UsageStats `bson:"memUsage" json:"memUsage", binding:"required"`
+	NetUsage       NetUsage   `bson:"netUsage" json:"netUsage", binding:"required"`
+	DiskUsage      DiskUsage  `bson:"diskUsage" json:"diskUsage", binding:"required"`
+}
+
+// ResourceUsageResults is the resource usage of a service during a capture
+// metrics run of a load test scenario and benchmark.
+type ResourceUsageResults struct {
+	RunId       string        `bson:"runId" json:"runId"`
+	AppName     string        `bson:"appName" json:"appName"`
+	Scenario    string        `bson:"scenario" json:"scenario"`
+	Benchmark   string        `bson:"benchmark" json:"benchmark"`
+	ServiceName string        `bson:"serviceName" json:"serviceName"`
+	StartTime   time.Time     `bson:"startTime" json:"startTime"`
+	EndTime     time.Time     `bson:"endTime" json:"endTime"`
+	Usage       ResourceUsage `bson:"usage" json:"usage"`
+	Created     time.Time     `bson:"created" json:"created"`
 }
 
 type SizingResults struct {
-	RunId     string `bson:"runID" json:"runId", binding:"required"`
-	Duration  int    `bson:"duration" json:"duration", binding:"required"`
-	AppName   string `bson:"appName" json:"appName", binding:"required"`
-	SloResult SLO    `bson:"sloResult" json:"sloResult", binding:"required"`
+	RunId     string    `bson:"runID" json:"runId", binding:"required"`
+	Duration  int       `bson:"duration" json:"duration", binding:"required"`
+	AppName   string    `bson:"appName" json:"appName", binding:"required"`
+	SloResult SLO       `bson:"sloResult" json:"sloResult", binding:"required"`
+	Created   time.Time `bson:"created" json:"created"`
+}
+
+// Pricing options of the sizing recommendations, using the linux hourly cost.
+const (
+	OnDemandPricing = "onDemand"
+	ReservedPricing = "reserved"
+)
+
+// HourlyPrice returns the linux hourly cost of the pricing option.
+func (cost AWSCost) HourlyPrice(pricing string) float64 {
+	if pricing == ReservedPricing {
+		return float64(cost.LinuxReserved)
+	}
+
+	return float64(cost.LinuxOnDemand)
+}
+
+// InstanceRecommendation scores the sizing results of an instance type.
+// Performance is the QoS value for throughput SLOs, and the inverse of the
+// QoS value for other SLOs, so higher performance is always better.
+type InstanceRecommendation struct {
+	Rank          int     `bson:"rank" json:"rank"`
+	InstanceType  string  `bson:"instanceType" json:"instanceType"`
+	QosValue      float64 `bson:"qosValue" json:"qosValue"`
+	HourlyCost    float64 `bson:"hourlyCost" json:"hourlyCost"`
+	Performance   float64 `bson:"performance" json:"performance"`
+	PerfPerDollar float64 `bson:"perfPerDollar" json:"perfPerDollar"`
+	// SloMet is set if the mean QoS meets the SLO, and SloConfident if the 95%
+	// confidence interval of the mean meets it too.
+	SloMet       bool `bson:"sloMet" json:"sloMet"`
+	SloConfident bool `bson:"sloConfident" json:"sloConfident"`
+	// SloHeadroom is the ratio of the SLO value the QoS is better than the SLO
+	// by, which is negative if the SLO is violated.
+	SloHeadroom float64 `bson:"sloHeadroom" json:"sloHeadroom"`
+	// Pareto is set if no other instance type is both cheaper and performs better.
+	Pareto bool `bson:"pareto" json:"pareto"`
+}
+
+// PricedRecommendation ranks the instance types by SLO compliance first, and
+// then by performance per dollar with the pricing option.
+type PricedRecommendation struct {
+	Pricing string `bson:"pricing" json:"pricing"`
+	// Recommended is the best ranked instance type meeting the SLO, if any.
+	Recommended    string                   `bson:"recommended" json:"recommended"`
+	Ranking        []InstanceRecommendation `bson:"ranking" json:"ranking"`
+	ParetoFrontier []string                 `bson:"paretoFrontier" json:"paretoFrontier"`
+}
+
+// SizingRecommendation is the recommendation computed from the results of
+// an all instances sizing run, with on-demand and reserved pricing.
+type SizingRecommendation struct {
+	RunId    string               `bson:"runId" json:"runId"`
+	AppName  string               `bson:"appName" json:"appName"`
+	Region   string               `bson:"region" json:"region"`
+	SLO      SLO                  `bson:"slo" json:"slo"`
+	OnDemand PricedRecommendation `bson:"onDemand" json:"onDemand"`
+	Reserved PricedRecommendation `bson:"reserved" json:"reserved"`
+	Created  time.Time            `bson:"created" json:"created"`
+}
+
+// GetPricedRecommendation returns the recommendation with the pricing option.
+func (recommendation *SizingRecommendation) GetPricedRecommendation(pricing string) *PricedRecommendation {
+	if pricing == ReservedPricing {
+		return &recommendation.Reserved
+	}
+
+	return &recommendation.OnDemand
 }
 
 type AWSRegionNodeTypeConfig struct {
 	Data   []AWSNodeType `bson:"data" json:"data"`
 	Region string        `bson:"region" json:"region"`
 }
+
+type GCPCost struct {
+	OnDemand    float32 `bson:"onDemand" json:"onDemand" binding:"required"`
+	Preemptible float32 `bson:"preemptible" json:"preemptible"`
+}
+
+// GCPMachineType is a machine type of a GCP region. Shared core machine
+// types have a fraction of a vCPU.
+type GCPMachineType struct {
+	Name       string  `bson:"name" json:"name" binding:"required"`
+	Category   string  `bson:"category" json:"category"`
+	HourlyCost GCPCost `bson:"cost" json:"cost" binding:"required"`
+	VCPU       float32 `bson:"vCPU" json:"vCPU" binding:"required"`
+	MemoryGiB  float32 `bson:"memoryGiB" json:"memoryGiB" binding:"required"`
+}
+
+type GCPRegionMachineTypeConfig struct {
+	Data   []GCPMachineType `bson:"data" json:"data"`
+	Region string           `bson:"region" json:"region"`
+}
@@ -34,7 +34,11 @@ func Run(fileConfig string) error {
 	resty.SetTimeout(time.Duration(3 * time.Minute))
 	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(10))
 
-	server := NewServer(viper)
+	server, err := NewServer(viper)
+	if err != nil {
+		return err
+	}
+
 	return server.StartServer()
 }
 
@@ -1,12 +1,13 @@
 package runners
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
@@ -28,12 +29,14 @@ const (
 	RUNNING  = 0
 	FAILED   = 1
 	FINISHED = 2
+	PENDING  = 3
 )
 
 var instanceRunStates = map[instanceRunState]string{
 	RUNNING:  "Running",
 	FAILED:   "Failed",
 	FINISHED: "Finished",
+	PENDING:  "Pending",
 }
 
 func GetStateString(state instanceRunState) string {
@@ -60,30 +63,195 @@ type SizeRunResults struct {
 	Duration     string
 	AppName      string
 	QosValue     models.SLO
+	Stats        *models.QosStats
 }
 
 type InstanceResults struct {
-	State    string  `bson:"state" json:"state"`
-	QosValue float64 `bson:"qosValue" json:"qosValue"`
+	State    string           `bson:"state" json:"state"`
+	QosValue float64          `bson:"qosValue" json:"qosValue"`
+	Stats    *models.QosStats `bson:"stats,omitempty" json:"stats,omitempty"`
+	// Started is when the single run of the instance type was queued.
+	Started     time.Time `bson:"started,omitempty" json:"started,omitempty"`
+	SingleRunId string    `bson:"singleRunId,omitempty" json:"singleRunId,omitempty"`
 }
 
+// Clouds of the sizing results.
+const (
+	AWSCloud = "aws"
+	GCPCloud = "gcp"
+)
+
+// AllInstanceRunResults are the results of the instance types, or machine
+// types, sized by a run on a cloud.
 type AllInstanceRunResults struct {
 	RunId       string                      `bson:"runId" json:"runId"`
 	Duration    string                      `bson:"duration" json:"duration"`
 	AppName     string                      `bson:"appName" json:"appName"`
+	Cloud       string                      `bson:"cloud,omitempty" json:"cloud,omitempty"`
+	Region      string                      `bson:"region,omitempty" json:"region,omitempty"`
 	TestResults map[string]*InstanceResults `bson:"testResult" json:"testResult"`
+	Created     time.Time                   `bson:"created" json:"created"`
+}
+
+// GetCloud returns the cloud of the results, which is AWS for the results
+// stored before other clouds were sized.
+func (results *AllInstanceRunResults) GetCloud() string {
+	if results.Cloud == "" {
+		return AWSCloud
+	}
+	return results.Cloud
+}
+
+// GetLatestInstanceRunResults returns the latest sizing results of the app in
+// the cloud's region, or in any region if it's empty. Results stored before
+// their region was recorded match any region.
+func GetLatestInstanceRunResults(
+	metricsDB db.MetricsStore,
+	appName string,
+	cloud string,
+	region string) (*AllInstanceRunResults, error) {
+	results := []AllInstanceRunResults{}
+	if err := metricsDB.GetMetrics("allInstance", db.MetricsQuery{AppName: appName}, &results); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if results[i].GetCloud() == cloud && (region == "" || results[i].Region == "" || results[i].Region == region) {
+			return &results[i], nil
+		}
+	}
+
+	return nil, errors.New("Unable to find " + cloud + " sizing results of app " + appName + " in " + region)
+}
+
+// AWSLocation is the region and availability zone an AWS sizing run sizes
+// the app in. Runs without a region use the default region of the clusters.
+type AWSLocation struct {
+	Region           string `json:"region"`
+	AvailabilityZone string `json:"availabilityZone"`
+}
+
+// ResolveAWSLocations returns the location of each requested region, or of
+// the aws.region config if no region is requested. The region the profiler
+// runs in is only detected from the EC2 metadata if neither is set. The
+// availability zone of a region is the requested zone in the region, the
+// aws.availabilityZone config if it's in the region, or the zone the profiler
+// runs in, and defaults to the first zone of the region.
+func ResolveAWSLocations(config *viper.Viper, regions []string, availabilityZones []string) ([]AWSLocation, error) {
+	var identity *ec2metadata.EC2InstanceIdentityDocument
+	var identityErr error
+	detectIdentity := func() (*ec2metadata.EC2InstanceIdentityDocument, error) {
+		if identity == nil && identityErr == nil {
+			document, err := ec2metadata.New(session.New()).GetInstanceIdentityDocument()
+			if err != nil {
+				identityErr = errors.New("Unable to get identity document from ec2 metadata: " + err.Error())
+			} else {
+				identity = &document
+			}
+		}
+		return identity, identityErr
+	}
+
+	if len(regions) == 0 {
+		if region := config.GetString("aws.region"); region != "" {
+			regions = []string{region}
+		} else {
+			document, err := detectIdentity()
+			if err != nil {
+				return nil, errors.New("No region is requested or configured: " + err.Error())
+			}
+			regions = []string{document.Region}
+		}
+	}
+
+	for _, availabilityZone := range availabilityZones {
+		found := false
+		for _, region := range regions {
+			found = found || isAvailabilityZoneOf(availabilityZone, region)
+		}
+		if !found {
+			return nil, fmt.Errorf("Availability zone %s is not in regions %v", availabilityZone, regions)
+		}
+	}
+
+	locations := []AWSLocation{}
+	resolved := map[string]bool{}
+	for _, region := range regions {
+		if resolved[region] {
+			continue
+		}
+		resolved[region] = true
+
+		location := AWSLocation{Region: region}
+		for _, availabilityZone := range availabilityZones {
+			if isAvailabilityZoneOf(availabilityZone, region) {
+				location.AvailabilityZone = availabilityZone
+				break
+			}
+		}
+
+		if location.AvailabilityZone == "" {
+			if availabilityZone := config.GetString("aws.availabilityZone"); availabilityZone != "" &&
+				isAvailabilityZoneOf(availabilityZone, region) {
+				location.AvailabilityZone = availabilityZone
+			} else if document, err := detectIdentity(); err == nil && document.Region == region {
+				location.AvailabilityZone = document.AvailabilityZone
+			} else {
+				location.AvailabilityZone = region + "a"
+			}
+		}
+
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+// isAvailabilityZoneOf returns if the availability zone is a zone of the
+// region, which is the region followed by the zone letter.
+func isAvailabilityZoneOf(availabilityZone string, region string) bool {
+	if len(availabilityZone) != len(region)+1 || !strings.HasPrefix(availabilityZone, region) {
+		return false
+	}
+
+	zone := availabilityZone[len(region)]
+	return zone >= 'a' && zone <= 'z'
+}
+
+type awsSizingRunParameters struct {
+	Region           string `json:"region"`
+	AvailabilityZone string `json:"availabilityZone"`
+}
+
+type awsSizingInstancesRunParameters struct {
+	Instances        []string `json:"instances"`
+	Region           string   `json:"region"`
+	AvailabilityZone string   `json:"availabilityZone"`
+}
+
+type awsSizingAllInstancesRunParameters struct {
+	Region           string `json:"region"`
+	AvailabilityZone string `json:"availabilityZone"`
+	ResumeRunId      string `json:"resumeRunId,omitempty"`
 }
 
 // AWSSizingRun is the overall app request for find best instance type in AWS.
-// It spawns multiple AWSSizingSingleRun based on analyzer recommendations.
+// It spawns multiple AWSSizingSingleRun based on the optimizer's suggestions.
 // Note that AWSSizingRun doesn't implement the job interface, and won't be queued
 // up to the job manager to run.
 type AWSSizingRun struct {
 	ProfileRun
 
-	Config         *viper.Viper
-	JobManager     *jobs.JobManager
-	AnalyzerClient *clients.AnalyzerClient
+	Config     *viper.Viper
+	JobManager *jobs.JobManager
+	// Optimizer suggests the instance types to size, which is only set for
+	// the AWS sizing run itself.
+	Optimizer InstanceTypeOptimizer
+	// Calibration is the calibration results to size the app with. The latest
+	// stored calibration results of the app are used if it's not set.
+	Calibration *models.CalibrationResults
+	// Location is where the single runs deploy their clusters.
+	Location AWSLocation
 }
 
 type AWSSizingAllInstancesRun struct {
@@ -91,6 +259,10 @@ type AWSSizingAllInstancesRun struct {
 
 	NodeTypeConfig      *models.AWSRegionNodeTypeConfig
 	PreviousGenerations []string
+	SizingConfig        SizingConfig
+	// ResumeRunId is the run whose unfinished and failed instance types are
+	// sized, instead of the ones missing from the latest results of the app.
+	ResumeRunId string
 }
 
 type AWSSizingInstancesRun struct {
@@ -105,8 +277,15 @@ type AWSSizingSingleRun struct {
 	ProfileRun
 
 	InstanceType string
-	Calibration  *models.CalibrationResults
-	ResultsChan  chan *jobs.JobResults
+	// Region is the AWS region the cluster is deployed in, or the default
+	// region of the clusters if it's empty.
+	Region      string
+	Calibration *models.CalibrationResults
+	Trials      TrialConfig
+	// ResultsChan receives exactly one result, as the run can be failed by
+	// the job manager as well as by itself.
+	ResultsChan chan *jobs.JobResults
+	resultsOnce sync.Once
 }
 
 func NewAWSSizingAllInstancesRun(
@@ -115,13 +294,51 @@ func NewAWSSizingAllInstancesRun(
 	config *viper.Viper,
 	nodeTypeConfig *models.AWSRegionNodeTypeConfig,
 	previousGenerations []string,
-	allInstances bool,
+	availabilityZone string,
+	resumeRunId string,
 	skipUnreserveOnFailure bool) (*AWSSizingAllInstancesRun, error) {
 	id, err := generateId("awssizingall")
 	if err != nil {
 		return nil, errors.New("Unable to generate id: " + err.Error())
 	}
 
+	return newAWSSizingAllInstancesRun(
+		id,
+		jobManager,
+		applicationConfig,
+		config,
+		nodeTypeConfig,
+		previousGenerations,
+		availabilityZone,
+		resumeRunId,
+		skipUnreserveOnFailure)
+}
+
+func newAWSSizingAllInstancesRun(
+	id string,
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	nodeTypeConfig *models.AWSRegionNodeTypeConfig,
+	previousGenerations []string,
+	availabilityZone string,
+	resumeRunId string,
+	skipUnreserveOnFailure bool) (*AWSSizingAllInstancesRun, error) {
+	if availabilityZone == "" {
+		availabilityZone = nodeTypeConfig.Region + "a"
+	}
+
+	parameters := awsSizingAllInstancesRunParameters{
+		Region:           nodeTypeConfig.Region,
+		AvailabilityZone: availabilityZone,
+		ResumeRunId:      resumeRunId,
+	}
+
+	sizingConfig, err := GetSizingConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -132,30 +349,37 @@ func NewAWSSizingAllInstancesRun(
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
-	analyzerClient, err := clients.NewAnalyzerClient(config)
-	if err != nil {
-		return nil, errors.New("Unable to create analyzer client: " + err.Error())
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
 	}
 
 	return &AWSSizingAllInstancesRun{
 		AWSSizingRun: AWSSizingRun{
 			ProfileRun: ProfileRun{
-				Id:                     id,
-				ApplicationConfig:      applicationConfig,
-				DeployerClient:         deployerClient,
-				MetricsDB:              db.NewMetricsDB(config),
-				ProfileLog:             log,
+				Id:                id,
+				ApplicationConfig: applicationConfig,
+				DeployerClient:    deployerClient,
+				MetricsDB:         metricsDB,
+				ProfileLog:        log,
+				Request: newJobRequest(
+					AWSSizingAllInstancesJobType, applicationConfig, skipUnreserveOnFailure, parameters),
 				Created:                time.Now(),
 				SkipUnreserveOnFailure: skipUnreserveOnFailure,
 				DirectJob:              true,
 			},
 
-			AnalyzerClient: analyzerClient,
-			JobManager:     jobManager,
-			Config:         config,
+			JobManager: jobManager,
+			Config:     config,
+			Location: AWSLocation{
+				Region:           nodeTypeConfig.Region,
+				AvailabilityZone: availabilityZone,
+			},
 		},
 		NodeTypeConfig:      nodeTypeConfig,
 		PreviousGenerations: previousGenerations,
+		SizingConfig:        sizingConfig,
+		ResumeRunId:         resumeRunId,
 	}, nil
 }
 
@@ -169,111 +393,318 @@ func (run *AWSSizingRun) GetResults() <-chan *jobs.JobResults {
 	return nil
 }
 
-func (run *AWSSizingAllInstancesRun) Run(deploymentId string) error {
+// waitSingleRunResults waits for the results of a single run, or returns the
+// context error if the sizing run is cancelled first.
+func (run *AWSSizingRun) waitSingleRunResults(
+	ctx context.Context,
+	singleRun *AWSSizingSingleRun) (*jobs.JobResults, error) {
+	select {
+	case result := <-singleRun.GetResults():
+		return result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// publishInstanceProgress reports the results of a single run, which is the
+// finished-th of the total single runs spawned by this sizing run.
+func (run *AWSSizingRun) publishInstanceProgress(instanceType string, finished int, total int, failure string) {
+	message := "Finished sizing instance type " + instanceType
+	if failure != "" {
+		message = "Failed sizing instance type " + instanceType + ": " + failure
+	}
+
+	run.publishProgress(jobs.JobProgress{
+		Stage:        "sizing",
+		Message:      message,
+		Current:      finished,
+		Total:        total,
+		InstanceType: instanceType,
+	})
+}
+
+// cancelSingleRuns cancels all single runs that are spawned by this sizing run
+// and haven't finished yet.
+func (run *AWSSizingRun) cancelSingleRuns(singleRuns map[string]*AWSSizingSingleRun) {
 	log := run.ProfileLog.Logger
-	appName := run.ApplicationConfig.Name
+	for _, singleRun := range singleRuns {
+		if err := run.JobManager.CancelJob(singleRun.GetId()); err != nil {
+			log.Infof("Skip cancelling single run %s: %s", singleRun.GetId(), err.Error())
+		}
+	}
+}
+
+// getInitialResults returns the results the run continues from. A restored
+// run continues its own stored results, and a resumed run the results of the
+// run it resumes. Other runs carry over the finished instance types of the
+// latest run, which are not run again.
+func (run *AWSSizingAllInstancesRun) getInitialResults() (*AllInstanceRunResults, error) {
+	log := run.ProfileLog.Logger
+	allInstanceRunResults := &AllInstanceRunResults{
+		RunId:       run.GetId(),
+		AppName:     run.ApplicationConfig.Name,
+		Cloud:       AWSCloud,
+		Region:      run.Location.Region,
+		TestResults: make(map[string]*InstanceResults),
+		Created:     time.Now(),
+	}
+
+	storedResults := &AllInstanceRunResults{}
+	if _, err := run.MetricsDB.GetMetricByRunId("allInstance", run.GetId(), storedResults); err == nil {
+		log.Infof("Continuing stored instance results of run %s", run.GetId())
+		allInstanceRunResults.TestResults = storedResults.TestResults
+		allInstanceRunResults.Created = storedResults.Created
+		return allInstanceRunResults, nil
+	}
+
+	if run.ResumeRunId != "" {
+		resumedResults := &AllInstanceRunResults{}
+		if _, err := run.MetricsDB.GetMetricByRunId("allInstance", run.ResumeRunId, resumedResults); err != nil {
+			return nil, errors.New("Unable to get instance results of run " + run.ResumeRunId + ": " + err.Error())
+		}
+
+		log.Infof("Resuming instance results of run %s", run.ResumeRunId)
+		for instanceType, instanceResults := range resumedResults.TestResults {
+			allInstanceRunResults.TestResults[instanceType] = instanceResults
+		}
+		return allInstanceRunResults, nil
+	}
+
+	previousResults, err := GetLatestInstanceRunResults(
+		run.MetricsDB, run.ApplicationConfig.Name, AWSCloud, run.Location.Region)
+	if err == nil {
+		log.Infof("Using finished instance results from run %s", previousResults.RunId)
+		for instanceType, instanceResults := range previousResults.TestResults {
+			if instanceResults.State == GetStateString(FINISHED) {
+				allInstanceRunResults.TestResults[instanceType] = instanceResults
+			}
+		}
+	}
+
+	return allInstanceRunResults, nil
+}
+
+// findAliveSingleRun returns the single run of the running instance type if it's
+// still queued or running in the job manager, or nil otherwise. Single runs are
+// not restored after a restart, so instance types left running by a restored
+// run are sized again right away.
+func (run *AWSSizingAllInstancesRun) findAliveSingleRun(instanceResults *InstanceResults) *AWSSizingSingleRun {
+	if instanceResults.SingleRunId == "" {
+		return nil
+	}
+
+	job, err := run.JobManager.FindJob(instanceResults.SingleRunId)
+	if err != nil || jobs.IsFinalState(job.GetState()) {
+		return nil
+	}
+
+	singleRun, ok := job.(*AWSSizingSingleRun)
+	if !ok {
+		return nil
+	}
+
+	return singleRun
+}
+
+// storeInstanceResults stores the results after every change to the state of
+// an instance type, so an interrupted run can be resumed.
+func (run *AWSSizingAllInstancesRun) storeInstanceResults(allInstanceRunResults *AllInstanceRunResults) {
+	log := run.ProfileLog.Logger
+	if err := run.MetricsDB.UpsertMetrics("allInstance", allInstanceRunResults.RunId, allInstanceRunResults); err != nil {
+		log.Warningf("Unable to store sizing results for app " + allInstanceRunResults.AppName + ": " + err.Error())
+	}
+}
 
-	log.Infof("Reading calibration results for app %s", appName)
-	metric, err := run.MetricsDB.GetMetric("calibration", appName, &models.CalibrationResults{})
+// startSingleRun queues the single run of the instance type, and sends its
+// results to resultsChan once it finishes.
+func (run *AWSSizingAllInstancesRun) startSingleRun(
+	ctx context.Context,
+	instanceType string,
+	calibration *models.CalibrationResults,
+	resultsChan chan<- instanceRunResult) (*AWSSizingSingleRun, error) {
+	newId := run.GetId() + "-" + instanceType
+	newApplicationConfig := &models.ApplicationConfig{}
+	deepCopy(run.ApplicationConfig, newApplicationConfig)
+	singleRun, err := NewAWSSizingSingleRun(
+		newId,
+		instanceType,
+		calibration,
+		newApplicationConfig,
+		run.Config,
+		run.IsSkipUnreserveOnFailure())
 	if err != nil {
-		return errors.New("Unable to get calibration results for app " + appName + ": " + err.Error())
+		return nil, err
 	}
 
-	calibration := metric.(*models.CalibrationResults)
+	singleRun.Region = run.Location.Region
+	singleRun.SetPriority(run.GetPriority())
+	singleRun.SetUserId(run.Request.UserId)
+	run.JobManager.AddJob(singleRun)
+	go run.watchSingleRun(ctx, instanceType, singleRun, resultsChan)
 
-	log.Infof("Running through all instances for this sizing run " + run.GetId())
+	return singleRun, nil
+}
 
-	metadataSvc := ec2metadata.New(session.New())
-	identity, err := metadataSvc.GetInstanceIdentityDocument()
+// watchSingleRun waits for the results of the single run of the instance type,
+// and sends them to resultsChan.
+func (run *AWSSizingAllInstancesRun) watchSingleRun(
+	ctx context.Context,
+	instanceType string,
+	singleRun *AWSSizingSingleRun,
+	resultsChan chan<- instanceRunResult) {
+	result, err := run.waitSingleRunResults(ctx, singleRun)
 	if err != nil {
-		return errors.New("Unable to get identity document from ec2 metadata: " + err.Error())
+		return
+	}
+
+	runResult := instanceRunResult{
+		instanceType: instanceType,
+		singleRun:    singleRun,
+		failure:      result.Error,
+	}
+	if result.Error == "" {
+		sizeRunResults := result.Data.(SizeRunResults)
+		runResult.results = &sizeRunResults
 	}
 
-	region := identity.Region
-	availabilityZone := identity.AvailabilityZone
-	log.Infof("Detected region %s and az %s", region, availabilityZone)
+	select {
+	case resultsChan <- runResult:
+	case <-ctx.Done():
+	}
+}
+
+// Run sizes the supported instance types that don't have finished results,
+// with at most SizingConfig.MaxConcurrentInstances single runs queued at a
+// time. The results of single runs left running by an interrupted run are
+// waited on, and count toward the max concurrent instances.
+func (run *AWSSizingAllInstancesRun) Run(ctx context.Context, deploymentId string) error {
+	log := run.ProfileLog.Logger
+
+	calibration, err := run.getCalibration(run.Calibration)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Running through all instances for this sizing run " + run.GetId())
+
+	region := run.Location.Region
+	availabilityZone := run.Location.AvailabilityZone
+	log.Infof("Sizing in region %s and az %s", region, availabilityZone)
 	supportedInstanceTypes, err := run.DeployerClient.GetSupportedAWSInstances(region, availabilityZone)
 	if err != nil {
 		return errors.New("Unable to fetch initial instance types: " + err.Error())
 	}
 
-	var allInstanceRunResults *AllInstanceRunResults
-	results, err := run.MetricsDB.GetMetric("allInstance", run.ApplicationConfig.Name, &AllInstanceRunResults{})
+	allInstanceRunResults, err := run.getInitialResults()
 	if err != nil {
-		allInstanceRunResults = &AllInstanceRunResults{
-			RunId:       run.GetId(),
-			AppName:     run.ApplicationConfig.Name,
-			TestResults: make(map[string]*InstanceResults),
-		}
-	} else {
-		allInstanceRunResults = results.(*AllInstanceRunResults)
+		return err
 	}
 
 	log.Infof("Supported %s EC2 instance types: %+v", availabilityZone, supportedInstanceTypes)
-	jobs := map[string]*AWSSizingSingleRun{}
+	instanceTypes := []string{}
 	for _, instanceType := range supportedInstanceTypes {
-		if !run.isInstanceTypeSupported(instanceType) {
-			continue
+		if run.isInstanceTypeSupported(instanceType) {
+			instanceTypes = append(instanceTypes, instanceType)
 		}
+	}
 
-		existingResults, ok := allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)]
-		if ok && existingResults.State == GetStateString(FINISHED) {
-			log.Infof("Skipping to run instance %s as we already have finished results", instanceType)
-			continue
+	queue, singleRuns, staleRuns := run.planInstanceTypes(instanceTypes, allInstanceRunResults)
+	run.storeInstanceResults(allInstanceRunResults)
+	for _, staleRun := range staleRuns {
+		log.Infof("Cancelling stale single run %s to size instance %s again", staleRun.GetId(), staleRun.InstanceType)
+		if err := run.JobManager.CancelJob(staleRun.GetId()); err != nil {
+			log.Infof("Skip cancelling single run %s: %s", staleRun.GetId(), err.Error())
 		}
+	}
+
+	resultsChan := make(chan instanceRunResult)
+	for instanceType, singleRun := range singleRuns {
+		log.Infof("Waiting on instance %s still running in single run %s", instanceType, singleRun.GetId())
+		go run.watchSingleRun(ctx, instanceType, singleRun, resultsChan)
+	}
 
-		instanceResults := &InstanceResults{
-			State: GetStateString(RUNNING),
+	maxConcurrentInstances := run.SizingConfig.MaxConcurrentInstances
+	total := len(queue) + len(singleRuns)
+	startTime := time.Now()
+	finished := 0
+	for len(queue) > 0 || len(singleRuns) > 0 {
+		for len(queue) > 0 && len(singleRuns) < maxConcurrentInstances {
+			instanceType := queue[0]
+			queue = queue[1:]
+
+			var instanceResults *InstanceResults
+			singleRun, err := run.startSingleRun(ctx, instanceType, calibration, resultsChan)
+			if err != nil {
+				log.Warningf("Unable to create AWS single run: " + err.Error())
+				instanceResults = &InstanceResults{
+					State: GetStateString(FAILED),
+				}
+				finished++
+				run.publishInstanceProgress(instanceType, finished, total, err.Error())
+			} else {
+				instanceResults = &InstanceResults{
+					State:       GetStateString(RUNNING),
+					Started:     time.Now(),
+					SingleRunId: singleRun.GetId(),
+				}
+				singleRuns[instanceType] = singleRun
+			}
+
+			allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)] = instanceResults
+			run.storeInstanceResults(allInstanceRunResults)
 		}
 
-		newId := run.GetId() + "-" + instanceType
-		newApplicationConfig := &models.ApplicationConfig{}
-		deepCopy(run.ApplicationConfig, newApplicationConfig)
-		singleRun, err := NewAWSSizingSingleRun(
-			newId,
-			instanceType,
-			calibration,
-			newApplicationConfig,
-			run.Config,
-			run.IsSkipUnreserveOnFailure())
-		if err != nil {
-			log.Warningf("Unable to create AWS single run: " + err.Error())
+		// Every remaining instance type failed to start.
+		if len(singleRuns) == 0 {
 			continue
 		}
 
-		allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)] = instanceResults
-		run.JobManager.AddJob(singleRun)
-		jobs[instanceType] = singleRun
-	}
+		select {
+		case result := <-resultsChan:
+			delete(singleRuns, result.instanceType)
+			finished++
+			run.publishInstanceProgress(result.instanceType, finished, total, result.failure)
 
-	startTime := time.Now()
-	for instanceType, job := range jobs {
-		result := <-job.GetResults()
-		instanceResults := allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)]
-		if result.Error != "" {
-			log.Warningf(
-				"Failed to run aws single size run with id %s: %s",
-				job.GetId(),
-				result.Error)
-			instanceResults.State = GetStateString(FAILED)
-			instanceResults.QosValue = 0.0
-		} else {
-			instanceResults.State = GetStateString(FINISHED)
-			sizeRunResults := result.Data.(SizeRunResults)
-			qosValue := sizeRunResults.QosValue.Value
-			log.Infof("Received sizing run value %0.2f with instance type %s", qosValue, instanceType)
-			instanceResults.QosValue = qosValue
+			instanceResults := allInstanceRunResults.TestResults[instanceTypeDbName(result.instanceType)]
+			if result.failure != "" {
+				log.Warningf(
+					"Failed to run aws single size run with id %s: %s",
+					result.singleRun.GetId(),
+					result.failure)
+				instanceResults.State = GetStateString(FAILED)
+				instanceResults.QosValue = 0.0
+			} else {
+				instanceResults.State = GetStateString(FINISHED)
+				qosValue := result.results.QosValue.Value
+				log.Infof("Received sizing run value %0.2f with instance type %s", qosValue, result.instanceType)
+				instanceResults.QosValue = qosValue
+				instanceResults.Stats = result.results.Stats
+			}
 			allInstanceRunResults.Duration = time.Since(startTime).String()
 
-			// Store each successful run metric
 			log.Infof("Storing sizing all instance results for app %s", allInstanceRunResults.AppName)
-			if err := run.MetricsDB.UpsertMetrics("allInstance", allInstanceRunResults.AppName, allInstanceRunResults); err != nil {
-				message := "Unable to store sizing results for app " + allInstanceRunResults.AppName + ": " + err.Error()
-				log.Warningf(message)
+			run.storeInstanceResults(allInstanceRunResults)
+		case <-ctx.Done():
+			run.cancelSingleRuns(singleRuns)
+			// Cancelled instance types are left pending, to be sized when the
+			// run is resumed.
+			for instanceType := range singleRuns {
+				allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)] = &InstanceResults{
+					State: GetStateString(PENDING),
+				}
 			}
+			run.storeInstanceResults(allInstanceRunResults)
+			return errors.New("AWS sizing all instances run cancelled: " + ctx.Err().Error())
 		}
 	}
 
+	recommendation := computeSizingRecommendation(run.ApplicationConfig.SLO, run.NodeTypeConfig, allInstanceRunResults)
+	log.Infof("Recommended instance type %s with on-demand pricing and %s with reserved pricing",
+		recommendation.OnDemand.Recommended, recommendation.Reserved.Recommended)
+	if err := run.MetricsDB.WriteMetrics("sizingRecommendation", recommendation); err != nil {
+		return errors.New("Unable to store sizing recommendation: " + err.Error())
+	}
+
 	return nil
 }
 
@@ -282,6 +713,7 @@ func NewAWSSizingInstancesRun(
 	applicationConfig *models.ApplicationConfig,
 	config *viper.Viper,
 	instances []string,
+	location AWSLocation,
 	skipUnreserveOnFailure bool) (*AWSSizingInstancesRun, error) {
 	if len(instances) == 0 {
 		return nil, errors.New("Empty instances found")
@@ -292,6 +724,23 @@ func NewAWSSizingInstancesRun(
 		return nil, errors.New("Unable to generate id: " + err.Error())
 	}
 
+	return newAWSSizingInstancesRun(id, jobManager, applicationConfig, config, instances, location, skipUnreserveOnFailure)
+}
+
+func newAWSSizingInstancesRun(
+	id string,
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	instances []string,
+	location AWSLocation,
+	skipUnreserveOnFailure bool) (*AWSSizingInstancesRun, error) {
+	parameters := awsSizingInstancesRunParameters{
+		Instances:        instances,
+		Region:           location.Region,
+		AvailabilityZone: location.AvailabilityZone,
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -302,42 +751,40 @@ func NewAWSSizingInstancesRun(
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
-	analyzerClient, err := clients.NewAnalyzerClient(config)
-	if err != nil {
-		return nil, errors.New("Unable to create analyzer client: " + err.Error())
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
 	}
 
 	return &AWSSizingInstancesRun{
 		AWSSizingRun: AWSSizingRun{
 			ProfileRun: ProfileRun{
-				Id:                     id,
-				ApplicationConfig:      applicationConfig,
-				DeployerClient:         deployerClient,
-				MetricsDB:              db.NewMetricsDB(config),
-				ProfileLog:             log,
+				Id:                id,
+				ApplicationConfig: applicationConfig,
+				DeployerClient:    deployerClient,
+				MetricsDB:         metricsDB,
+				ProfileLog:        log,
+				Request: newJobRequest(
+					AWSSizingInstancesJobType, applicationConfig, skipUnreserveOnFailure, parameters),
 				Created:                time.Now(),
 				SkipUnreserveOnFailure: skipUnreserveOnFailure,
 				DirectJob:              true,
 			},
-			AnalyzerClient: analyzerClient,
-			JobManager:     jobManager,
-			Config:         config,
+			JobManager: jobManager,
+			Config:     config,
+			Location:   location,
 		},
 		Instances: instances,
 	}, nil
 }
 
-func (run *AWSSizingInstancesRun) Run(deploymentId string) error {
+func (run *AWSSizingInstancesRun) Run(ctx context.Context, deploymentId string) error {
 	log := run.ProfileLog.Logger
-	appName := run.ApplicationConfig.Name
 
-	log.Infof("Reading calibration results for app %s", appName)
-	metric, err := run.MetricsDB.GetMetric("calibration", appName, &models.CalibrationResults{})
+	calibration, err := run.getCalibration(run.Calibration)
 	if err != nil {
-		return errors.New("Unable to get calibration results for app " + appName + ": " + err.Error())
+		return err
 	}
-
-	calibration := metric.(*models.CalibrationResults)
 	results := make(map[string]float64)
 	log.Infof("Instance types to run: %+v", run.Instances)
 
@@ -358,12 +805,23 @@ func (run *AWSSizingInstancesRun) Run(deploymentId string) error {
 			return errors.New("Unable to create AWS single run: " + err.Error())
 		}
 
+		singleRun.Region = run.Location.Region
+		singleRun.SetPriority(run.GetPriority())
+		singleRun.SetUserId(run.Request.UserId)
 		run.JobManager.AddJob(singleRun)
 		jobs[instanceType] = singleRun
 	}
 
+	finished := 0
 	for instanceType, job := range jobs {
-		result := <-job.GetResults()
+		result, err := run.waitSingleRunResults(ctx, job)
+		if err != nil {
+			run.cancelSingleRuns(jobs)
+			return errors.New("AWS sizing instances run cancelled: " + err.Error())
+		}
+		finished++
+		run.publishInstanceProgress(instanceType, finished, len(jobs), result.Error)
+
 		if result.Error != "" {
 			log.Warningf(
 				"Failed to run aws single size run with id %s: %s",
@@ -387,12 +845,28 @@ func NewAWSSizingRun(
 	jobManager *jobs.JobManager,
 	applicationConfig *models.ApplicationConfig,
 	config *viper.Viper,
+	location AWSLocation,
 	skipUnreserveOnFailure bool) (*AWSSizingRun, error) {
 	id, err := generateId("awssizing")
 	if err != nil {
 		return nil, errors.New("Unable to generate id: " + err.Error())
 	}
 
+	return newAWSSizingRun(id, jobManager, applicationConfig, config, location, skipUnreserveOnFailure)
+}
+
+func newAWSSizingRun(
+	id string,
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	location AWSLocation,
+	skipUnreserveOnFailure bool) (*AWSSizingRun, error) {
+	parameters := awsSizingRunParameters{
+		Region:           location.Region,
+		AvailabilityZone: location.AvailabilityZone,
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -403,9 +877,14 @@ func NewAWSSizingRun(
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
-	analyzerClient, err := clients.NewAnalyzerClient(config)
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
+	optimizer, err := newInstanceTypeOptimizer(config, applicationConfig, location.Region)
 	if err != nil {
-		return nil, errors.New("Unable to create analyzer client: " + err.Error())
+		return nil, err
 	}
 
 	return &AWSSizingRun{
@@ -413,37 +892,30 @@ func NewAWSSizingRun(
 			Id:                     id,
 			ApplicationConfig:      applicationConfig,
 			DeployerClient:         deployerClient,
-			MetricsDB:              db.NewMetricsDB(config),
+			MetricsDB:              metricsDB,
 			ProfileLog:             log,
+			Request:                newJobRequest(AWSSizingJobType, applicationConfig, skipUnreserveOnFailure, parameters),
 			Created:                time.Now(),
 			SkipUnreserveOnFailure: skipUnreserveOnFailure,
 			DirectJob:              true,
 		},
-		AnalyzerClient: analyzerClient,
-		JobManager:     jobManager,
-		Config:         config,
+		Optimizer:  optimizer,
+		JobManager: jobManager,
+		Config:     config,
+		Location:   location,
 	}, nil
 }
 
-func (run *AWSSizingAllInstancesRun) isInstanceTypeSupported(instanceType string) bool {
-	log := run.ProfileLog.Logger
-
-	for _, previousInstanceTypeName := range run.PreviousGenerations {
-		if instanceType == previousInstanceTypeName {
-			log.Infof("Skipping previous generation %s", instanceType)
-			return false
-		}
-	}
-
-	// Filter lower resource
-	serviceName := run.ApplicationConfig.ServiceNames[0]
+// getServiceRequests returns the total cpu and memory requests of the
+// containers of the app's service, in milli units.
+func getServiceRequests(applicationConfig *models.ApplicationConfig) (int64, int64, error) {
+	serviceName := applicationConfig.ServiceNames[0]
 	var memoryRequirement int64
 	var cpuRequirement int64
-	for _, task := range run.ApplicationConfig.TaskDefinitions {
+	for _, task := range applicationConfig.TaskDefinitions {
 		kubernetesTask := &deployer.KubernetesTask{}
 		if err := deepCopy(task.TaskDefinition, kubernetesTask); err != nil {
-			log.Warningf("Unable to convert to kubernetesTask: " + err.Error())
-			return false
+			return 0, 0, errors.New("Unable to convert to kubernetesTask: " + err.Error())
 		}
 
 		if kubernetesTask.Family == serviceName {
@@ -454,6 +926,26 @@ func (run *AWSSizingAllInstancesRun) isInstanceTypeSupported(instanceType string
 		}
 	}
 
+	return cpuRequirement, memoryRequirement, nil
+}
+
+func (run *AWSSizingAllInstancesRun) isInstanceTypeSupported(instanceType string) bool {
+	log := run.ProfileLog.Logger
+
+	for _, previousInstanceTypeName := range run.PreviousGenerations {
+		if instanceType == previousInstanceTypeName {
+			log.Infof("Skipping previous generation %s", instanceType)
+			return false
+		}
+	}
+
+	// Filter lower resource
+	cpuRequirement, memoryRequirement, err := getServiceRequests(run.ApplicationConfig)
+	if err != nil {
+		log.Warningf(err.Error())
+		return false
+	}
+
 	memoryConfig := ""
 	cpuConfig := ""
 	for _, node := range run.NodeTypeConfig.Data {
@@ -495,24 +987,24 @@ func (run *AWSSizingAllInstancesRun) isInstanceTypeSupported(instanceType string
 	return true
 }
 
-func (run *AWSSizingRun) Run(deploymentId string) error {
+func (run *AWSSizingRun) Run(ctx context.Context, deploymentId string) error {
 	log := run.ProfileLog.Logger
 	appName := run.ApplicationConfig.Name
 
-	log.Infof("Reading calibration results for app %s", appName)
-	metric, err := run.MetricsDB.GetMetric("calibration", appName, &models.CalibrationResults{})
+	calibration, err := run.getCalibration(run.Calibration)
 	if err != nil {
-		return errors.New("Unable to get calibration results for app " + appName + ": " + err.Error())
+		return err
 	}
-
-	calibration := metric.(*models.CalibrationResults)
 	results := make(map[string]float64)
-	instanceTypes, err := run.AnalyzerClient.GetNextInstanceTypes(run.Id, appName, results, log)
+	instanceTypes, err := run.Optimizer.GetNextInstanceTypes(ctx, run.Id, appName, results, log)
 	if err != nil {
 		return errors.New("Unable to fetch initial instance types: " + err.Error())
 	}
 
 	log.Infof("Received initial instance types: %+v", instanceTypes)
+	// The total grows as the optimizer suggests more instance types.
+	finished := 0
+	total := 0
 	for len(instanceTypes) > 0 {
 		results = make(map[string]float64)
 		jobs := map[string]*AWSSizingSingleRun{}
@@ -531,20 +1023,32 @@ func (run *AWSSizingRun) Run(deploymentId string) error {
 				return errors.New("Unable to create AWS single run: " + err.Error())
 			}
 
+			singleRun.Region = run.Location.Region
+			singleRun.SetPriority(run.GetPriority())
+			singleRun.SetUserId(run.Request.UserId)
 			run.JobManager.AddJob(singleRun)
 			jobs[instanceType] = singleRun
 		}
 
+		total += len(jobs)
 		for instanceType, job := range jobs {
-			result := <-job.GetResults()
+			result, err := run.waitSingleRunResults(ctx, job)
+			if err != nil {
+				run.cancelSingleRuns(jobs)
+				return errors.New("AWS sizing run cancelled: " + err.Error())
+			}
+			finished++
+			run.publishInstanceProgress(instanceType, finished, total, result.Error)
+
 			if result.Error != "" {
 				log.Warningf(
 					"Failed to run aws single size run with id %s: %s",
 					job.GetId(),
 					result.Error)
 				if !clients.IsAWSDeploymentError(result.Error) {
-					// TODO: Report analyzer that we have a critical error and cannot move on
+					// TODO: Report optimizer that we have a critical error and cannot move on
 					log.Warningf("Stopping aws sizing run as we hit a non-aws error")
+					run.cancelSingleRuns(jobs)
 					return errors.New(result.Error)
 				}
 
@@ -557,9 +1061,9 @@ func (run *AWSSizingRun) Run(deploymentId string) error {
 			}
 		}
 
-		sugggestInstanceTypes, err := run.AnalyzerClient.GetNextInstanceTypes(run.Id, appName, results, log)
+		sugggestInstanceTypes, err := run.Optimizer.GetNextInstanceTypes(ctx, run.Id, appName, results, log)
 		if err != nil {
-			return errors.New("Unable to get next instance types from analyzer: " + err.Error())
+			return errors.New("Unable to get next instance types from optimizer: " + err.Error())
 		}
 
 		log.Infof("Received next instance types to run sizing: %s", sugggestInstanceTypes)
@@ -578,11 +1082,21 @@ func NewAWSSizingSingleRun(
 	applicationConfig *models.ApplicationConfig,
 	config *viper.Viper,
 	SkipUnreserveOnFailure bool) (*AWSSizingSingleRun, error) {
+	trialConfig, err := GetTrialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	deployerClient, deployerErr := clients.NewDeployerClient(config)
 	if deployerErr != nil {
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -593,15 +1107,19 @@ func NewAWSSizingSingleRun(
 			Id:                     id,
 			ApplicationConfig:      applicationConfig,
 			DeployerClient:         deployerClient,
-			MetricsDB:              db.NewMetricsDB(config),
+			LocustClient:           &clients.LocustClient{},
+			LocalLoadClient:        &clients.LocalLoadClient{},
+			MetricsDB:              metricsDB,
 			ProfileLog:             log,
+			Request:                newJobRequest(AWSSizingSingleJobType, applicationConfig, SkipUnreserveOnFailure, nil),
 			Created:                time.Now(),
 			SkipUnreserveOnFailure: SkipUnreserveOnFailure,
 			DirectJob:              false,
 		},
 		InstanceType: instanceType,
 		Calibration:  calibration,
-		ResultsChan:  make(chan *jobs.JobResults, 2),
+		Trials:       trialConfig,
+		ResultsChan:  make(chan *jobs.JobResults, 1),
 	}, nil
 }
 
@@ -613,7 +1131,8 @@ func (run *AWSSizingSingleRun) GetJobDeploymentConfig() jobs.JobDeploymentConfig
 		},
 	}
 	return jobs.JobDeploymentConfig{
-		Nodes: nodes,
+		Nodes:  nodes,
+		Region: run.Region,
 	}
 }
 
@@ -631,12 +1150,20 @@ func (run *AWSSizingSingleRun) GetResults() <-chan *jobs.JobResults {
 }
 
 func (run *AWSSizingSingleRun) SetFailed(error string) {
-	run.ResultsChan <- &jobs.JobResults{
+	run.publishResults(&jobs.JobResults{
 		Error: error,
-	}
+	})
 }
 
-func (run *AWSSizingSingleRun) Run(deploymentId string) error {
+// publishResults sends the results of the run, unless the run has already
+// sent its results or failure.
+func (run *AWSSizingSingleRun) publishResults(results *jobs.JobResults) {
+	run.resultsOnce.Do(func() {
+		run.ResultsChan <- results
+	})
+}
+
+func (run *AWSSizingSingleRun) Run(ctx context.Context, deploymentId string) error {
 	log := run.ProfileLog.Logger
 	run.DeploymentId = deploymentId
 	appName := run.ApplicationConfig.Name
@@ -655,38 +1182,36 @@ func (run *AWSSizingSingleRun) Run(deploymentId string) error {
 	}
 
 	startTime := time.Now()
-	runResults, err := run.runApplicationLoadTest(run.Id, run.Calibration.FinalResult.LoadIntensity)
+	runResults, stats, err := runTrials(run.Trials, log, func(trial int) ([]*models.BenchmarkResult, error) {
+		trialId := run.Id
+		if trial > 1 {
+			trialId = run.Id + "-" + strconv.Itoa(trial)
+		}
+		return run.runApplicationLoadTest(ctx, trialId, run.Calibration.FinalResult.LoadIntensity)
+	})
 	if err != nil {
 		message := "Unable to run app " + appName + ": " + err.Error()
 		run.SetFailed(message)
 		return errors.New(message)
 	}
 
-	// Report the average of the run results
-	var total float64
-	var min float64 = math.MaxFloat64
-	var max float64 = math.SmallestNonzeroFloat64
-	for _, result := range runResults {
-		total += result.QosValue
-		if result.QosValue < min {
-			min = result.QosValue
-		}
-		if result.QosValue > max {
-			max = result.QosValue
-		}
+	if stats.Samples == 0 {
+		message := "No load test results found for app " + appName
+		run.SetFailed(message)
+		return errors.New(message)
 	}
 
-	result := total / float64(len(runResults))
-
-	diff := (max - min) / min
-	log.Infof("Run results min: %f, max: %f, avg: %f, max to min diff ratio: %f", min, max, result, diff)
+	// Report the mean of the run results
+	log.Infof("Run results mean: %f, stddev: %f, p50: %f, 95%% confidence interval: [%f, %f], cv: %f, outliers: %d",
+		stats.Mean, stats.Stddev, stats.P50, stats.CILow, stats.CIHigh, stats.CV, stats.Outliers)
 
-	// And return data results via ResultChan to AWSSizingRun, for it to report to the analyzer.
+	// And return data results via ResultChan to AWSSizingRun, for it to report to the optimizer.
 	sizeResults.QosValue = models.SLO{
 		Metric: run.ApplicationConfig.SLO.Metric,
-		Value:  result,
+		Value:  stats.Mean,
 		Type:   run.ApplicationConfig.SLO.Type,
 	}
+	sizeResults.Stats = stats
 	sizeResults.Duration = time.Since(startTime).String()
 
 	if b, err := json.MarshalIndent(runResults, "", "  "); err != nil {
@@ -695,35 +1220,107 @@ func (run *AWSSizingSingleRun) Run(deploymentId string) error {
 		log.Infof("Sizing results: %s", string(b))
 	}
 
-	results := &jobs.JobResults{
+	run.publishResults(&jobs.JobResults{
 		Data: sizeResults,
-	}
-	run.ResultsChan <- results
+	})
 
 	return nil
 }
 
 func (run *AWSSizingSingleRun) runApplicationLoadTest(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64) ([]*models.BenchmarkResult, error) {
 	loadTester := run.ApplicationConfig.LoadTester
 	run.ProfileLog.Logger.Infof("Starting app load test at intensity %.2f", appIntensity)
 	if loadTester.BenchmarkController != nil {
 		return run.runBenchmarkController(
+			ctx,
 			stageId,
 			appIntensity,
 			loadTester.BenchmarkController)
 	} else if loadTester.SlowCookerController != nil {
 		return run.runSlowCookerController(
+			ctx,
 			stageId,
 			appIntensity,
 			loadTester.SlowCookerController)
+	} else if loadTester.LocustController != nil {
+		return run.runLocustController(
+			ctx,
+			appIntensity,
+			loadTester.LocustController)
+	} else if loadTester.LocalLoadController != nil {
+		return run.runLocalLoadController(
+			ctx,
+			stageId,
+			appIntensity,
+			loadTester.LocalLoadController)
 	}
 
 	return nil, errors.New("No controller found in app load test request")
 }
 
+func (run *AWSSizingSingleRun) runLocustController(
+	ctx context.Context,
+	appIntensity float64,
+	controller *models.LocustController) ([]*models.BenchmarkResult, error) {
+	loadTesterName := run.ApplicationConfig.LoadTester.Name
+	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
+	if urlErr != nil {
+		return nil, fmt.Errorf("Unable to retrieve service url [%s]: %s", loadTesterName, urlErr.Error())
+	}
+
+	stepResult, err := run.LocustClient.RunLoad(ctx, url, int(appIntensity), controller, run.ProfileLog.Logger)
+	if err != nil {
+		return nil, errors.New("Unable to run load test with locust: " + err.Error())
+	}
+
+	qosValue, err := clients.GetLocustQos(stepResult, run.ApplicationConfig.SLO.Metric)
+	if err != nil {
+		return nil, errors.New("Unable to get qos from locust result: " + err.Error())
+	}
+
+	return []*models.BenchmarkResult{
+		&models.BenchmarkResult{
+			Intensity: int(appIntensity),
+			QosValue:  qosValue,
+			Failures:  stepResult.Failures,
+		},
+	}, nil
+}
+
+func (run *AWSSizingSingleRun) runLocalLoadController(
+	ctx context.Context,
+	stageId string,
+	appIntensity float64,
+	controller *models.LocalLoadController) ([]*models.BenchmarkResult, error) {
+	response, err := run.LocalLoadClient.RunBenchmark(
+		ctx, stageId, appIntensity, 1, controller, run.ProfileLog.Logger)
+	if err != nil {
+		return nil, errors.New("Unable to run load test with local load: " + err.Error())
+	}
+
+	results := []*models.BenchmarkResult{}
+	for _, runResult := range response.Results {
+		qosValue, err := getSlowcookerBenchmarkQos(&runResult, run.ApplicationConfig.SLO.Metric)
+		if err != nil {
+			return nil, errors.New("Unable to get qos from local load result: " + err.Error())
+		}
+
+		result := &models.BenchmarkResult{
+			Intensity: int(appIntensity),
+			QosValue:  float64(qosValue),
+			Failures:  runResult.Failures,
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 func (run *AWSSizingSingleRun) runBenchmarkController(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64,
 	controller *models.BenchmarkController) ([]*models.BenchmarkResult, error) {
@@ -734,7 +1331,7 @@ func (run *AWSSizingSingleRun) runBenchmarkController(
 	}
 
 	response, err := run.BenchmarkControllerClient.RunBenchmark(
-		loadTesterName, url, stageId, appIntensity, controller, run.ProfileLog.Logger)
+		ctx, loadTesterName, url, stageId, appIntensity, controller, run.ProfileLog.Logger)
 	if err != nil {
 		return nil, errors.New("Unable to run benchmark: " + err.Error())
 	}
@@ -759,6 +1356,7 @@ func (run *AWSSizingSingleRun) runBenchmarkController(
 }
 
 func (run *AWSSizingSingleRun) runSlowCookerController(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64,
 	controller *models.SlowCookerController) ([]*models.BenchmarkResult, error) {
@@ -769,7 +1367,7 @@ func (run *AWSSizingSingleRun) runSlowCookerController(
 	}
 
 	response, err := run.SlowCookerClient.RunBenchmark(
-		url, stageId, appIntensity, controller.Calibrate.InitialConcurrency, controller, run.ProfileLog.Logger, true)
+		ctx, url, stageId, appIntensity, controller.Calibrate.InitialConcurrency, controller, run.ProfileLog.Logger, true)
 	if err != nil {
 		return nil, errors.New("Unable to run benchmark with slow cooker: " + err.Error())
 	}
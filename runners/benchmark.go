@@ -1,10 +1,13 @@
 package runners
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -22,13 +25,50 @@ type BaseBenchmarkRun struct {
 	BenchmarkAgentClient *clients.BenchmarkAgentClient
 }
 
+// Benchmark intensity search modes. Linear search runs every Step intensity from
+// StartingIntensity to 100, while binary search bisects the intensity to find
+// where the app starts violating its SLO.
+const (
+	LinearSearchMode = "linear"
+	BinarySearchMode = "binary"
+)
+
+const (
+	maxBenchmarkIntensity  = 100
+	defaultSearchPrecision = 5
+)
+
+type benchmarkRunParameters struct {
+	StartingIntensity int     `json:"startingIntensity"`
+	Step              int     `json:"step"`
+	SloTolerance      float64 `json:"sloTolerance"`
+	SearchMode        string  `json:"searchMode"`
+	Precision         int     `json:"precision"`
+}
+
 type BenchmarkRun struct {
 	BaseBenchmarkRun
 
 	StartingIntensity int
 	Step              int
 	SloTolerance      float64
-	Benchmarks        []models.Benchmark
+	// SearchMode is either linear or binary. Binary search stops when the
+	// SLO violation boundary is found within Precision intensity.
+	SearchMode string
+	Precision  int
+	Trials     TrialConfig
+	Benchmarks []models.Benchmark
+	// Calibration is the calibration results to benchmark the app with. The latest
+	// stored calibration results of the app are used if it's not set.
+	Calibration *models.CalibrationResults
+	// ToleratedInterference is the tolerated interference of each benchmark
+	// per service in test, reported in the run summary. It's guarded by mutex,
+	// as summaries are read while the run is in progress.
+	ToleratedInterference map[string][]*models.ToleratedInterference
+
+	// progress is the progress of the benchmark being run.
+	progress jobs.JobProgress
+	mutex    sync.Mutex
 }
 
 func getSlowcookerBenchmarkQos(result *clients.SlowCookerBenchmarkResult, metric string) (int64, error) {
@@ -50,6 +90,8 @@ func NewBenchmarkRun(
 	startingIntensity int,
 	step int,
 	sloTolerance float64,
+	searchMode string,
+	precision int,
 	config *viper.Viper) (*BenchmarkRun, error) {
 
 	id, err := generateId("benchmarks")
@@ -58,11 +100,67 @@ func NewBenchmarkRun(
 	}
 	glog.V(1).Infof("Created new benchmark run with id: %s", id)
 
+	return newBenchmarkRun(
+		id,
+		applicationConfig,
+		benchmarks,
+		startingIntensity,
+		step,
+		sloTolerance,
+		searchMode,
+		precision,
+		config)
+}
+
+func newBenchmarkRun(
+	id string,
+	applicationConfig *models.ApplicationConfig,
+	benchmarks []models.Benchmark,
+	startingIntensity int,
+	step int,
+	sloTolerance float64,
+	searchMode string,
+	precision int,
+	config *viper.Viper) (*BenchmarkRun, error) {
+	switch searchMode {
+	case "":
+		searchMode = LinearSearchMode
+	case LinearSearchMode, BinarySearchMode:
+	default:
+		return nil, errors.New("Unknown benchmark search mode: " + searchMode)
+	}
+
+	if searchMode == LinearSearchMode && step <= 0 {
+		return nil, errors.New("Step must be positive for linear benchmark search")
+	}
+
+	if precision <= 0 {
+		precision = defaultSearchPrecision
+	}
+
+	parameters := benchmarkRunParameters{
+		StartingIntensity: startingIntensity,
+		Step:              step,
+		SloTolerance:      sloTolerance,
+		SearchMode:        searchMode,
+		Precision:         precision,
+	}
+
+	trialConfig, err := GetTrialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	deployerClient, deployerErr := clients.NewDeployerClient(config)
 	if deployerErr != nil {
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -76,17 +174,24 @@ func NewBenchmarkRun(
 				DeployerClient:            deployerClient,
 				BenchmarkControllerClient: &clients.BenchmarkControllerClient{},
 				SlowCookerClient:          &clients.SlowCookerClient{},
-				MetricsDB:                 db.NewMetricsDB(config),
+				LocustClient:              &clients.LocustClient{},
+				LocalLoadClient:           &clients.LocalLoadClient{},
+				MetricsDB:                 metricsDB,
 				ProfileLog:                log,
+				Request:                   newJobRequest(BenchmarkJobType, applicationConfig, false, parameters),
 				Created:                   time.Now(),
 				DirectJob:                 false,
 			},
 			BenchmarkAgentClient: clients.NewBenchmarkAgentClient(),
 		},
-		StartingIntensity: startingIntensity,
-		Step:              step,
-		SloTolerance:      sloTolerance,
-		Benchmarks:        benchmarks,
+		StartingIntensity:     startingIntensity,
+		Step:                  step,
+		SloTolerance:          sloTolerance,
+		SearchMode:            searchMode,
+		Precision:             precision,
+		Trials:                trialConfig,
+		Benchmarks:            benchmarks,
+		ToleratedInterference: map[string][]*models.ToleratedInterference{},
 	}
 
 	return run, nil
@@ -98,6 +203,53 @@ func (run *BaseBenchmarkRun) GetResults() <-chan *jobs.JobResults {
 
 func (run *BaseBenchmarkRun) SetFailed(error string) {}
 
+// GetSummary returns the run summary with a copy of the tolerated interference
+// of the services tested so far.
+func (run *BenchmarkRun) GetSummary() jobs.JobSummary {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	summary := run.ProfileRun.GetSummary()
+	if len(run.ToleratedInterference) > 0 {
+		toleratedInterference := map[string][]*models.ToleratedInterference{}
+		for service, interference := range run.ToleratedInterference {
+			toleratedInterference[service] = append([]*models.ToleratedInterference{}, interference...)
+		}
+		summary.Results = toleratedInterference
+	}
+
+	return summary
+}
+
+type byIntensity []*models.BenchmarkStats
+
+func (s byIntensity) Len() int           { return len(s) }
+func (s byIntensity) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byIntensity) Less(i, j int) bool { return s[i].Intensity < s[j].Intensity }
+
+// getToleratedInterference finds the highest benchmark intensity the app meets
+// its SLO at, before the first intensity that violates the SLO by its mean QoS.
+// If the app already violates the SLO at the starting intensity, the tolerated
+// intensity is 0, as no intensity it tolerates was measured.
+func (run *BenchmarkRun) getToleratedInterference(
+	benchmark string,
+	stats []*models.BenchmarkStats) *models.ToleratedInterference {
+	intensities := append([]*models.BenchmarkStats{}, stats...)
+	sort.Sort(byIntensity(intensities))
+
+	toleratedInterference := &models.ToleratedInterference{
+		Benchmark: benchmark,
+	}
+	for _, intensityStats := range intensities {
+		if !run.isSLOMet(intensityStats) {
+			break
+		}
+		toleratedInterference.Intensity = intensityStats.Intensity
+	}
+
+	return toleratedInterference
+}
+
 func (run *BenchmarkRun) deleteBenchmark(service string, benchmark models.Benchmark) error {
 	for _, config := range benchmark.Configs {
 		run.ProfileLog.Logger.Infof("Deleting benchmark config %s", config.Name)
@@ -118,6 +270,7 @@ func (run *BenchmarkRun) deleteBenchmark(service string, benchmark models.Benchm
 }
 
 func (run *BenchmarkRun) runBenchmarkController(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64,
 	benchmarkIntensity int,
@@ -130,7 +283,7 @@ func (run *BenchmarkRun) runBenchmarkController(
 	}
 
 	response, err := run.BenchmarkControllerClient.RunBenchmark(
-		loadTesterName, url, stageId, appIntensity, controller, run.ProfileLog.Logger)
+		ctx, loadTesterName, url, stageId, appIntensity, controller, run.ProfileLog.Logger)
 	if err != nil {
 		return nil, errors.New("Unable to run benchmark: " + err.Error())
 	}
@@ -155,11 +308,42 @@ func (run *BenchmarkRun) runBenchmarkController(
 	return results, nil
 }
 
-func (run *BenchmarkRun) runLocustController(runId string, appIntensity float64, controller *models.LocustController) ([]*models.BenchmarkResult, error) {
-	return nil, errors.New("Unimplemented")
+// runLocustController runs locust with the calibrated number of users along
+// with the benchmark for a step duration.
+func (run *BenchmarkRun) runLocustController(
+	ctx context.Context,
+	appIntensity float64,
+	benchmarkIntensity int,
+	benchmarkName string,
+	controller *models.LocustController) ([]*models.BenchmarkResult, error) {
+	loadTesterName := run.ApplicationConfig.LoadTester.Name
+	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
+	if urlErr != nil {
+		return nil, fmt.Errorf("Unable to retrieve service url [%s]: %s", loadTesterName, urlErr.Error())
+	}
+
+	stepResult, err := run.LocustClient.RunLoad(ctx, url, int(appIntensity), controller, run.ProfileLog.Logger)
+	if err != nil {
+		return nil, errors.New("Unable to run benchmark with locust: " + err.Error())
+	}
+
+	qosValue, err := clients.GetLocustQos(stepResult, run.ApplicationConfig.SLO.Metric)
+	if err != nil {
+		return nil, errors.New("Unable to get benchmark qos from locust result: " + err.Error())
+	}
+
+	return []*models.BenchmarkResult{
+		&models.BenchmarkResult{
+			Benchmark: benchmarkName,
+			Intensity: benchmarkIntensity,
+			QosValue:  qosValue,
+			Failures:  stepResult.Failures,
+		},
+	}, nil
 }
 
 func (run *BenchmarkRun) runSlowCookerController(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64,
 	benchmarkIntensity int,
@@ -172,7 +356,7 @@ func (run *BenchmarkRun) runSlowCookerController(
 	}
 
 	response, err := run.SlowCookerClient.RunBenchmark(
-		url, stageId, appIntensity, controller.Calibrate.InitialConcurrency, controller, run.ProfileLog.Logger, true)
+		ctx, url, stageId, appIntensity, controller.Calibrate.InitialConcurrency, controller, run.ProfileLog.Logger, true)
 	if err != nil {
 		return nil, errors.New("Unable to run benchmark with slow cooker: " + err.Error())
 	}
@@ -196,6 +380,40 @@ func (run *BenchmarkRun) runSlowCookerController(
 	return results, nil
 }
 
+// runLocalLoadController runs the app load from the profiler at the app
+// intensity along with the benchmark.
+func (run *BenchmarkRun) runLocalLoadController(
+	ctx context.Context,
+	stageId string,
+	appIntensity float64,
+	benchmarkIntensity int,
+	benchmarkName string,
+	controller *models.LocalLoadController) ([]*models.BenchmarkResult, error) {
+	response, err := run.LocalLoadClient.RunBenchmark(
+		ctx, stageId, appIntensity, 1, controller, run.ProfileLog.Logger)
+	if err != nil {
+		return nil, errors.New("Unable to run benchmark with local load: " + err.Error())
+	}
+
+	results := []*models.BenchmarkResult{}
+	for _, runResult := range response.Results {
+		qosValue, err := getSlowcookerBenchmarkQos(&runResult, run.ApplicationConfig.SLO.Metric)
+		if err != nil {
+			return nil, errors.New("Unable to get benchmark qos from local load result: " + err.Error())
+		}
+
+		result := &models.BenchmarkResult{
+			Benchmark: benchmarkName,
+			Intensity: benchmarkIntensity,
+			QosValue:  float64(qosValue),
+			Failures:  runResult.Failures,
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 func (run *BaseBenchmarkRun) runBenchmark(id string, service string, benchmark models.Benchmark, intensity int) error {
 	for _, config := range benchmark.Configs {
 		run.ProfileLog.Logger.Infof("Starting to run benchmark config: %+v", config)
@@ -217,6 +435,7 @@ func (run *BaseBenchmarkRun) runBenchmark(id string, service string, benchmark m
 }
 
 func (run *BenchmarkRun) runApplicationLoadTest(
+	ctx context.Context,
 	stageId string,
 	appIntensity float64,
 	benchmarkIntensity int,
@@ -227,6 +446,7 @@ func (run *BenchmarkRun) runApplicationLoadTest(
 
 	if loadTester.BenchmarkController != nil {
 		return run.runBenchmarkController(
+			ctx,
 			stageId,
 			appIntensity,
 			benchmarkIntensity,
@@ -234,79 +454,230 @@ func (run *BenchmarkRun) runApplicationLoadTest(
 			loadTester.BenchmarkController)
 	} else if loadTester.LocustController != nil {
 		return run.runLocustController(
-			stageId,
+			ctx,
 			appIntensity,
+			benchmarkIntensity,
+			benchmarkName,
 			loadTester.LocustController)
 	} else if loadTester.SlowCookerController != nil {
 		return run.runSlowCookerController(
+			ctx,
 			stageId,
 			appIntensity,
 			benchmarkIntensity,
 			benchmarkName,
 			loadTester.SlowCookerController)
+	} else if loadTester.LocalLoadController != nil {
+		return run.runLocalLoadController(
+			ctx,
+			stageId,
+			appIntensity,
+			benchmarkIntensity,
+			benchmarkName,
+			loadTester.LocalLoadController)
 	}
 
 	return nil, errors.New("No controller found in app load test request")
 }
 
-func (run *BenchmarkRun) runAppWithBenchmark(service string, benchmark models.Benchmark, appIntensity float64) ([]*models.BenchmarkResult, error) {
+// runAppWithIntensity runs the app load test trials along with the benchmark at the given intensity.
+func (run *BenchmarkRun) runAppWithIntensity(
+	ctx context.Context,
+	service string,
+	benchmark models.Benchmark,
+	appIntensity float64,
+	intensity int) ([]*models.BenchmarkResult, *models.BenchmarkStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.New("Benchmark run cancelled: " + err.Error())
+	}
+
+	run.progress.Intensity = intensity
+	run.progress.IntensityStep++
+	run.publishProgress(run.progress)
+	run.ProfileLog.Logger.Infof(
+		"Running benchmark %s at intensity %d along with app load test at intensity %.2f with service %s",
+		benchmark.Name,
+		intensity,
+		appIntensity,
+		service)
+
+	stageId, err := generateId(benchmark.Name)
+	if err != nil {
+		return nil, nil, errors.New("Unable to generate stage id for benchmark " + benchmark.Name + ": " + err.Error())
+	}
+
+	if err = run.BaseBenchmarkRun.runBenchmark(stageId, service, benchmark, intensity); err != nil {
+		run.deleteBenchmark(service, benchmark)
+		return nil, nil, errors.New("Unable to run benchmark " + benchmark.Name + ": " + err.Error())
+	}
+
+	runResults, stats, resultErr := runTrials(run.Trials, run.ProfileLog.Logger, func(trial int) ([]*models.BenchmarkResult, error) {
+		trialId := stageId
+		if trial > 1 {
+			trialId = stageId + "-" + strconv.Itoa(trial)
+		}
+		return run.runApplicationLoadTest(ctx, trialId, appIntensity, intensity, benchmark.Name)
+	})
+	if resultErr != nil {
+		run.deleteBenchmark(service, benchmark)
+		return nil, nil, fmt.Errorf("Unable to run app load test with benchmark %s: %s", benchmark.Name, resultErr.Error())
+	}
+
+	if err := run.deleteBenchmark(service, benchmark); err != nil {
+		return nil, nil, errors.New("Unable to delete benchmark " + benchmark.Name + ": " + err.Error())
+	}
+
+	run.ProfileLog.Logger.Infof("Benchmark %s at intensity %d QoS stats: %+v", benchmark.Name, intensity, *stats)
+	benchmarkStats := &models.BenchmarkStats{
+		Benchmark: benchmark.Name,
+		Intensity: intensity,
+		Stats:     *stats,
+	}
+
+	return runResults, benchmarkStats, nil
+}
+
+// intensitySteps returns the number of intensities run per benchmark, which
+// is the most intensities probed for binary search.
+func (run *BenchmarkRun) intensitySteps() int {
+	span := maxBenchmarkIntensity - run.StartingIntensity
+	if span <= 0 {
+		return 1
+	}
+
+	if run.SearchMode == BinarySearchMode {
+		steps := 2
+		for span > run.Precision && span > 1 {
+			span -= span / 2
+			steps++
+		}
+		return steps
+	}
+
+	if run.Step <= 0 {
+		return 1
+	}
+	return (span+run.Step-1)/run.Step + 1
+}
+
+// isSLOMet returns if the mean QoS at the benchmark intensity meets the app SLO
+// within the run's SLO tolerance. The mean excludes the outliers if they're dropped,
+// and an intensity without any results doesn't meet the SLO.
+func (run *BenchmarkRun) isSLOMet(stats *models.BenchmarkStats) bool {
+	if stats.Stats.Samples == 0 {
+		return false
+	}
+
+	return run.ApplicationConfig.SLO.IsMetWithTolerance(stats.Stats.Mean, run.SloTolerance)
+}
+
+func (run *BenchmarkRun) runAppWithBenchmark(
+	ctx context.Context,
+	service string,
+	benchmark models.Benchmark,
+	appIntensity float64) ([]*models.BenchmarkResult, []*models.BenchmarkStats, error) {
+	if run.SearchMode == BinarySearchMode {
+		return run.searchAppWithBenchmark(ctx, service, benchmark, appIntensity)
+	}
+
 	currentIntensity := run.StartingIntensity
 	results := []*models.BenchmarkResult{}
-
-	counts := 0
+	stats := []*models.BenchmarkStats{}
 
 	for {
-		run.ProfileLog.Logger.Infof(
-			"Running benchmark %s at intensity %d along with app load test at intensity %.2f with service",
-			benchmark.Name,
-			currentIntensity,
-			appIntensity,
-			service)
-
-		stageId, err := generateId(benchmark.Name)
+		runResults, runStats, err := run.runAppWithIntensity(ctx, service, benchmark, appIntensity, currentIntensity)
 		if err != nil {
-			return nil, errors.New("Unable to generate stage id for benchmark " + benchmark.Name + ": " + err.Error())
+			return nil, nil, err
+		}
+
+		for _, result := range runResults {
+			results = append(results, result)
 		}
+		stats = append(stats, runStats)
 
-		if err = run.BaseBenchmarkRun.runBenchmark(stageId, service, benchmark, currentIntensity); err != nil {
-			run.deleteBenchmark(service, benchmark)
-			return nil, errors.New("Unable to run benchmark " + benchmark.Name + ": " + err.Error())
+		if currentIntensity >= maxBenchmarkIntensity {
+			break
 		}
+		currentIntensity += run.Step
+	}
+
+	return results, stats, nil
+}
 
-		runResults, resultErr := run.runApplicationLoadTest(stageId, appIntensity, currentIntensity, benchmark.Name)
-		if resultErr != nil {
-			run.deleteBenchmark(service, benchmark)
-			return nil, fmt.Errorf("Unable to run app load test with benchmark %s: %s", benchmark.Name, resultErr.Error())
+// searchAppWithBenchmark bisects the benchmark intensity between StartingIntensity
+// and 100, until the highest intensity meeting the SLO and the lowest intensity
+// violating it are within Precision. Every probed intensity is returned in the results.
+func (run *BenchmarkRun) searchAppWithBenchmark(
+	ctx context.Context,
+	service string,
+	benchmark models.Benchmark,
+	appIntensity float64) ([]*models.BenchmarkResult, []*models.BenchmarkStats, error) {
+	results := []*models.BenchmarkResult{}
+	stats := []*models.BenchmarkStats{}
+	probe := func(intensity int) (bool, error) {
+		runResults, runStats, err := run.runAppWithIntensity(ctx, service, benchmark, appIntensity, intensity)
+		if err != nil {
+			return false, err
 		}
 
 		for _, result := range runResults {
 			results = append(results, result)
 		}
+		stats = append(stats, runStats)
+
+		return run.isSLOMet(runStats), nil
+	}
 
-		counts += 1
+	low := run.StartingIntensity
+	high := maxBenchmarkIntensity
+	if met, err := probe(low); err != nil {
+		return nil, nil, err
+	} else if !met {
+		run.ProfileLog.Logger.Infof("App violates SLO at starting intensity %d of benchmark %s", low, benchmark.Name)
+		return results, stats, nil
+	}
+
+	if low >= high {
+		return results, stats, nil
+	}
+
+	if met, err := probe(high); err != nil {
+		return nil, nil, err
+	} else if met {
+		run.ProfileLog.Logger.Infof("App meets SLO at max intensity of benchmark %s", benchmark.Name)
+		return results, stats, nil
+	}
 
-		if err := run.deleteBenchmark(service, benchmark); err != nil {
-			return nil, errors.New("Unable to delete benchmark " + benchmark.Name + ": " + err.Error())
+	for high-low > run.Precision {
+		mid := (low + high) / 2
+		met, err := probe(mid)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		if currentIntensity >= 100 {
-			break
+		if met {
+			low = mid
+		} else {
+			high = mid
 		}
-		currentIntensity += run.Step
 	}
 
-	return results, nil
+	run.ProfileLog.Logger.Infof(
+		"Found SLO violation of benchmark %s between intensity %d and %d",
+		benchmark.Name,
+		low,
+		high)
+
+	return results, stats, nil
 }
 
-func (run *BenchmarkRun) Run(deploymentId string) error {
+func (run *BenchmarkRun) Run(ctx context.Context, deploymentId string) error {
 	run.DeploymentId = deploymentId
 	appName := run.ApplicationConfig.Name
-	run.ProfileLog.Logger.Infof("Reading calibration results for app %s", appName)
-	metric, err := run.MetricsDB.GetMetric("calibration", run.ApplicationConfig.Name, &models.CalibrationResults{})
+	calibration, err := run.getCalibration(run.Calibration)
 	if err != nil {
-		return errors.New("Unable to get calibration results for app " + run.ApplicationConfig.Name + ": " + err.Error())
+		return err
 	}
-	calibration := metric.(*models.CalibrationResults)
 
 	// FIXME should support all the load tester includes slow cooker and locust
 	// For now, only benchmark controller works
@@ -316,25 +687,38 @@ func (run *BenchmarkRun) Run(deploymentId string) error {
 		}
 	}
 
-	for _, service := range run.ApplicationConfig.ServiceNames {
+	for serviceIndex, service := range run.ApplicationConfig.ServiceNames {
 		runResults := &models.BenchmarkRunResults{
-			TestId:        run.Id,
-			AppName:       appName,
-			NumServices:   len(run.ApplicationConfig.ServiceNames),
-			Services:      run.ApplicationConfig.ServiceNames,
-			ServiceInTest: service,
-			LoadTester:    calibration.LoadTester,
-			AppCapacity:   calibration.FinalResult.LoadIntensity,
-			SloMetric:     run.ApplicationConfig.SLO.Metric,
-			SloTolerance:  run.SloTolerance,
-			Benchmarks:    []string{},
-			TestResult:    []*models.BenchmarkResult{},
+			TestId:                run.Id,
+			AppName:               appName,
+			NumServices:           len(run.ApplicationConfig.ServiceNames),
+			Services:              run.ApplicationConfig.ServiceNames,
+			ServiceInTest:         service,
+			LoadTester:            calibration.LoadTester,
+			AppCapacity:           calibration.FinalResult.LoadIntensity,
+			SloMetric:             run.ApplicationConfig.SLO.Metric,
+			SloTolerance:          run.SloTolerance,
+			Benchmarks:            []string{},
+			TestResult:            []*models.BenchmarkResult{},
+			TestStats:             []*models.BenchmarkStats{},
+			ToleratedInterference: []*models.ToleratedInterference{},
 		}
 
-		for _, benchmark := range run.Benchmarks {
+		for i, benchmark := range run.Benchmarks {
+			run.progress = jobs.JobProgress{
+				Stage:          "benchmark",
+				Current:        serviceIndex*len(run.Benchmarks) + i + 1,
+				Total:          len(run.ApplicationConfig.ServiceNames) * len(run.Benchmarks),
+				Service:        service,
+				Benchmark:      benchmark.Name,
+				IntensitySteps: run.intensitySteps(),
+			}
+			run.publishProgress(run.progress)
 			run.ProfileLog.Logger.Infof("Starting benchmark runs for app %s with benchmark: %+v", appName, benchmark)
-			results, err := run.runAppWithBenchmark(service, benchmark, calibration.FinalResult.LoadIntensity)
-			if err != nil {
+			results, stats, err := run.runAppWithBenchmark(ctx, service, benchmark, calibration.FinalResult.LoadIntensity)
+			if ctx.Err() != nil {
+				return fmt.Errorf("Benchmark run for app %s cancelled: %s", appName, ctx.Err().Error())
+			} else if err != nil {
 				run.ProfileLog.Logger.Warningf("Unable to run app %s with benchmark %s: %s ", appName, benchmark.Name, err.Error())
 			} else {
 				run.ProfileLog.Logger.Infof("Finished running app %s along with benchmark %s", appName, benchmark.Name)
@@ -343,9 +727,26 @@ func (run *BenchmarkRun) Run(deploymentId string) error {
 			for _, result := range results {
 				runResults.TestResult = append(runResults.TestResult, result)
 			}
+			for _, benchmarkStats := range stats {
+				runResults.TestStats = append(runResults.TestStats, benchmarkStats)
+			}
+
+			if err == nil {
+				toleratedInterference := run.getToleratedInterference(benchmark.Name, stats)
+				run.ProfileLog.Logger.Infof(
+					"App %s tolerates benchmark %s up to intensity %d",
+					appName,
+					benchmark.Name,
+					toleratedInterference.Intensity)
+				runResults.ToleratedInterference = append(runResults.ToleratedInterference, toleratedInterference)
+			}
 		}
+		run.mutex.Lock()
+		run.ToleratedInterference[service] = runResults.ToleratedInterference
+		run.mutex.Unlock()
 
 		run.ProfileLog.Logger.Infof("Storing benchmark results for app %s: %+v", run.ApplicationConfig.Name, runResults.TestResult)
+		runResults.Created = time.Now()
 		if err := run.MetricsDB.WriteMetrics("profiling", runResults); err != nil {
 			message := "Unable to store benchmark results for app " + run.ApplicationConfig.Name + ": " + err.Error()
 			run.ProfileLog.Logger.Warningf(message)
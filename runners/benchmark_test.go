@@ -0,0 +1,75 @@
+package runners
+
+import (
+	"testing"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+)
+
+func TestGetToleratedInterference(t *testing.T) {
+	run := &BenchmarkRun{SloTolerance: 0.1}
+	run.ApplicationConfig = &models.ApplicationConfig{
+		SLO: models.SLO{Metric: "latency", Value: 100, Type: "latency"},
+	}
+	meanQos := func(intensity int, mean float64) *models.BenchmarkStats {
+		return &models.BenchmarkStats{Intensity: intensity, Stats: models.QosStats{Samples: 3, Mean: mean}}
+	}
+
+	toleratedInterference := run.getToleratedInterference("cpu", []*models.BenchmarkStats{
+		meanQos(20, 50), meanQos(60, 80), meanQos(100, 105),
+	})
+	if toleratedInterference.Benchmark != "cpu" || toleratedInterference.Intensity != 100 {
+		t.Errorf("Expected cpu tolerated up to intensity 100 within the SLO tolerance, got %+v", *toleratedInterference)
+	}
+
+	// Binary search probes the intensities out of order.
+	toleratedInterference = run.getToleratedInterference("cpu", []*models.BenchmarkStats{
+		meanQos(20, 50), meanQos(100, 200), meanQos(60, 90), meanQos(80, 120), meanQos(70, 95), meanQos(75, 115),
+	})
+	if toleratedInterference.Intensity != 70 {
+		t.Errorf("Expected cpu tolerated up to intensity 70, got %d", toleratedInterference.Intensity)
+	}
+
+	// Intensities after the first violation aren't tolerated, even if they meet the SLO.
+	toleratedInterference = run.getToleratedInterference("cpu", []*models.BenchmarkStats{
+		meanQos(20, 50), meanQos(40, 80), meanQos(60, 120), meanQos(80, 90),
+	})
+	if toleratedInterference.Intensity != 40 {
+		t.Errorf("Expected cpu tolerated up to intensity 40, got %d", toleratedInterference.Intensity)
+	}
+
+	toleratedInterference = run.getToleratedInterference("cpu", []*models.BenchmarkStats{
+		meanQos(30, 150), meanQos(40, 90),
+	})
+	if toleratedInterference.Intensity != 0 {
+		t.Errorf("Expected no tolerated intensity when the starting intensity violates the SLO, got %d",
+			toleratedInterference.Intensity)
+	}
+
+	toleratedInterference = run.getToleratedInterference("cpu", []*models.BenchmarkStats{
+		meanQos(20, 50), {Intensity: 40},
+	})
+	if toleratedInterference.Intensity != 20 {
+		t.Errorf("Expected an intensity without results not to be tolerated, got %d", toleratedInterference.Intensity)
+	}
+}
+
+func TestIsSLOMetByMeanQos(t *testing.T) {
+	run := &BenchmarkRun{}
+	run.ApplicationConfig = &models.ApplicationConfig{
+		SLO: models.SLO{Metric: "latency", Value: 100, Type: "latency"},
+	}
+
+	// A single slow trial doesn't violate the SLO if the mean QoS meets it.
+	results := []*models.BenchmarkResult{{QosValue: 80}, {QosValue: 85}, {QosValue: 130}}
+	stats := &models.BenchmarkStats{Intensity: 20, Stats: *computeQosStats(results, false)}
+	if !run.isSLOMet(stats) {
+		t.Errorf("Expected mean QoS %f to meet the SLO", stats.Stats.Mean)
+	}
+
+	results = []*models.BenchmarkResult{{QosValue: 90}, {QosValue: 120}, {QosValue: 130}}
+	stats = &models.BenchmarkStats{Intensity: 40, Stats: *computeQosStats(results, false)}
+	if run.isSLOMet(stats) {
+		t.Errorf("Expected mean QoS %f to violate the SLO", stats.Stats.Mean)
+	}
+}
@@ -1,6 +1,7 @@
 package runners
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,9 @@ import (
 
 type CalibrationRun struct {
 	ProfileRun
+
+	// Results is set once the calibration results are stored.
+	Results *models.CalibrationResults
 }
 
 func NewCalibrationRun(
@@ -28,11 +32,24 @@ func NewCalibrationRun(
 		return nil, errors.New("Unable to generate calibration Id: " + err.Error())
 	}
 
+	return newCalibrationRun(id, applicationConfig, config, skipUnreserveOnFailure)
+}
+
+func newCalibrationRun(
+	id string,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	skipUnreserveOnFailure bool) (*CalibrationRun, error) {
 	deployerClient, deployerErr := clients.NewDeployerClient(config)
 	if deployerErr != nil {
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -44,8 +61,11 @@ func NewCalibrationRun(
 			ApplicationConfig:         applicationConfig,
 			DeployerClient:            deployerClient,
 			BenchmarkControllerClient: &clients.BenchmarkControllerClient{},
-			MetricsDB:                 db.NewMetricsDB(config),
+			LocustClient:              &clients.LocustClient{},
+			LocalLoadClient:           &clients.LocalLoadClient{},
+			MetricsDB:                 metricsDB,
 			ProfileLog:                log,
+			Request:                   newJobRequest(CalibrationJobType, applicationConfig, skipUnreserveOnFailure, nil),
 			State:                     "Queued",
 			Created:                   time.Now(),
 			SkipUnreserveOnFailure:    skipUnreserveOnFailure,
@@ -56,7 +76,10 @@ func NewCalibrationRun(
 	return run, nil
 }
 
-func (run *CalibrationRun) runBenchmarkController(runId string, controller *models.BenchmarkController) error {
+func (run *CalibrationRun) runBenchmarkController(
+	ctx context.Context,
+	runId string,
+	controller *models.BenchmarkController) error {
 	loadTesterName := run.ApplicationConfig.LoadTester.Name
 	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
 	if urlErr != nil {
@@ -69,7 +92,7 @@ func (run *CalibrationRun) runBenchmarkController(runId string, controller *mode
 
 	startTime := time.Now()
 	results, err := run.BenchmarkControllerClient.RunCalibration(
-		loadTesterName, url, runId, controller, run.ApplicationConfig.SLO, run.ProfileLog.Logger)
+		ctx, loadTesterName, url, runId, controller, run.ApplicationConfig.SLO, run.ProfileLog.Logger)
 	if err != nil {
 		return errors.New("Unable to run calibration: " + err.Error())
 	}
@@ -108,11 +131,13 @@ func (run *CalibrationRun) runBenchmarkController(runId string, controller *mode
 		TestDuration: time.Since(startTime).String(),
 		TestResults:  testResults,
 		FinalResult:  finalResult,
+		Created:      time.Now(),
 	}
 
 	if err := run.MetricsDB.WriteMetrics("calibration", calibrationResults); err != nil {
 		return errors.New("Unable to store calibration results: " + err.Error())
 	}
+	run.Results = calibrationResults
 
 	if b, err := json.MarshalIndent(calibrationResults, "", "  "); err == nil {
 		run.ProfileLog.Logger.Infof("Store calibration results: %s", string(b))
@@ -121,7 +146,10 @@ func (run *CalibrationRun) runBenchmarkController(runId string, controller *mode
 	return nil
 }
 
-func (run *CalibrationRun) runSlowCookerController(runId string, controller *models.SlowCookerController) error {
+func (run *CalibrationRun) runSlowCookerController(
+	ctx context.Context,
+	runId string,
+	controller *models.SlowCookerController) error {
 	glog.V(1).Infof("Running slow cooker with controller: %+v", controller)
 	loadTesterName := run.ApplicationConfig.LoadTester.Name
 	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
@@ -131,7 +159,7 @@ func (run *CalibrationRun) runSlowCookerController(runId string, controller *mod
 
 	startTime := time.Now()
 	results, err := run.SlowCookerClient.RunCalibration(
-		url, runId, run.ApplicationConfig.SLO, controller, run.ProfileLog.Logger)
+		ctx, url, runId, run.ApplicationConfig.SLO, controller, run.ProfileLog.Logger)
 	if err != nil {
 		return errors.New("Unable to run calibration with slow cooker: " + err.Error())
 	}
@@ -160,11 +188,13 @@ func (run *CalibrationRun) runSlowCookerController(runId string, controller *mod
 		TestDuration: time.Since(startTime).String(),
 		TestResults:  testResults,
 		FinalResult:  finalResult,
+		Created:      time.Now(),
 	}
 
 	if err := run.MetricsDB.WriteMetrics("calibration", calibrationResults); err != nil {
 		return errors.New("Unable to store calibration results: " + err.Error())
 	}
+	run.Results = calibrationResults
 
 	if b, err := json.MarshalIndent(calibrationResults, "", "  "); err == nil {
 		run.ProfileLog.Logger.Infof("Store calibration results: %s", string(b))
@@ -173,16 +203,158 @@ func (run *CalibrationRun) runSlowCookerController(runId string, controller *mod
 	return nil
 }
 
-func (run *CalibrationRun) Run(deploymentId string) error {
+// runLocalLoadController calibrates the app with load generated by the
+// profiler against the app load url.
+func (run *CalibrationRun) runLocalLoadController(
+	ctx context.Context,
+	runId string,
+	controller *models.LocalLoadController) error {
+	startTime := time.Now()
+	results, err := run.LocalLoadClient.RunCalibration(
+		ctx, runId, run.ApplicationConfig.SLO, controller, run.ProfileLog.Logger)
+	if err != nil {
+		return errors.New("Unable to run calibration with local load: " + err.Error())
+	}
+
+	testResults := []models.CalibrationTestResult{}
+	for _, runResult := range results.Results {
+		testResults = append(testResults, models.CalibrationTestResult{
+			QosValue:      float64(runResult.LatencyMs),
+			LoadIntensity: float64(runResult.Concurrency),
+			Failures:      runResult.Failures,
+		})
+	}
+
+	finalResult := &models.CalibrationTestResult{
+		LoadIntensity: float64(results.FinalResult.Concurrency),
+		QosValue:      float64(results.FinalResult.LatencyMs),
+		Failures:      results.FinalResult.Failures,
+	}
+	calibrationResults := &models.CalibrationResults{
+		TestId:       run.Id,
+		AppName:      run.ApplicationConfig.Name,
+		LoadTester:   run.ApplicationConfig.LoadTester.Name,
+		QosMetrics:   []string{run.ApplicationConfig.SLO.Type},
+		TestDuration: time.Since(startTime).String(),
+		TestResults:  testResults,
+		FinalResult:  finalResult,
+		Created:      time.Now(),
+	}
+
+	if err := run.MetricsDB.WriteMetrics("calibration", calibrationResults); err != nil {
+		return errors.New("Unable to store calibration results: " + err.Error())
+	}
+	run.Results = calibrationResults
+
+	if b, err := json.MarshalIndent(calibrationResults, "", "  "); err == nil {
+		run.ProfileLog.Logger.Infof("Store calibration results: %s", string(b))
+	}
+
+	return nil
+}
+
+// runLocustController steps through the locust user counts, and calibrates the
+// app to the highest user count that meets its SLO.
+func (run *CalibrationRun) runLocustController(
+	ctx context.Context,
+	controller *models.LocustController) error {
+	loadTesterName := run.ApplicationConfig.LoadTester.Name
+	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
+	if urlErr != nil {
+		return fmt.Errorf("Unable to retrieve service url [%s]: %s", loadTesterName, urlErr.Error())
+	}
+
+	startTime := time.Now()
+	results, err := run.LocustClient.RunSteps(ctx, url, controller, run.ProfileLog.Logger)
+	if err != nil {
+		return errors.New("Unable to run calibration with locust: " + err.Error())
+	}
+
+	slo := run.ApplicationConfig.SLO
+	testResults := []models.CalibrationTestResult{}
+	var finalResult *models.CalibrationTestResult
+	for _, stepResult := range results {
+		qosValue, err := clients.GetLocustQos(stepResult, slo.Metric)
+		if err != nil {
+			return errors.New("Unable to get calibration qos from locust result: " + err.Error())
+		}
+
+		testResult := models.CalibrationTestResult{
+			LoadIntensity: float64(stepResult.UserCount),
+			QosValue:      qosValue,
+			Failures:      stepResult.Failures,
+		}
+		testResults = append(testResults, testResult)
+		if slo.IsMetWithTolerance(qosValue, 0) {
+			finalResult = &testResult
+		}
+	}
+
+	if finalResult == nil {
+		return fmt.Errorf("App %s doesn't meet its SLO with any locust user count", run.ApplicationConfig.Name)
+	}
+
+	calibrationResults := &models.CalibrationResults{
+		TestId:       run.Id,
+		AppName:      run.ApplicationConfig.Name,
+		LoadTester:   loadTesterName,
+		QosMetrics:   []string{slo.Type},
+		TestDuration: time.Since(startTime).String(),
+		TestResults:  testResults,
+		FinalResult:  finalResult,
+		Created:      time.Now(),
+	}
+
+	if err := run.MetricsDB.WriteMetrics("calibration", calibrationResults); err != nil {
+		return errors.New("Unable to store calibration results: " + err.Error())
+	}
+	run.Results = calibrationResults
+
+	if b, err := json.MarshalIndent(calibrationResults, "", "  "); err == nil {
+		run.ProfileLog.Logger.Infof("Store calibration results: %s", string(b))
+	}
+
+	return nil
+}
+
+func (run *CalibrationRun) Run(ctx context.Context, deploymentId string) error {
 	run.DeploymentId = deploymentId
 	loadTester := run.ApplicationConfig.LoadTester
+	var err error
 	if loadTester.BenchmarkController != nil {
-		return run.runBenchmarkController(run.Id, loadTester.BenchmarkController)
+		run.publishCalibrationProgress("benchmark controller")
+		err = run.runBenchmarkController(ctx, run.Id, loadTester.BenchmarkController)
 	} else if loadTester.SlowCookerController != nil {
-		return run.runSlowCookerController(run.Id, loadTester.SlowCookerController)
+		run.publishCalibrationProgress("slow cooker")
+		err = run.runSlowCookerController(ctx, run.Id, loadTester.SlowCookerController)
+	} else if loadTester.LocustController != nil {
+		run.publishCalibrationProgress("locust")
+		err = run.runLocustController(ctx, loadTester.LocustController)
+	} else if loadTester.LocalLoadController != nil {
+		run.publishCalibrationProgress("local load")
+		err = run.runLocalLoadController(ctx, run.Id, loadTester.LocalLoadController)
+	} else {
+		return errors.New("No controller found in calibration request")
 	}
 
-	return errors.New("No controller found in calibration request")
+	if err == nil && run.Results != nil && run.Results.FinalResult != nil {
+		run.publishProgress(jobs.JobProgress{
+			Stage:   "calibrated",
+			Message: fmt.Sprintf("Calibrated load intensity %.2f", run.Results.FinalResult.LoadIntensity),
+			Current: 1,
+			Total:   1,
+		})
+	}
+
+	return err
+}
+
+func (run *CalibrationRun) publishCalibrationProgress(controller string) {
+	run.publishProgress(jobs.JobProgress{
+		Stage:   "calibration",
+		Message: "Calibrating app with " + controller + " load tester " + run.ApplicationConfig.LoadTester.Name,
+		Total:   1,
+	})
 }
 
 func (run *CalibrationRun) GetResults() <-chan *jobs.JobResults {
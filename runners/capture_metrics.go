@@ -1,6 +1,7 @@
 package runners
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -10,11 +11,21 @@ import (
 	"github.com/golang/glog"
 	"github.com/hyperpilotio/go-utils/log"
 	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/db"
 	"github.com/hyperpilotio/workload-profiler/jobs"
 	"github.com/hyperpilotio/workload-profiler/models"
 	"github.com/spf13/viper"
 )
 
+type captureMetricsRunParameters struct {
+	ServiceName        string                     `json:"serviceName"`
+	LoadTester         models.LoadTester          `json:"loadTester"`
+	Benchmark          *models.Benchmark          `json:"benchmark"`
+	BenchmarkIntensity int                        `json:"benchmarkIntensity"`
+	Duration           string                     `json:"duration"`
+	MetricsSource      models.MetricsSourceConfig `json:"metricsSource"`
+}
+
 type CaptureMetricsRun struct {
 	ProfileRun
 
@@ -25,6 +36,7 @@ type CaptureMetricsRun struct {
 	BenchmarkAgentClient *clients.BenchmarkAgentClient
 	BenchmarkIntensity   int
 	Duration             time.Duration
+	MetricsSource        models.MetricsSourceConfig
 }
 
 func NewCaptureMetricsRun(
@@ -34,6 +46,7 @@ func NewCaptureMetricsRun(
 	benchmark *models.Benchmark,
 	benchmarkIntensity int,
 	duration time.Duration,
+	metricsSource *models.MetricsSourceConfig,
 	skipUnreserveOnFailure bool,
 	config *viper.Viper) (*CaptureMetricsRun, error) {
 	id, err := generateId("cm")
@@ -41,12 +54,59 @@ func NewCaptureMetricsRun(
 		return nil, errors.New("Unable to generate Id for capture metrics run: " + err.Error())
 	}
 
+	return newCaptureMetricsRun(
+		id,
+		applicationConfig,
+		serviceName,
+		loadTester,
+		benchmark,
+		benchmarkIntensity,
+		duration,
+		metricsSource,
+		skipUnreserveOnFailure,
+		config)
+}
+
+func newCaptureMetricsRun(
+	id string,
+	applicationConfig *models.ApplicationConfig,
+	serviceName string,
+	loadTester models.LoadTester,
+	benchmark *models.Benchmark,
+	benchmarkIntensity int,
+	duration time.Duration,
+	metricsSource *models.MetricsSourceConfig,
+	skipUnreserveOnFailure bool,
+	config *viper.Viper) (*CaptureMetricsRun, error) {
+	// The request's metrics source overrides the application's, which defaults
+	// to influx.
+	sourceConfig := models.MetricsSourceConfig{Type: InfluxMetricsSourceType}
+	if metricsSource != nil {
+		sourceConfig = *metricsSource
+	} else if applicationConfig.MetricsSource != nil {
+		sourceConfig = *applicationConfig.MetricsSource
+	}
+
+	parameters := captureMetricsRunParameters{
+		ServiceName:        serviceName,
+		LoadTester:         loadTester,
+		Benchmark:          benchmark,
+		BenchmarkIntensity: benchmarkIntensity,
+		Duration:           duration.String(),
+		MetricsSource:      sourceConfig,
+	}
+
 	deployerClient, deployerErr := clients.NewDeployerClient(config)
 	if deployerErr != nil {
 		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
 	}
 	glog.V(1).Infof("Created new capture metrics run with id: %s", id)
 
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
 	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
 	if logErr != nil {
 		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
@@ -57,7 +117,9 @@ func NewCaptureMetricsRun(
 			Id:                     id,
 			ApplicationConfig:      applicationConfig,
 			DeployerClient:         deployerClient,
+			MetricsDB:              metricsDB,
 			ProfileLog:             log,
+			Request:                newJobRequest(CaptureMetricsJobType, applicationConfig, skipUnreserveOnFailure, parameters),
 			Created:                time.Now(),
 			DirectJob:              false,
 			SkipUnreserveOnFailure: skipUnreserveOnFailure,
@@ -68,11 +130,14 @@ func NewCaptureMetricsRun(
 		BenchmarkAgentClient: clients.NewBenchmarkAgentClient(),
 		BenchmarkIntensity:   benchmarkIntensity,
 		Duration:             duration,
+		MetricsSource:        sourceConfig,
 		Config:               config,
 	}, nil
 }
 
-func (run *CaptureMetricsRun) runSlowCookerController(slowCookerController *models.SlowCookerController) error {
+func (run *CaptureMetricsRun) runSlowCookerController(
+	ctx context.Context,
+	slowCookerController *models.SlowCookerController) error {
 	run.ProfileLog.Logger.Infof("Running slow cooker controller")
 	loadTesterName := run.LoadTester.Name
 	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
@@ -82,6 +147,7 @@ func (run *CaptureMetricsRun) runSlowCookerController(slowCookerController *mode
 
 	client := clients.SlowCookerClient{}
 	_, err := client.RunBenchmark(
+		ctx,
 		url,
 		run.Id,
 		float64(slowCookerController.AppLoad.Concurrency),
@@ -96,6 +162,66 @@ func (run *CaptureMetricsRun) runSlowCookerController(slowCookerController *mode
 	return nil
 }
 
+// runLocustController starts locust with the end user count of the controller,
+// which keeps running until the metrics are captured.
+func (run *CaptureMetricsRun) runLocustController(locustController *models.LocustController) error {
+	run.ProfileLog.Logger.Infof("Running locust controller")
+	url, err := run.getLoadTesterUrl()
+	if err != nil {
+		return err
+	}
+
+	client := clients.LocustClient{}
+	if err := client.Start(url, locustController.EndCount, locustController.HatchRate, run.ProfileLog.Logger); err != nil {
+		return fmt.Errorf("Unable to run load test from locust: " + err.Error())
+	}
+
+	return nil
+}
+
+func (run *CaptureMetricsRun) stopLocustController() {
+	url, err := run.getLoadTesterUrl()
+	if err != nil {
+		run.ProfileLog.Logger.Warningf(err.Error())
+		return
+	}
+
+	client := clients.LocustClient{}
+	if err := client.Stop(url); err != nil {
+		run.ProfileLog.Logger.Warningf(err.Error())
+	}
+}
+
+// runLocalLoadController sends the app load from the profiler in the background
+// for the capture duration, or until ctx is cancelled.
+func (run *CaptureMetricsRun) runLocalLoadController(
+	ctx context.Context,
+	localLoadController *models.LocalLoadController) error {
+	run.ProfileLog.Logger.Infof("Running local load controller")
+	if localLoadController.AppLoad == nil {
+		return errors.New("No app load found in local load controller")
+	}
+
+	go func() {
+		client := clients.LocalLoadClient{}
+		if _, err := client.RunLoad(ctx, localLoadController.AppLoad, run.Duration, run.ProfileLog.Logger); err != nil {
+			run.ProfileLog.Logger.Warningf("Local load stopped: " + err.Error())
+		}
+	}()
+
+	return nil
+}
+
+func (run *CaptureMetricsRun) getLoadTesterUrl() (string, error) {
+	loadTesterName := run.LoadTester.Name
+	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, loadTesterName, run.ProfileLog.Logger)
+	if urlErr != nil {
+		return "", fmt.Errorf("Unable to retrieve service url [%s]: %s", loadTesterName, urlErr.Error())
+	}
+
+	return url, nil
+}
+
 func (run *CaptureMetricsRun) runDemoUiController(DemoUiController *models.DemoUiController) error {
 	run.ProfileLog.Logger.Infof("Running demo ui controller")
 	loadTesterName := run.LoadTester.Name
@@ -111,13 +237,18 @@ func (run *CaptureMetricsRun) runDemoUiController(DemoUiController *models.DemoU
 	return nil
 }
 
-func (run *CaptureMetricsRun) runApplicationLoadTest() error {
+func (run *CaptureMetricsRun) runApplicationLoadTest(ctx context.Context) error {
 	loadTester := run.LoadTester
 	if loadTester.SlowCookerController != nil {
 		return run.runSlowCookerController(
+			ctx,
 			loadTester.SlowCookerController)
 	} else if loadTester.DemoUiController != nil {
 		return run.runDemoUiController(loadTester.DemoUiController)
+	} else if loadTester.LocustController != nil {
+		return run.runLocustController(loadTester.LocustController)
+	} else if loadTester.LocalLoadController != nil {
+		return run.runLocalLoadController(ctx, loadTester.LocalLoadController)
 	}
 
 	return errors.New("No supported load controller found")
@@ -193,7 +324,7 @@ func (run *CaptureMetricsRun) runBenchmark(id string, service string, benchmark
 	return nil
 }
 
-func (run *CaptureMetricsRun) Run(deploymentId string) error {
+func (run *CaptureMetricsRun) Run(ctx context.Context, deploymentId string) error {
 	run.DeploymentId = deploymentId
 
 	if run.Benchmark != nil {
@@ -202,41 +333,110 @@ func (run *CaptureMetricsRun) Run(deploymentId string) error {
 		}
 	}
 
-	if err := run.runApplicationLoadTest(); err != nil {
+	startTime := time.Now()
+	loadCtx, stopLoad := context.WithCancel(ctx)
+	defer stopLoad()
+	if err := run.runApplicationLoadTest(loadCtx); err != nil {
 		return fmt.Errorf("Unable to run load controller: " + err.Error())
 	}
+	if run.LoadTester.LocustController != nil {
+		defer run.stopLocustController()
+	}
 
 	run.ProfileLog.Logger.Infof("Waiting for %s to capture metrics run", run.Duration)
-	time.Sleep(run.Duration)
-	run.ProfileLog.Logger.Infof("Waiting completed, snapshotting influx..")
-	if err := run.snapshotInfluxData(); err != nil {
-		return errors.New("Unable to snapshot influx: " + err.Error())
+	select {
+	case <-time.After(run.Duration):
+	case <-ctx.Done():
+		return errors.New("Capture metrics run cancelled: " + ctx.Err().Error())
+	}
+	endTime := time.Now()
+	source, err := newMetricsSource(
+		run.MetricsSource, run.DeployerClient, run.DeploymentId, run.Config, run.ProfileLog.Logger)
+	if err != nil {
+		return errors.New("Unable to create metrics source: " + err.Error())
+	}
+
+	run.ProfileLog.Logger.Infof("Waiting completed, snapshotting metrics..")
+	if err := run.snapshotMetrics(source, startTime, endTime); err != nil {
+		return errors.New("Unable to snapshot metrics: " + err.Error())
+	}
+
+	if err := run.storeResourceUsage(source, startTime, endTime); err != nil {
+		return errors.New("Unable to compute resource usage: " + err.Error())
 	}
 
 	return nil
 }
 
 func (run *CaptureMetricsRun) getSnapshotId() string {
-	benchmarkName := "None"
+	return run.GetId() + "-" + run.LoadTester.Scenario + "-" + run.getBenchmarkName() + "-" + run.ServiceName
+}
+
+func (run *CaptureMetricsRun) getBenchmarkName() string {
 	if run.Benchmark != nil {
-		benchmarkName = run.Benchmark.Name
+		return run.Benchmark.Name
 	}
-	return run.GetId() + "-" + run.LoadTester.Scenario + "-" + benchmarkName + "-" + run.ServiceName
+	return "None"
 }
 
-func (run *CaptureMetricsRun) snapshotInfluxData() error {
-	loadTesterName := run.ApplicationConfig.LoadTester.Name
-	url, urlErr := run.DeployerClient.GetServiceUrl(run.DeploymentId, "influxsrv", run.ProfileLog.Logger)
-	if urlErr != nil {
-		return fmt.Errorf("Unable to retrieve service url [%s]: %s", loadTesterName, urlErr.Error())
+// storeResourceUsage summarizes the resource usage of the service's pods
+// within the capture window, and stores it against the run id.
+func (run *CaptureMetricsRun) storeResourceUsage(source MetricsSource, startTime time.Time, endTime time.Time) error {
+	usage, err := source.GetResourceUsage(run.ServiceName, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	results := &models.ResourceUsageResults{
+		RunId:       run.Id,
+		AppName:     run.ApplicationConfig.Name,
+		Scenario:    run.LoadTester.Scenario,
+		Benchmark:   run.getBenchmarkName(),
+		ServiceName: run.ServiceName,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Usage:       *usage,
+		Created:     time.Now(),
+	}
+	if err := run.MetricsDB.WriteMetrics("resourceUsage", results); err != nil {
+		return errors.New("Unable to store resource usage: " + err.Error())
+	}
+
+	run.ProfileLog.Logger.Infof("Stored resource usage of service %s: %+v", run.ServiceName, *usage)
+	return nil
+}
+
+// snapshotMetrics exports the metrics of the source within the capture window
+// to the artifact store, and records the artifacts against the run id.
+func (run *CaptureMetricsRun) snapshotMetrics(source MetricsSource, startTime time.Time, endTime time.Time) error {
+	artifactStore, err := db.NewArtifactStore(run.Config)
+	if err != nil {
+		return errors.New("Unable to create artifact store: " + err.Error())
 	}
 
-	influxScriptPath := run.Config.GetString("influxScriptPath")
-	influxClient, err := clients.NewInfluxClient(influxScriptPath, url, 8086, 8088)
+	snapshotId := run.getSnapshotId()
+	artifacts, err := source.Snapshot(snapshotId, startTime, endTime, artifactStore, run.ProfileLog.Logger)
 	if err != nil {
-		return errors.New("Unable to create influx client: " + err.Error())
+		return err
 	}
-	return influxClient.BackupDB(run.getSnapshotId(), run.ProfileLog.Logger)
+
+	snapshot := &models.MetricsSnapshot{
+		RunId:       run.Id,
+		AppName:     run.ApplicationConfig.Name,
+		SnapshotId:  snapshotId,
+		ServiceName: run.ServiceName,
+		Scenario:    run.LoadTester.Scenario,
+		Benchmark:   run.getBenchmarkName(),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Artifacts:   artifacts,
+		Created:     time.Now(),
+	}
+	if err := run.MetricsDB.WriteMetrics("captureMetrics", snapshot); err != nil {
+		return errors.New("Unable to store metrics snapshot: " + err.Error())
+	}
+
+	return nil
 }
 
 func (run *CaptureMetricsRun) GetResults() <-chan *jobs.JobResults {
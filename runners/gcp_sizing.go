@@ -0,0 +1,280 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperpilotio/go-utils/log"
+	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/db"
+	"github.com/hyperpilotio/workload-profiler/jobs"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+type gcpSizingRunParameters struct {
+	Region    string   `json:"region"`
+	Instances []string `json:"instances"`
+}
+
+// GCPSizingRun sizes the app on the machine types of a GCP region, or on the
+// requested machine types. It spawns a GCPSizingSingleRun for each machine
+// type, and stores the results in the same format as the AWS sizing runs.
+type GCPSizingRun struct {
+	AWSSizingRun
+
+	MachineTypeConfig *models.GCPRegionMachineTypeConfig
+	// Instances are the machine types to size, or all the machine types of
+	// the region if it's empty.
+	Instances []string
+}
+
+// GCPSizingSingleRun is a single benchmark run on a GCP machine type. It runs
+// the same load test as an AWS sizing single run, on a cluster deployed with
+// the GCP deployment template. The template sets the GCP region, so the AWS
+// region of the embedded run is left empty.
+type GCPSizingSingleRun struct {
+	*AWSSizingSingleRun
+}
+
+func NewGCPSizingRun(
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	machineTypeConfig *models.GCPRegionMachineTypeConfig,
+	instances []string,
+	skipUnreserveOnFailure bool) (*GCPSizingRun, error) {
+	id, err := generateId("gcpsizing")
+	if err != nil {
+		return nil, errors.New("Unable to generate id: " + err.Error())
+	}
+
+	return newGCPSizingRun(id, jobManager, applicationConfig, config, machineTypeConfig, instances, skipUnreserveOnFailure)
+}
+
+func newGCPSizingRun(
+	id string,
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	machineTypeConfig *models.GCPRegionMachineTypeConfig,
+	instances []string,
+	skipUnreserveOnFailure bool) (*GCPSizingRun, error) {
+	parameters := gcpSizingRunParameters{
+		Region:    machineTypeConfig.Region,
+		Instances: instances,
+	}
+
+	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
+	if logErr != nil {
+		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
+	}
+
+	deployerClient, deployerErr := clients.NewDeployerClient(config)
+	if deployerErr != nil {
+		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
+	}
+
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
+	return &GCPSizingRun{
+		AWSSizingRun: AWSSizingRun{
+			ProfileRun: ProfileRun{
+				Id:                id,
+				ApplicationConfig: applicationConfig,
+				DeployerClient:    deployerClient,
+				MetricsDB:         metricsDB,
+				ProfileLog:        log,
+				Request: newJobRequest(
+					GCPSizingJobType, applicationConfig, skipUnreserveOnFailure, parameters),
+				Created:                time.Now(),
+				SkipUnreserveOnFailure: skipUnreserveOnFailure,
+				DirectJob:              true,
+			},
+			JobManager: jobManager,
+			Config:     config,
+		},
+		MachineTypeConfig: machineTypeConfig,
+		Instances:         instances,
+	}, nil
+}
+
+// getMachineTypes returns the machine types to size, skipping the ones that
+// are too small for the app's service.
+func (run *GCPSizingRun) getMachineTypes() ([]string, error) {
+	log := run.ProfileLog.Logger
+	requested := map[string]bool{}
+	for _, instance := range run.Instances {
+		requested[instance] = true
+	}
+
+	cpuRequirement, memoryRequirement, err := getServiceRequests(run.ApplicationConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	machineTypes := []string{}
+	for _, machineType := range run.MachineTypeConfig.Data {
+		if len(requested) > 0 && !requested[machineType.Name] {
+			continue
+		}
+		delete(requested, machineType.Name)
+
+		maxMemory, err := resource.ParseQuantity(fmt.Sprintf("%0.0fMi", machineType.MemoryGiB*1024))
+		if err != nil {
+			return nil, errors.New("Unable to parse memory quantity: " + err.Error())
+		}
+
+		maxCpu, err := resource.ParseQuantity(fmt.Sprintf("%0.0fm", machineType.VCPU*1000))
+		if err != nil {
+			return nil, errors.New("Unable to parse cpu quantity: " + err.Error())
+		}
+
+		if memoryRequirement > maxMemory.MilliValue() {
+			log.Infof("Skip sizing run on machine type %s: Low memory", machineType.Name)
+			continue
+		}
+		if cpuRequirement > maxCpu.MilliValue() {
+			log.Infof("Skip sizing run on machine type %s: Low Cpu", machineType.Name)
+			continue
+		}
+
+		machineTypes = append(machineTypes, machineType.Name)
+	}
+
+	if len(requested) > 0 {
+		missing := []string{}
+		for instance := range requested {
+			missing = append(missing, instance)
+		}
+		return nil, fmt.Errorf("Unable to find machine types %v in region %s", missing, run.MachineTypeConfig.Region)
+	}
+
+	return machineTypes, nil
+}
+
+func (run *GCPSizingRun) Run(ctx context.Context, deploymentId string) error {
+	log := run.ProfileLog.Logger
+
+	calibration, err := run.getCalibration(run.Calibration)
+	if err != nil {
+		return err
+	}
+
+	machineTypes, err := run.getMachineTypes()
+	if err != nil {
+		return errors.New("Unable to get machine types to size: " + err.Error())
+	}
+
+	log.Infof("Machine types to run in %s: %+v", run.MachineTypeConfig.Region, machineTypes)
+	allInstanceRunResults := &AllInstanceRunResults{
+		RunId:       run.GetId(),
+		AppName:     run.ApplicationConfig.Name,
+		Cloud:       GCPCloud,
+		Region:      run.MachineTypeConfig.Region,
+		TestResults: make(map[string]*InstanceResults),
+		Created:     time.Now(),
+	}
+
+	singleRuns := map[string]*AWSSizingSingleRun{}
+	for _, machineType := range machineTypes {
+		newId := run.GetId() + "-" + machineType
+		newApplicationConfig := &models.ApplicationConfig{}
+		deepCopy(run.ApplicationConfig, newApplicationConfig)
+		singleRun, err := NewGCPSizingSingleRun(
+			newId,
+			machineType,
+			calibration,
+			newApplicationConfig,
+			run.Config,
+			run.IsSkipUnreserveOnFailure())
+		if err != nil {
+			run.cancelSingleRuns(singleRuns)
+			return errors.New("Unable to create GCP single run: " + err.Error())
+		}
+
+		allInstanceRunResults.TestResults[instanceTypeDbName(machineType)] = &InstanceResults{
+			State: GetStateString(RUNNING),
+		}
+		singleRun.SetPriority(run.GetPriority())
+		singleRun.SetUserId(run.Request.UserId)
+		run.JobManager.AddJob(singleRun)
+		singleRuns[machineType] = singleRun.AWSSizingSingleRun
+	}
+
+	startTime := time.Now()
+	finished := 0
+	for machineType, singleRun := range singleRuns {
+		result, err := run.waitSingleRunResults(ctx, singleRun)
+		if err != nil {
+			run.cancelSingleRuns(singleRuns)
+			return errors.New("GCP sizing run cancelled: " + err.Error())
+		}
+		finished++
+		run.publishInstanceProgress(machineType, finished, len(singleRuns), result.Error)
+
+		instanceResults := allInstanceRunResults.TestResults[instanceTypeDbName(machineType)]
+		if result.Error != "" {
+			log.Warningf(
+				"Failed to run gcp single size run with id %s: %s",
+				singleRun.GetId(),
+				result.Error)
+			instanceResults.State = GetStateString(FAILED)
+			instanceResults.QosValue = 0.0
+		} else {
+			instanceResults.State = GetStateString(FINISHED)
+			sizeRunResults := result.Data.(SizeRunResults)
+			qosValue := sizeRunResults.QosValue.Value
+			log.Infof("Received sizing run value %0.2f with machine type %s", qosValue, machineType)
+			instanceResults.QosValue = qosValue
+			instanceResults.Stats = sizeRunResults.Stats
+		}
+		allInstanceRunResults.Duration = time.Since(startTime).String()
+
+		log.Infof("Storing gcp sizing results for app %s", allInstanceRunResults.AppName)
+		if err := run.MetricsDB.UpsertMetrics("allInstance", allInstanceRunResults.RunId, allInstanceRunResults); err != nil {
+			log.Warningf("Unable to store sizing results for app " + allInstanceRunResults.AppName + ": " + err.Error())
+		}
+	}
+
+	log.Infof("GCP sizing run finished for " + run.Id)
+
+	return nil
+}
+
+// NewGCPSizingSingleRun creates a single run on the GCP machine type. The
+// cluster is deployed with the gcp.deploymentTemplate config if it's set, or
+// with the app's deployment template otherwise.
+func NewGCPSizingSingleRun(
+	id string,
+	machineType string,
+	calibration *models.CalibrationResults,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	skipUnreserveOnFailure bool) (*GCPSizingSingleRun, error) {
+	if deploymentTemplate := config.GetString("gcp.deploymentTemplate"); deploymentTemplate != "" {
+		applicationConfig.DeploymentTemplate = deploymentTemplate
+	}
+
+	singleRun, err := NewAWSSizingSingleRun(
+		id,
+		machineType,
+		calibration,
+		applicationConfig,
+		config,
+		skipUnreserveOnFailure)
+	if err != nil {
+		return nil, err
+	}
+
+	singleRun.Request = newJobRequest(GCPSizingSingleJobType, applicationConfig, skipUnreserveOnFailure, nil)
+	return &GCPSizingSingleRun{
+		AWSSizingSingleRun: singleRun,
+	}, nil
+}
@@ -0,0 +1,247 @@
+package runners
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/db"
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+const (
+	InfluxMetricsSourceType     = "influx"
+	PrometheusMetricsSourceType = "prometheus"
+
+	// metricsSnapshotFormat is the format of the snapshot artifacts, which are
+	// gzipped influx line protocol files.
+	metricsSnapshotFormat = "influx-line-protocol+gzip"
+)
+
+// MetricsSource reads the metrics captured during a capture metrics run.
+type MetricsSource interface {
+	// Snapshot exports the metrics within the time range to the artifact store.
+	Snapshot(
+		snapshotId string,
+		startTime time.Time,
+		endTime time.Time,
+		artifactStore db.ArtifactStore,
+		logger *logging.Logger) ([]models.MetricsArtifact, error)
+	// GetResourceUsage summarizes the resource usage of the service's pods
+	// within the time range.
+	GetResourceUsage(serviceName string, startTime time.Time, endTime time.Time) (*models.ResourceUsage, error)
+}
+
+// newMetricsSource creates the metrics source of the config. Sources without
+// a url are reached through their service in the deployment.
+func newMetricsSource(
+	sourceConfig models.MetricsSourceConfig,
+	deployerClient *clients.DeployerClient,
+	deploymentId string,
+	config *viper.Viper,
+	logger *logging.Logger) (MetricsSource, error) {
+	usageConfig, err := GetResourceUsageConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var service string
+	var port int
+	switch sourceConfig.Type {
+	case "", InfluxMetricsSourceType:
+		service, port = "influxsrv", 8086
+	case PrometheusMetricsSourceType:
+		service, port = "prometheus", 9090
+	default:
+		return nil, errors.New("Unsupported metrics source type: " + sourceConfig.Type)
+	}
+
+	if sourceConfig.Service != "" {
+		service = sourceConfig.Service
+	}
+	if sourceConfig.Port > 0 {
+		port = sourceConfig.Port
+	}
+
+	url := sourceConfig.Url
+	if url == "" {
+		serviceUrl, err := deployerClient.GetServiceUrl(deploymentId, service, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to retrieve service url [%s]: %s", service, err.Error())
+		}
+
+		if url, err = clients.ReplaceUrlPort(serviceUrl, port); err != nil {
+			return nil, err
+		}
+	} else if sourceConfig.Port > 0 {
+		if url, err = clients.ReplaceUrlPort(url, port); err != nil {
+			return nil, err
+		}
+	}
+
+	if sourceConfig.Type == PrometheusMetricsSourceType {
+		return &prometheusMetricsSource{
+			client:      clients.NewPrometheusClient(url),
+			usageConfig: usageConfig,
+		}, nil
+	}
+
+	return &influxMetricsSource{
+		client:      clients.NewInfluxClient(url, config.GetString("influx.user"), config.GetString("influx.password")),
+		usageConfig: usageConfig,
+	}, nil
+}
+
+// storeSnapshotArtifact compresses the line protocol written by export, and
+// stores it to the artifact store under the key.
+func storeSnapshotArtifact(
+	artifactStore db.ArtifactStore,
+	key string,
+	export func(w io.Writer) (int, error)) (string, int, error) {
+	tmpFile, err := ioutil.TempFile("", "metrics-snapshot")
+	if err != nil {
+		return "", 0, errors.New("Unable to create temp file: " + err.Error())
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	gzipWriter := gzip.NewWriter(tmpFile)
+	points, err := export(gzipWriter)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return "", 0, errors.New("Unable to compress snapshot: " + err.Error())
+	}
+
+	if _, err := tmpFile.Seek(0, 0); err != nil {
+		return "", 0, errors.New("Unable to read snapshot: " + err.Error())
+	}
+
+	location, err := artifactStore.StoreArtifact(key, tmpFile)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return location, points, nil
+}
+
+type influxMetricsSource struct {
+	client      *clients.InfluxClient
+	usageConfig ResourceUsageConfig
+}
+
+// Snapshot exports every influx database.
+func (source *influxMetricsSource) Snapshot(
+	snapshotId string,
+	startTime time.Time,
+	endTime time.Time,
+	artifactStore db.ArtifactStore,
+	logger *logging.Logger) ([]models.MetricsArtifact, error) {
+	databases, err := source.client.GetDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := []models.MetricsArtifact{}
+	for _, database := range databases {
+		location, points, err := storeSnapshotArtifact(artifactStore, snapshotId+"/"+database+".lp.gz",
+			func(w io.Writer) (int, error) {
+				return source.client.ExportLineProtocol(database, startTime, endTime, w)
+			})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to snapshot influx database %s: %s", database, err.Error())
+		}
+
+		logger.Infof("Stored %d points of influx database %s to %s", points, database, location)
+		artifacts = append(artifacts, models.MetricsArtifact{
+			Database: database,
+			Format:   metricsSnapshotFormat,
+			Location: location,
+			Points:   points,
+		})
+	}
+
+	return artifacts, nil
+}
+
+func (source *influxMetricsSource) GetResourceUsage(
+	serviceName string,
+	startTime time.Time,
+	endTime time.Time) (*models.ResourceUsage, error) {
+	return computeResourceUsage(func(metric resourceMetric) ([]float64, error) {
+		query := metric.influxQuery(source.usageConfig, serviceName, startTime, endTime)
+		return source.client.QuerySeriesSum(source.usageConfig.Database, query)
+	})
+}
+
+type prometheusMetricsSource struct {
+	client      *clients.PrometheusClient
+	usageConfig ResourceUsageConfig
+}
+
+// Snapshot exports the series matching the configured snapshot selectors.
+func (source *prometheusMetricsSource) Snapshot(
+	snapshotId string,
+	startTime time.Time,
+	endTime time.Time,
+	artifactStore db.ArtifactStore,
+	logger *logging.Logger) ([]models.MetricsArtifact, error) {
+	step, _ := time.ParseDuration(source.usageConfig.Interval)
+	location, points, err := storeSnapshotArtifact(artifactStore, snapshotId+"/prometheus.lp.gz",
+		func(w io.Writer) (int, error) {
+			return source.client.ExportLineProtocol(source.usageConfig.SnapshotSelectors, startTime, endTime, step, w)
+		})
+	if err != nil {
+		return nil, errors.New("Unable to snapshot prometheus: " + err.Error())
+	}
+
+	logger.Infof("Stored %d points of prometheus to %s", points, location)
+	return []models.MetricsArtifact{
+		models.MetricsArtifact{
+			Database: "prometheus",
+			Format:   metricsSnapshotFormat,
+			Location: location,
+			Points:   points,
+		},
+	}, nil
+}
+
+// prometheusQuery returns the range query of the metric summed over the pods
+// of the service.
+func (source *prometheusMetricsSource) prometheusQuery(metric resourceMetric, serviceName string) string {
+	// Pods of the service are named after it, e.g: <service>-<hash>-<id>.
+	selector := fmt.Sprintf(`%s{%s=~%s%s}`,
+		metric.PrometheusMetric,
+		source.usageConfig.PodLabel,
+		strconv.Quote(regexp.QuoteMeta(serviceName)+"-.*"),
+		metric.PrometheusFilter)
+	if metric.PrometheusCounter {
+		selector = fmt.Sprintf("rate(%s[%s])", selector, source.usageConfig.RateWindow)
+	}
+
+	// Series are deduplicated per pod and the filter's labels, as the same
+	// usage can be reported by more than one cgroup of a pod.
+	return fmt.Sprintf("sum(max by (%s%s) (%s))%s",
+		source.usageConfig.PodLabel, metric.PrometheusBy, selector, metric.PrometheusScale)
+}
+
+func (source *prometheusMetricsSource) GetResourceUsage(
+	serviceName string,
+	startTime time.Time,
+	endTime time.Time) (*models.ResourceUsage, error) {
+	step, _ := time.ParseDuration(source.usageConfig.Interval)
+	return computeResourceUsage(func(metric resourceMetric) ([]float64, error) {
+		return source.client.QueryRangeValues(source.prometheusQuery(metric, serviceName), startTime, endTime, step)
+	})
+}
@@ -12,19 +12,40 @@ import (
 	"github.com/hyperpilotio/workload-profiler/models"
 )
 
+// Job types recorded in the job requests, used to restore queued jobs after
+// a profiler restart.
+const (
+	CalibrationJobType           = "calibration"
+	BenchmarkJobType             = "benchmark"
+	CaptureMetricsJobType        = "captureMetrics"
+	AWSSizingJobType             = "awsSizing"
+	AWSSizingInstancesJobType    = "awsSizingInstances"
+	AWSSizingAllInstancesJobType = "awsSizingAllInstances"
+	AWSSizingSingleJobType       = "awsSizingSingle"
+	GCPSizingJobType             = "gcpSizing"
+	GCPSizingSingleJobType       = "gcpSizingSingle"
+	PipelineJobType              = "pipeline"
+)
+
 type ProfileRun struct {
 	Id                        string
 	DeployerClient            *clients.DeployerClient
 	BenchmarkControllerClient *clients.BenchmarkControllerClient
 	SlowCookerClient          *clients.SlowCookerClient
+	LocustClient              *clients.LocustClient
+	LocalLoadClient           *clients.LocalLoadClient
 	DeploymentId              string
-	MetricsDB                 *db.MetricsDB
+	MetricsDB                 db.MetricsStore
 	ApplicationConfig         *models.ApplicationConfig
 	ProfileLog                *log.FileLog
+	Request                   jobs.JobRequest
 	State                     string
+	Priority                  int
 	Created                   time.Time
 	SkipUnreserveOnFailure    bool
 	DirectJob                 bool
+	// Events receives the progress of the run, once it's added to the job manager.
+	Events *jobs.JobEvents
 }
 
 func (run *ProfileRun) IsDirectJob() bool {
@@ -43,6 +64,10 @@ func (run *ProfileRun) GetLog() *log.FileLog {
 	return run.ProfileLog
 }
 
+func (run *ProfileRun) GetJobRequest() jobs.JobRequest {
+	return run.Request
+}
+
 func (run *ProfileRun) GetState() string {
 	return run.State
 }
@@ -51,6 +76,14 @@ func (run *ProfileRun) SetState(state string) {
 	run.State = state
 }
 
+func (run *ProfileRun) GetPriority() int {
+	return run.Priority
+}
+
+func (run *ProfileRun) SetPriority(priority int) {
+	run.Priority = priority
+}
+
 func (run *ProfileRun) GetSummary() jobs.JobSummary {
 	return jobs.JobSummary{
 		DeploymentId: run.DeploymentId,
@@ -95,6 +128,71 @@ func (run *ProfileRun) GetColocatedAgentUrls(agent string, service string, place
 	return agentUrls, nil
 }
 
+// SetCalibrationRunId pins the stored calibration results the run uses.
+func (run *ProfileRun) SetCalibrationRunId(calibrationRunId string) {
+	run.Request.CalibrationRunId = calibrationRunId
+}
+
+func (run *ProfileRun) SetJobEvents(events *jobs.JobEvents) {
+	run.Events = events
+}
+
+// publishProgress reports the progress of the run to the subscribers of its events.
+func (run *ProfileRun) publishProgress(progress jobs.JobProgress) {
+	if run.Events != nil {
+		run.Events.PublishProgress(run.Id, progress)
+	}
+}
+
+// SetCallbackUrl sets the url notified when the run finishes or fails.
+func (run *ProfileRun) SetCallbackUrl(callbackUrl string) {
+	run.Request.CallbackUrl = callbackUrl
+}
+
+// SetUserId sets the user the run's clusters are deployed for.
+func (run *ProfileRun) SetUserId(userId string) {
+	run.Request.UserId = userId
+}
+
+// SetPipelineId records the pipeline run the run is a stage of.
+func (run *ProfileRun) SetPipelineId(pipelineId string) {
+	run.Request.PipelineId = pipelineId
+}
+
+// getCalibration returns the given calibration results, or reads the stored
+// calibration results of the app if it's nil. The pinned calibration run's
+// results are read if set, otherwise the latest calibration results.
+func (run *ProfileRun) getCalibration(calibration *models.CalibrationResults) (*models.CalibrationResults, error) {
+	appName := run.ApplicationConfig.Name
+	if calibration != nil {
+		run.ProfileLog.Logger.Infof("Using calibration results from run %s for app %s", calibration.TestId, appName)
+		return calibration, nil
+	}
+
+	if calibrationRunId := run.Request.CalibrationRunId; calibrationRunId != "" {
+		run.ProfileLog.Logger.Infof("Reading calibration results of run %s for app %s", calibrationRunId, appName)
+		metric, err := run.MetricsDB.GetMetricByRunId("calibration", calibrationRunId, &models.CalibrationResults{})
+		if err != nil {
+			return nil, errors.New("Unable to get calibration results of run " + calibrationRunId + ": " + err.Error())
+		}
+
+		calibration := metric.(*models.CalibrationResults)
+		if calibration.AppName != appName {
+			return nil, fmt.Errorf("Calibration run %s is for app %s, not %s", calibrationRunId, calibration.AppName, appName)
+		}
+
+		return calibration, nil
+	}
+
+	run.ProfileLog.Logger.Infof("Reading latest calibration results for app %s", appName)
+	metric, err := run.MetricsDB.GetMetric("calibration", appName, &models.CalibrationResults{})
+	if err != nil {
+		return nil, errors.New("Unable to get calibration results for app " + appName + ": " + err.Error())
+	}
+
+	return metric.(*models.CalibrationResults), nil
+}
+
 type ProfileResults struct {
 	Id           string
 	StageResults []StageResult
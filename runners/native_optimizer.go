@@ -0,0 +1,505 @@
+package runners
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+)
+
+const (
+	// gpLengthScale is the length scale of the gaussian process kernel over the
+	// normalized instance type features.
+	gpLengthScale = 0.5
+	// gpNoise is the noise variance of the standardized log performance.
+	gpNoise = 0.01
+)
+
+type optimizerCandidate struct {
+	InstanceType string
+	HourlyCost   float64
+	// Features are the log vCPU, memory, network bandwidth and hourly cost of
+	// the instance type, normalized to [0, 1] over all candidates.
+	Features []float64
+}
+
+// NativeOptimizer searches the instance types of a region in process, with
+// bayesian optimization over their vCPU, memory, network bandwidth and hourly
+// cost. After an initial set of instance types spread over the search space,
+// a gaussian process models the app's log performance on the instance types
+// sized so far, and the instance types with the highest expected improvement
+// of performance per dollar, weighted by their probability to meet the SLO,
+// are sized next.
+type NativeOptimizer struct {
+	Config OptimizerConfig
+	SLO    models.SLO
+
+	candidates []optimizerCandidate
+	// performances are the performances of the instance types sized, which are
+	// higher for better QoS values.
+	performances map[string]float64
+	suggested    map[string]bool
+}
+
+// NewNativeOptimizer creates an optimizer searching the node types with an on
+// demand price, except the excluded instance types.
+func NewNativeOptimizer(
+	config OptimizerConfig,
+	slo models.SLO,
+	nodeTypes []models.AWSNodeType,
+	excluded []string) *NativeOptimizer {
+	excludedTypes := map[string]bool{}
+	for _, instanceType := range excluded {
+		excludedTypes[instanceType] = true
+	}
+
+	candidates := []optimizerCandidate{}
+	for _, nodeType := range nodeTypes {
+		hourlyCost := nodeType.HourlyCost.HourlyPrice(models.OnDemandPricing)
+		if excludedTypes[nodeType.Name] || hourlyCost <= 0 {
+			continue
+		}
+
+		memory := float64(nodeType.MemoryConfig.Size.Value)
+		if nodeType.MemoryConfig.Size.Unit == "MiB" {
+			memory /= 1024
+		}
+
+		candidates = append(candidates, optimizerCandidate{
+			InstanceType: nodeType.Name,
+			HourlyCost:   hourlyCost,
+			Features: []float64{
+				math.Log2(1 + float64(nodeType.CpuConfig.VCPU)),
+				math.Log2(1 + memory),
+				math.Log2(1 + float64(nodeType.NetworkConfig.Bandwidth)),
+				math.Log2(hourlyCost),
+			},
+		})
+	}
+	normalizeFeatures(candidates)
+
+	return &NativeOptimizer{
+		Config:       config,
+		SLO:          slo,
+		candidates:   candidates,
+		performances: make(map[string]float64),
+		suggested:    make(map[string]bool),
+	}
+}
+
+// normalizeFeatures scales every feature to [0, 1], and features that are the
+// same for all candidates to 0.
+func normalizeFeatures(candidates []optimizerCandidate) {
+	if len(candidates) == 0 {
+		return
+	}
+
+	for i := range candidates[0].Features {
+		min := math.Inf(1)
+		max := math.Inf(-1)
+		for _, candidate := range candidates {
+			min = math.Min(min, candidate.Features[i])
+			max = math.Max(max, candidate.Features[i])
+		}
+
+		for _, candidate := range candidates {
+			if max > min {
+				candidate.Features[i] = (candidate.Features[i] - min) / (max - min)
+			} else {
+				candidate.Features[i] = 0
+			}
+		}
+	}
+}
+
+// GetNextInstanceTypes records the results of the previous round and returns
+// the instance types to size next. Instance types with a QoS value of 0 failed
+// to run and are not suggested again.
+func (optimizer *NativeOptimizer) GetNextInstanceTypes(
+	ctx context.Context,
+	runId string,
+	appName string,
+	results map[string]float64,
+	logger *logging.Logger) ([]string, error) {
+	for instanceType, qosValue := range results {
+		if qosValue <= 0 {
+			continue
+		}
+		optimizer.performances[instanceType] = instancePerformance(optimizer.SLO, qosValue)
+	}
+
+	remaining := optimizer.Config.MaxRuns - len(optimizer.suggested)
+	untried := []optimizerCandidate{}
+	for _, candidate := range optimizer.candidates {
+		if !optimizer.suggested[candidate.InstanceType] {
+			untried = append(untried, candidate)
+		}
+	}
+
+	if remaining <= 0 || len(untried) == 0 {
+		logger.Infof("Optimizer sized %d instance types, stopping search", len(optimizer.suggested))
+		return []string{}, nil
+	}
+
+	var instanceTypes []string
+	if missing := optimizer.Config.InitialSamples - len(optimizer.performances); missing > 0 {
+		instanceTypes = optimizer.initialInstanceTypes(untried, minInt(missing, remaining))
+		logger.Infof("Optimizer suggesting initial instance types %v", instanceTypes)
+	} else {
+		instanceTypes = optimizer.bestInstanceTypes(untried, minInt(optimizer.Config.BatchSize, remaining), logger)
+	}
+
+	for _, instanceType := range instanceTypes {
+		optimizer.suggested[instanceType] = true
+	}
+
+	return instanceTypes, nil
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// initialInstanceTypes picks instance types spread over the search space: the
+// one closest to the center first, and then the ones farthest from the
+// instance types sized or picked so far.
+func (optimizer *NativeOptimizer) initialInstanceTypes(untried []optimizerCandidate, count int) []string {
+	picked := [][]float64{}
+	for _, candidate := range optimizer.candidates {
+		if optimizer.suggested[candidate.InstanceType] {
+			picked = append(picked, candidate.Features)
+		}
+	}
+
+	center := make([]float64, len(untried[0].Features))
+	for i := range center {
+		center[i] = 0.5
+	}
+
+	instanceTypes := []string{}
+	used := map[string]bool{}
+	for len(instanceTypes) < count && len(instanceTypes) < len(untried) {
+		bestIndex := -1
+		bestDistance := 0.0
+		for i, candidate := range untried {
+			if used[candidate.InstanceType] {
+				continue
+			}
+
+			var distance float64
+			if len(picked) == 0 {
+				distance = -squaredDistance(candidate.Features, center)
+			} else {
+				distance = math.Inf(1)
+				for _, features := range picked {
+					distance = math.Min(distance, squaredDistance(candidate.Features, features))
+				}
+			}
+
+			if bestIndex < 0 || distance > bestDistance {
+				bestIndex = i
+				bestDistance = distance
+			}
+		}
+
+		candidate := untried[bestIndex]
+		used[candidate.InstanceType] = true
+		picked = append(picked, candidate.Features)
+		instanceTypes = append(instanceTypes, candidate.InstanceType)
+	}
+
+	return instanceTypes
+}
+
+type scoredCandidate struct {
+	Candidate   optimizerCandidate
+	Acquisition float64
+	// LogPerformance is the predicted mean of the candidate's log performance.
+	LogPerformance float64
+}
+
+type byAcquisition []scoredCandidate
+
+func (s byAcquisition) Len() int      { return len(s) }
+func (s byAcquisition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byAcquisition) Less(i, j int) bool {
+	if s[i].Acquisition != s[j].Acquisition {
+		return s[i].Acquisition > s[j].Acquisition
+	}
+	return s[i].Candidate.InstanceType < s[j].Candidate.InstanceType
+}
+
+// bestInstanceTypes returns the untried instance types with the highest
+// acquisition. The search stops, returning no instance types, once the best
+// acquisition is below the min improvement. Every instance type picked in a
+// batch is assumed to perform as predicted when picking the next one, so the
+// batch doesn't pick similar instance types.
+func (optimizer *NativeOptimizer) bestInstanceTypes(
+	untried []optimizerCandidate,
+	count int,
+	logger *logging.Logger) []string {
+	observations := []optimizerCandidate{}
+	values := []float64{}
+	for _, candidate := range optimizer.candidates {
+		if performance, ok := optimizer.performances[candidate.InstanceType]; ok {
+			observations = append(observations, candidate)
+			values = append(values, math.Log(performance))
+		}
+	}
+
+	// The best log performance per dollar of the instance types meeting the
+	// SLO, or of all sized instance types if none meets it yet.
+	threshold := optimizer.sloThreshold()
+	bestValue := math.Inf(-1)
+	for _, sloMet := range []bool{true, false} {
+		for i, candidate := range observations {
+			if !sloMet || threshold <= 0 || math.Exp(values[i]) >= threshold {
+				bestValue = math.Max(bestValue, values[i]-math.Log(candidate.HourlyCost))
+			}
+		}
+		if !math.IsInf(bestValue, -1) {
+			break
+		}
+	}
+
+	instanceTypes := []string{}
+	for len(instanceTypes) < count && len(untried) > 0 {
+		scored := optimizer.scoreCandidates(observations, values, untried, bestValue)
+		sort.Sort(byAcquisition(scored))
+		best := scored[0]
+		if best.Acquisition < optimizer.Config.MinImprovement {
+			if len(instanceTypes) == 0 {
+				logger.Infof("Optimizer best expected improvement %0.4f of %s is below %0.4f, stopping search",
+					best.Acquisition, best.Candidate.InstanceType, optimizer.Config.MinImprovement)
+			}
+			break
+		}
+
+		logger.Infof("Optimizer suggesting %s with expected improvement %0.4f",
+			best.Candidate.InstanceType, best.Acquisition)
+		instanceTypes = append(instanceTypes, best.Candidate.InstanceType)
+		observations = append(observations, best.Candidate)
+		values = append(values, best.LogPerformance)
+		untried = removeCandidate(untried, best.Candidate.InstanceType)
+	}
+
+	return instanceTypes
+}
+
+// sloThreshold returns the performance meeting the SLO exactly, or 0 if the
+// app has no SLO value.
+func (optimizer *NativeOptimizer) sloThreshold() float64 {
+	if optimizer.SLO.Value <= 0 {
+		return 0
+	}
+	return instancePerformance(optimizer.SLO, optimizer.SLO.Value)
+}
+
+// scoreCandidates fits a gaussian process to the observed log performances
+// and scores the untried candidates by the expected improvement of their log
+// performance per dollar over the best value, times their probability to
+// meet the SLO.
+func (optimizer *NativeOptimizer) scoreCandidates(
+	observations []optimizerCandidate,
+	values []float64,
+	untried []optimizerCandidate,
+	bestValue float64) []scoredCandidate {
+	mean, std := meanStd(values)
+	standardized := make([]float64, len(values))
+	for i, value := range values {
+		standardized[i] = (value - mean) / std
+	}
+
+	gp := newGaussianProcess(observations, standardized)
+	threshold := optimizer.sloThreshold()
+	scored := []scoredCandidate{}
+	for _, candidate := range untried {
+		predictedMean, predictedStd := gp.Predict(candidate.Features)
+		logPerformance := predictedMean*std + mean
+		logStd := predictedStd * std
+
+		logValue := logPerformance - math.Log(candidate.HourlyCost)
+		acquisition := expectedImprovement(logValue, logStd, bestValue)
+		if threshold > 0 {
+			acquisition *= normalCdf((logPerformance - math.Log(threshold)) / logStd)
+		}
+
+		scored = append(scored, scoredCandidate{
+			Candidate:      candidate,
+			Acquisition:    acquisition,
+			LogPerformance: logPerformance,
+		})
+	}
+
+	return scored
+}
+
+func removeCandidate(candidates []optimizerCandidate, instanceType string) []optimizerCandidate {
+	remaining := []optimizerCandidate{}
+	for _, candidate := range candidates {
+		if candidate.InstanceType != instanceType {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
+
+func meanStd(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	std := math.Sqrt(variance / float64(len(values)))
+	if std == 0 {
+		std = 1
+	}
+
+	return mean, std
+}
+
+func squaredDistance(a []float64, b []float64) float64 {
+	distance := 0.0
+	for i := range a {
+		distance += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return distance
+}
+
+func normalCdf(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+func normalPdf(z float64) float64 {
+	return math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+}
+
+// expectedImprovement returns the expected improvement over the best value of
+// a normally distributed value.
+func expectedImprovement(mean float64, std float64, best float64) float64 {
+	if std <= 0 {
+		return math.Max(mean-best, 0)
+	}
+
+	z := (mean - best) / std
+	return (mean-best)*normalCdf(z) + std*normalPdf(z)
+}
+
+// gaussianProcess is a gaussian process regression with a squared
+// exponential kernel and unit signal variance.
+type gaussianProcess struct {
+	features [][]float64
+	// cholesky is the lower cholesky factor of the noisy kernel matrix, and
+	// alpha the kernel matrix inverse times the observed values.
+	cholesky [][]float64
+	alpha    []float64
+}
+
+func kernel(a []float64, b []float64) float64 {
+	return math.Exp(-squaredDistance(a, b) / (2 * gpLengthScale * gpLengthScale))
+}
+
+func newGaussianProcess(observations []optimizerCandidate, values []float64) *gaussianProcess {
+	n := len(observations)
+	features := make([][]float64, n)
+	matrix := make([][]float64, n)
+	for i, observation := range observations {
+		features[i] = observation.Features
+		matrix[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			matrix[i][j] = kernel(features[i], features[j])
+		}
+		matrix[i][i] += gpNoise
+	}
+
+	cholesky := choleskyDecompose(matrix)
+	return &gaussianProcess{
+		features: features,
+		cholesky: cholesky,
+		alpha:    solveUpperTransposed(cholesky, solveLower(cholesky, values)),
+	}
+}
+
+// Predict returns the mean and standard deviation of the value at features.
+func (gp *gaussianProcess) Predict(features []float64) (float64, float64) {
+	covariances := make([]float64, len(gp.features))
+	mean := 0.0
+	for i, observed := range gp.features {
+		covariances[i] = kernel(features, observed)
+		mean += covariances[i] * gp.alpha[i]
+	}
+
+	v := solveLower(gp.cholesky, covariances)
+	variance := 1.0
+	for _, value := range v {
+		variance -= value * value
+	}
+
+	return mean, math.Sqrt(math.Max(variance, 1e-9))
+}
+
+// choleskyDecompose returns the lower triangular L with L * L^T = matrix, for
+// a symmetric positive definite matrix.
+func choleskyDecompose(matrix [][]float64) [][]float64 {
+	n := len(matrix)
+	lower := make([][]float64, n)
+	for i := range lower {
+		lower[i] = make([]float64, n)
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := matrix[i][j]
+			for k := 0; k < j; k++ {
+				sum -= lower[i][k] * lower[j][k]
+			}
+
+			if i == j {
+				lower[i][j] = math.Sqrt(math.Max(sum, 1e-12))
+			} else {
+				lower[i][j] = sum / lower[j][j]
+			}
+		}
+	}
+
+	return lower
+}
+
+// solveLower solves L * x = b by forward substitution.
+func solveLower(lower [][]float64, b []float64) []float64 {
+	x := make([]float64, len(b))
+	for i := range b {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= lower[i][k] * x[k]
+		}
+		x[i] = sum / lower[i][i]
+	}
+	return x
+}
+
+// solveUpperTransposed solves L^T * x = b by back substitution.
+func solveUpperTransposed(lower [][]float64, b []float64) []float64 {
+	n := len(b)
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		sum := b[i]
+		for k := i + 1; k < n; k++ {
+			sum -= lower[k][i] * x[k]
+		}
+		x[i] = sum / lower[i][i]
+	}
+	return x
+}
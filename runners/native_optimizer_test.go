@@ -0,0 +1,165 @@
+package runners
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+)
+
+var optimizerTestNodeTypes = []models.AWSNodeType{
+	{
+		Name:          "c4.large",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 0.1},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 2},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 3.75, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 0.5},
+	},
+	{
+		Name:          "c4.2xlarge",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 0.398},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 8},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 15, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 1},
+	},
+	{
+		Name:          "c4.8xlarge",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 1.591},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 36},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 60, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 10},
+	},
+	{
+		Name:          "m4.large",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 0.1},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 2},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 8, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 0.45},
+	},
+	{
+		Name:          "m4.2xlarge",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 0.4},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 8},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 32, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 1},
+	},
+	{
+		Name:          "m4.10xlarge",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 2},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 40},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 160, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 10},
+	},
+	{
+		Name:          "r4.large",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 0.133},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 2},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 15616, Unit: "MiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 10},
+	},
+	{
+		Name:          "r4.4xlarge",
+		HourlyCost:    models.AWSCost{LinuxOnDemand: 1.064},
+		CpuConfig:     models.AWSCPUConfig{VCPU: 16},
+		MemoryConfig:  models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 122, Unit: "GiB"}},
+		NetworkConfig: models.AWSNetworkConfig{Bandwidth: 10},
+	},
+	{
+		// Instance types without an on-demand price can't be compared by cost.
+		Name:         "x1.32xlarge",
+		CpuConfig:    models.AWSCPUConfig{VCPU: 128},
+		MemoryConfig: models.AWSMemoryConfig{Size: models.AWSMemorySize{Value: 1952, Unit: "GiB"}},
+	},
+}
+
+func TestNativeOptimizerInitialInstanceTypes(t *testing.T) {
+	slo := models.SLO{Metric: "throughput", Value: 1000, Type: models.ThroughputSLOType}
+	logger := logging.MustGetLogger("native_optimizer_test")
+	config := OptimizerConfig{InitialSamples: 3, BatchSize: 2, MaxRuns: 6}
+	optimizer := NewNativeOptimizer(config, slo, optimizerTestNodeTypes, []string{"c4.8xlarge"})
+	if len(optimizer.candidates) != 7 {
+		t.Errorf("Expected excluded and unpriced instance types not to be candidates, got %d candidates",
+			len(optimizer.candidates))
+	}
+
+	instanceTypes, err := optimizer.GetNextInstanceTypes(context.Background(), "run", "app", map[string]float64{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The instance type closest to the center of the search space comes first,
+	// and then the ones farthest from the instance types picked before.
+	if expected := []string{"m4.2xlarge", "m4.10xlarge", "r4.large"}; !reflect.DeepEqual(instanceTypes, expected) {
+		t.Errorf("Expected initial instance types %v, got %v", expected, instanceTypes)
+	}
+
+	// A failed instance type doesn't count as sampled, so another initial
+	// instance type is suggested instead.
+	instanceTypes, err = optimizer.GetNextInstanceTypes(context.Background(), "run", "app", map[string]float64{
+		"m4.2xlarge":  1400,
+		"r4.large":    0,
+		"m4.10xlarge": 5000,
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"c4.large"}; !reflect.DeepEqual(instanceTypes, expected) {
+		t.Errorf("Expected initial instance types %v, got %v", expected, instanceTypes)
+	}
+}
+
+func TestNativeOptimizerGuidedInstanceTypes(t *testing.T) {
+	slo := models.SLO{Metric: "throughput", Value: 1000, Type: models.ThroughputSLOType}
+	logger := logging.MustGetLogger("native_optimizer_test")
+	optimizer := NewNativeOptimizer(
+		OptimizerConfig{InitialSamples: 3, BatchSize: 2, MaxRuns: 6}, slo, optimizerTestNodeTypes, nil)
+
+	suggested := map[string]bool{}
+	results := map[string]float64{}
+	for round := 1; ; round++ {
+		instanceTypes, err := optimizer.GetNextInstanceTypes(context.Background(), "run", "app", results, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(instanceTypes) == 0 {
+			break
+		}
+		if round > 1 && len(instanceTypes) > 2 {
+			t.Errorf("Expected at most a batch of 2 instance types, got %v", instanceTypes)
+		}
+
+		results = map[string]float64{}
+		for _, instanceType := range instanceTypes {
+			if suggested[instanceType] {
+				t.Errorf("Expected %s to be suggested once", instanceType)
+			}
+			suggested[instanceType] = true
+			// Throughput grows with the vCPUs of the instance type.
+			for _, nodeType := range optimizerTestNodeTypes {
+				if nodeType.Name == instanceType {
+					results[instanceType] = 300 * float64(nodeType.CpuConfig.VCPU)
+				}
+			}
+		}
+	}
+
+	if len(suggested) > 6 {
+		t.Errorf("Expected at most 6 instance types sized, got %d", len(suggested))
+	}
+	if suggested["x1.32xlarge"] {
+		t.Error("Expected unpriced instance type not to be suggested")
+	}
+
+	// The search stops once no instance type is expected to improve enough.
+	optimizer = NewNativeOptimizer(
+		OptimizerConfig{InitialSamples: 1, BatchSize: 2, MaxRuns: 6, MinImprovement: 100}, slo, optimizerTestNodeTypes, nil)
+	instanceTypes, _ := optimizer.GetNextInstanceTypes(context.Background(), "run", "app", map[string]float64{}, logger)
+	instanceTypes, _ = optimizer.GetNextInstanceTypes(context.Background(), "run", "app", map[string]float64{
+		instanceTypes[0]: 2000,
+	}, logger)
+	if len(instanceTypes) != 0 {
+		t.Errorf("Expected search to stop below the min improvement, got %v", instanceTypes)
+	}
+}
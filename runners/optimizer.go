@@ -0,0 +1,128 @@
+package runners
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/glog"
+	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/db"
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+const (
+	AnalyzerOptimizerType = "analyzer"
+	NativeOptimizerType   = "native"
+)
+
+// InstanceTypeOptimizer suggests the instance types an AWS sizing run sizes
+// the app on next, given the QoS values of the instance types sized in the
+// previous round. No instance types are returned once the optimizer has
+// found the best instance type.
+type InstanceTypeOptimizer interface {
+	GetNextInstanceTypes(
+		ctx context.Context,
+		runId string,
+		appName string,
+		results map[string]float64,
+		logger *logging.Logger) ([]string, error)
+}
+
+// OptimizerConfig configures the instance type optimizer of AWS sizing runs,
+// which is either the analyzer service (the default) or the native optimizer.
+// The other fields only configure the native optimizer.
+type OptimizerConfig struct {
+	Type string `mapstructure:"type"`
+	// Region is the region of the instance types searched.
+	Region string `mapstructure:"region"`
+	// InitialSamples is the number of instance types spread over the search
+	// space that are sized before the search is guided by the results.
+	InitialSamples int `mapstructure:"initialSamples"`
+	// BatchSize is the number of instance types suggested in every round.
+	BatchSize int `mapstructure:"batchSize"`
+	// MaxRuns bounds the instance types sized by a run.
+	MaxRuns int `mapstructure:"maxRuns"`
+	// MinImprovement stops the search once the expected relative improvement
+	// of performance per dollar of every remaining instance type is below it.
+	MinImprovement float64 `mapstructure:"minImprovement"`
+}
+
+// GetOptimizerConfig reads the optimizer config.
+func GetOptimizerConfig(config *viper.Viper) (OptimizerConfig, error) {
+	optimizerConfig := OptimizerConfig{}
+	if err := config.UnmarshalKey("optimizer", &optimizerConfig); err != nil {
+		return optimizerConfig, errors.New("Unable to parse optimizer config: " + err.Error())
+	}
+
+	if optimizerConfig.Region == "" {
+		optimizerConfig.Region = "us-east-1"
+	}
+	if optimizerConfig.InitialSamples <= 0 {
+		optimizerConfig.InitialSamples = 3
+	}
+	if optimizerConfig.BatchSize <= 0 {
+		optimizerConfig.BatchSize = 2
+	}
+	if optimizerConfig.MaxRuns <= 0 {
+		optimizerConfig.MaxRuns = 12
+	}
+	if optimizerConfig.MinImprovement <= 0 {
+		optimizerConfig.MinImprovement = 0.05
+	}
+
+	return optimizerConfig, nil
+}
+
+// newInstanceTypeOptimizer creates the optimizer of the config for the app.
+// The native optimizer searches the node types of the run's region, or of the
+// configured region if the run has none, leaving out the previous generation
+// instance types.
+func newInstanceTypeOptimizer(
+	config *viper.Viper,
+	applicationConfig *models.ApplicationConfig,
+	region string) (InstanceTypeOptimizer, error) {
+	optimizerConfig, err := GetOptimizerConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if region != "" {
+		optimizerConfig.Region = region
+	}
+
+	switch optimizerConfig.Type {
+	case "", AnalyzerOptimizerType:
+		analyzerClient, err := clients.NewAnalyzerClient(config)
+		if err != nil {
+			return nil, errors.New("Unable to create analyzer client: " + err.Error())
+		}
+		return analyzerClient, nil
+	case NativeOptimizerType:
+		configDB, err := db.NewConfigStore(config)
+		if err != nil {
+			return nil, errors.New("Unable to create config store: " + err.Error())
+		}
+
+		nodeTypeConfig, err := configDB.GetNodeTypeConfig(optimizerConfig.Region)
+		if err != nil {
+			return nil, errors.New("Unable to get node types of " + optimizerConfig.Region + ": " + err.Error())
+		}
+
+		previousGenerations := []string{}
+		previousGeneration, err := configDB.GetPreviousGenerationConfig(optimizerConfig.Region)
+		if err != nil {
+			glog.Warningf("Unable to get previous generations of %s, searching all node types: %s",
+				optimizerConfig.Region, err.Error())
+		} else {
+			for _, nodeType := range previousGeneration.Data {
+				previousGenerations = append(previousGenerations, nodeType.Name)
+			}
+		}
+
+		return NewNativeOptimizer(optimizerConfig, applicationConfig.SLO, nodeTypeConfig.Data, previousGenerations), nil
+	}
+
+	return nil, errors.New("Unsupported optimizer type: " + optimizerConfig.Type)
+}
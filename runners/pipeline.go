@@ -0,0 +1,475 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperpilotio/go-utils/log"
+	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/db"
+	"github.com/hyperpilotio/workload-profiler/jobs"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+const (
+	PIPELINE_STAGE_PENDING = "PENDING"
+
+	pipelineStagePollInterval = 10 * time.Second
+)
+
+type pipelineRunParameters struct {
+	Stages      []*models.PipelineStageStatus `json:"stages"`
+	Calibration *models.CalibrationResults    `json:"calibration"`
+}
+
+// PipelineRun runs a sequence of profiling stages for an app. Each stage is
+// queued as its own run once the previous stage finished, and consumes the
+// calibration results of the pipeline's calibration stage. The pipeline stops
+// at the first failed stage, and can be resumed from it with a new pipeline run.
+type PipelineRun struct {
+	ProfileRun
+
+	Config     *viper.Viper
+	JobManager *jobs.JobManager
+	ConfigDB   db.ConfigStore
+	Stages     []*models.PipelineStageStatus
+	// Calibration is the output of the calibration stage.
+	Calibration *models.CalibrationResults
+	mutex       sync.Mutex
+}
+
+func NewPipelineRun(
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	stages []models.PipelineStage,
+	skipUnreserveOnFailure bool) (*PipelineRun, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("No pipeline stages found")
+	}
+
+	stageStatuses := []*models.PipelineStageStatus{}
+	for i, stage := range stages {
+		if err := validatePipelineStage(stage); err != nil {
+			return nil, fmt.Errorf("Invalid pipeline stage %d: %s", i, err.Error())
+		}
+
+		stageStatuses = append(stageStatuses, &models.PipelineStageStatus{
+			Stage: stage,
+			State: PIPELINE_STAGE_PENDING,
+		})
+	}
+
+	id, err := generateId("pipeline")
+	if err != nil {
+		return nil, errors.New("Unable to generate id: " + err.Error())
+	}
+
+	return newPipelineRun(id, jobManager, applicationConfig, config, stageStatuses, nil, skipUnreserveOnFailure)
+}
+
+// NewResumedPipelineRun creates a pipeline run that resumes a failed or cancelled
+// pipeline from the given stage, reusing the outputs of the stages before it.
+// If fromStage is negative, the pipeline resumes from its first unfinished stage.
+func NewResumedPipelineRun(previous *PipelineRun, fromStage int) (*PipelineRun, error) {
+	if state := previous.GetState(); state != jobs.JOB_FAILED && state != jobs.JOB_CANCELLED {
+		return nil, fmt.Errorf("Unable to resume pipeline %s in %s state", previous.GetId(), state)
+	}
+
+	previousStages := previous.GetStages()
+	if fromStage < 0 {
+		for i, stage := range previousStages {
+			if stage.State != jobs.JOB_FINISHED {
+				fromStage = i
+				break
+			}
+		}
+	}
+
+	if fromStage < 0 || fromStage >= len(previousStages) {
+		return nil, fmt.Errorf("Invalid stage %d to resume pipeline %s from", fromStage, previous.GetId())
+	}
+
+	stageStatuses := []*models.PipelineStageStatus{}
+	for i, stage := range previousStages {
+		status := stage
+		if i >= fromStage {
+			status = models.PipelineStageStatus{
+				Stage: stage.Stage,
+				State: PIPELINE_STAGE_PENDING,
+			}
+		} else if stage.State != jobs.JOB_FINISHED {
+			return nil, fmt.Errorf("Unable to resume from stage %d, stage %d is not finished", fromStage, i)
+		}
+		stageStatuses = append(stageStatuses, &status)
+	}
+
+	// Rerun calibration if the calibration stage is resumed.
+	calibration := previous.Calibration
+	for _, stage := range stageStatuses {
+		if stage.Stage.Type == CalibrationJobType && stage.State == PIPELINE_STAGE_PENDING {
+			calibration = nil
+		}
+	}
+
+	id, err := generateId("pipeline")
+	if err != nil {
+		return nil, errors.New("Unable to generate id: " + err.Error())
+	}
+
+	run, err := newPipelineRun(
+		id,
+		previous.JobManager,
+		previous.ApplicationConfig,
+		previous.Config,
+		stageStatuses,
+		calibration,
+		previous.IsSkipUnreserveOnFailure())
+	if err != nil {
+		return nil, err
+	}
+
+	run.SetUserId(previous.Request.UserId)
+	return run, nil
+}
+
+func newPipelineRun(
+	id string,
+	jobManager *jobs.JobManager,
+	applicationConfig *models.ApplicationConfig,
+	config *viper.Viper,
+	stages []*models.PipelineStageStatus,
+	calibration *models.CalibrationResults,
+	skipUnreserveOnFailure bool) (*PipelineRun, error) {
+	parameters := pipelineRunParameters{
+		Stages:      stages,
+		Calibration: calibration,
+	}
+
+	log, logErr := log.NewLogger(config.GetString("filesPath"), id)
+	if logErr != nil {
+		return nil, errors.New("Error creating deployment logger: " + logErr.Error())
+	}
+
+	deployerClient, deployerErr := clients.NewDeployerClient(config)
+	if deployerErr != nil {
+		return nil, errors.New("Unable to create new deployer client: " + deployerErr.Error())
+	}
+
+	metricsDB, metricsErr := db.NewMetricsStore(config)
+	if metricsErr != nil {
+		return nil, errors.New("Unable to create metrics store: " + metricsErr.Error())
+	}
+
+	configDB, configErr := db.NewConfigStore(config)
+	if configErr != nil {
+		return nil, errors.New("Unable to create config store: " + configErr.Error())
+	}
+
+	return &PipelineRun{
+		ProfileRun: ProfileRun{
+			Id:                     id,
+			ApplicationConfig:      applicationConfig,
+			DeployerClient:         deployerClient,
+			MetricsDB:              metricsDB,
+			ProfileLog:             log,
+			Request:                newJobRequest(PipelineJobType, applicationConfig, skipUnreserveOnFailure, parameters),
+			Created:                time.Now(),
+			SkipUnreserveOnFailure: skipUnreserveOnFailure,
+			DirectJob:              true,
+		},
+		Config:      config,
+		JobManager:  jobManager,
+		ConfigDB:    configDB,
+		Stages:      stages,
+		Calibration: calibration,
+	}, nil
+}
+
+func validatePipelineStage(stage models.PipelineStage) error {
+	switch stage.Type {
+	case CalibrationJobType:
+	case BenchmarkJobType:
+		if stage.StartingIntensity <= 0 {
+			return errors.New("Benchmark stage requires startingIntensity")
+		}
+		if stage.SearchMode != BinarySearchMode && stage.Step <= 0 {
+			return errors.New("Benchmark stage requires step unless using binary search")
+		}
+	case AWSSizingJobType:
+	default:
+		return errors.New("Unsupported pipeline stage type: " + stage.Type)
+	}
+
+	return nil
+}
+
+func (run *PipelineRun) SetFailed(error string) {}
+
+// GetJobRequest returns the pipeline's job request, which parameters record the
+// stage statuses as they change.
+func (run *PipelineRun) GetJobRequest() jobs.JobRequest {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	return run.Request
+}
+
+func (run *PipelineRun) GetResults() <-chan *jobs.JobResults {
+	return nil
+}
+
+// GetStages returns a copy of the pipeline stage statuses.
+func (run *PipelineRun) GetStages() []models.PipelineStageStatus {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	stages := []models.PipelineStageStatus{}
+	for _, stage := range run.Stages {
+		stages = append(stages, *stage)
+	}
+
+	return stages
+}
+
+func (run *PipelineRun) GetPipelineSummary() models.PipelineSummary {
+	return models.PipelineSummary{
+		PipelineId: run.Id,
+		AppName:    run.ApplicationConfig.Name,
+		State:      run.GetState(),
+		Stages:     run.GetStages(),
+	}
+}
+
+func (run *PipelineRun) updateStage(stage *models.PipelineStageStatus, state string, failure string) {
+	run.mutex.Lock()
+	changed := stage.State != state || stage.Failure != failure
+	stage.State = state
+	stage.Failure = failure
+	run.mutex.Unlock()
+
+	if changed {
+		run.storeStages()
+	}
+}
+
+// storeStages records the stage statuses and calibration results in the pipeline's
+// job request and stores it, so a restored pipeline skips its finished stages.
+func (run *PipelineRun) storeStages() {
+	run.mutex.Lock()
+	b, err := json.Marshal(pipelineRunParameters{
+		Stages:      run.Stages,
+		Calibration: run.Calibration,
+	})
+	if err != nil {
+		run.mutex.Unlock()
+		run.ProfileLog.Logger.Warningf("Unable to marshal pipeline %s stages: %s", run.Id, err.Error())
+		return
+	}
+	run.Request.Parameters = string(b)
+	run.mutex.Unlock()
+
+	run.JobManager.JobStore.StoreJob(run)
+}
+
+func (run *PipelineRun) Run(ctx context.Context, deploymentId string) error {
+	log := run.ProfileLog.Logger
+
+	for i, stage := range run.Stages {
+		if stage.State == jobs.JOB_FINISHED {
+			log.Infof("Skipping finished pipeline stage %d (%s) from run %s", i, stage.Stage.Type, stage.RunId)
+			continue
+		}
+
+		job, err := run.newStageJob(stage.Stage)
+		if err != nil {
+			message := fmt.Sprintf("Unable to create pipeline stage %d (%s): %s", i, stage.Stage.Type, err.Error())
+			run.updateStage(stage, jobs.JOB_FAILED, message)
+			return errors.New(message)
+		}
+
+		run.mutex.Lock()
+		stage.RunId = job.GetId()
+		if run.Calibration != nil && stage.Stage.Type != CalibrationJobType {
+			stage.InputRunId = run.Calibration.TestId
+		}
+		run.mutex.Unlock()
+
+		log.Infof("Starting pipeline stage %d (%s) with run %s", i, stage.Stage.Type, job.GetId())
+		job.SetPriority(run.GetPriority())
+		job.SetUserId(run.GetJobRequest().UserId)
+		job.SetPipelineId(run.Id)
+		run.JobManager.AddJob(job)
+
+		if err := run.waitStage(ctx, stage, job); err != nil {
+			message := fmt.Sprintf("Pipeline stage %d (%s) with run %s failed: %s",
+				i, stage.Stage.Type, job.GetId(), err.Error())
+			log.Warningf(message)
+			return errors.New(message)
+		}
+
+		if calibrationRun, ok := job.(*CalibrationRun); ok {
+			if calibrationRun.Results == nil {
+				message := fmt.Sprintf("Calibration run %s finished without results", job.GetId())
+				run.updateStage(stage, jobs.JOB_FAILED, message)
+				return errors.New(message)
+			}
+			run.mutex.Lock()
+			run.Calibration = calibrationRun.Results
+			run.mutex.Unlock()
+			run.storeStages()
+		}
+
+		log.Infof("Pipeline stage %d (%s) with run %s finished", i, stage.Stage.Type, job.GetId())
+	}
+
+	log.Infof("Pipeline %s finished for app %s", run.Id, run.ApplicationConfig.Name)
+
+	return nil
+}
+
+// waitStage waits for the stage run to finish, and tracks its state in the stage status.
+// The stage run is cancelled if the pipeline is cancelled.
+func (run *PipelineRun) waitStage(ctx context.Context, stage *models.PipelineStageStatus, job jobs.Job) error {
+	ticker := time.NewTicker(pipelineStagePollInterval)
+	defer ticker.Stop()
+
+	for {
+		state := job.GetState()
+		switch state {
+		case jobs.JOB_FINISHED:
+			run.updateStage(stage, state, "")
+			return nil
+		case jobs.JOB_FAILED, jobs.JOB_CANCELLED:
+			message := "Stage run " + job.GetId() + " " + state
+			run.updateStage(stage, state, message)
+			return errors.New(message)
+		default:
+			run.updateStage(stage, state, "")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := run.JobManager.CancelJob(job.GetId()); err != nil {
+				run.ProfileLog.Logger.Warningf("Unable to cancel stage run %s: %s", job.GetId(), err.Error())
+			}
+			run.updateStage(stage, jobs.JOB_CANCELLED, "Pipeline cancelled")
+			return ctx.Err()
+		}
+	}
+}
+
+// stageJob is a job run as a pipeline stage.
+type stageJob interface {
+	jobs.Job
+	SetUserId(userId string)
+	SetPipelineId(pipelineId string)
+}
+
+func (run *PipelineRun) newStageJob(stage models.PipelineStage) (stageJob, error) {
+	applicationConfig := run.ApplicationConfig
+	skipFlag := run.IsSkipUnreserveOnFailure()
+
+	switch stage.Type {
+	case CalibrationJobType:
+		calibrationRun, err := NewCalibrationRun(applicationConfig, run.Config, skipFlag)
+		if err != nil {
+			return nil, err
+		}
+		return calibrationRun, nil
+	case BenchmarkJobType:
+		benchmarks, err := run.ConfigDB.GetBenchmarks()
+		if err != nil {
+			return nil, errors.New("Unable to get the collection of benchmarks: " + err.Error())
+		}
+
+		benchmarkRun, err := NewBenchmarkRun(
+			applicationConfig,
+			benchmarks,
+			stage.StartingIntensity,
+			stage.Step,
+			stage.SloTolerance,
+			stage.SearchMode,
+			stage.Precision,
+			run.Config)
+		if err != nil {
+			return nil, err
+		}
+		benchmarkRun.Calibration = run.Calibration
+		return benchmarkRun, nil
+	case AWSSizingJobType:
+		regions := []string{}
+		if stage.Region != "" {
+			regions = append(regions, stage.Region)
+		}
+		availabilityZones := []string{}
+		if stage.AvailabilityZone != "" {
+			availabilityZones = append(availabilityZones, stage.AvailabilityZone)
+		}
+		locations, err := ResolveAWSLocations(run.Config, regions, availabilityZones)
+		if err != nil {
+			return nil, errors.New("Unable to resolve sizing location: " + err.Error())
+		}
+		location := locations[0]
+
+		if stage.AllInstances {
+			region := location.Region
+			nodeTypeConfig, err := run.ConfigDB.GetNodeTypeConfig(region)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to get node type for %s: %s", region, err.Error())
+			}
+
+			previousGeneration, err := run.ConfigDB.GetPreviousGenerationConfig(region)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to get previous generation for %s: %s", region, err.Error())
+			}
+
+			previousGenerations := []string{}
+			for _, awsNodeType := range previousGeneration.Data {
+				previousGenerations = append(previousGenerations, awsNodeType.Name)
+			}
+
+			sizingRun, err := NewAWSSizingAllInstancesRun(
+				run.JobManager,
+				applicationConfig,
+				run.Config,
+				nodeTypeConfig,
+				previousGenerations,
+				location.AvailabilityZone,
+				"",
+				skipFlag)
+			if err != nil {
+				return nil, err
+			}
+			sizingRun.Calibration = run.Calibration
+			return sizingRun, nil
+		} else if len(stage.Instances) > 0 {
+			sizingRun, err := NewAWSSizingInstancesRun(
+				run.JobManager,
+				applicationConfig,
+				run.Config,
+				stage.Instances,
+				location,
+				skipFlag)
+			if err != nil {
+				return nil, err
+			}
+			sizingRun.Calibration = run.Calibration
+			return sizingRun, nil
+		}
+
+		sizingRun, err := NewAWSSizingRun(run.JobManager, applicationConfig, run.Config, location, skipFlag)
+		if err != nil {
+			return nil, err
+		}
+		sizingRun.Calibration = run.Calibration
+		return sizingRun, nil
+	}
+
+	return nil, errors.New("Unsupported pipeline stage type: " + stage.Type)
+}
@@ -0,0 +1,166 @@
+package runners
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+)
+
+// instancePerformance returns the performance of the QoS value, which is
+// higher for better QoS values.
+func instancePerformance(slo models.SLO, qosValue float64) float64 {
+	if slo.Type == models.ThroughputSLOType {
+		return qosValue
+	}
+
+	if qosValue <= 0 {
+		return 0
+	}
+	return 1 / qosValue
+}
+
+// sloHeadroom returns the ratio of the SLO value the QoS value is better than
+// the SLO by.
+func sloHeadroom(slo models.SLO, qosValue float64) float64 {
+	if slo.Value == 0 {
+		return 0
+	}
+
+	if slo.Type == models.ThroughputSLOType {
+		return qosValue/slo.Value - 1
+	}
+	return 1 - qosValue/slo.Value
+}
+
+// isSLOConfident returns if the 95% confidence interval of the mean QoS
+// meets the SLO. Results without stats only use their mean.
+func isSLOConfident(slo models.SLO, qosValue float64, stats *models.QosStats) bool {
+	if stats == nil || stats.Trials < 2 {
+		return slo.IsMetWithTolerance(qosValue, 0)
+	}
+
+	if slo.Type == models.ThroughputSLOType {
+		return slo.IsMetWithTolerance(stats.CILow, 0)
+	}
+	return slo.IsMetWithTolerance(stats.CIHigh, 0)
+}
+
+type byRecommendation []models.InstanceRecommendation
+
+func (r byRecommendation) Len() int      { return len(r) }
+func (r byRecommendation) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byRecommendation) Less(i, j int) bool {
+	if r[i].SloMet != r[j].SloMet {
+		return r[i].SloMet
+	}
+	if r[i].SloConfident != r[j].SloConfident {
+		return r[i].SloConfident
+	}
+	if r[i].PerfPerDollar != r[j].PerfPerDollar {
+		return r[i].PerfPerDollar > r[j].PerfPerDollar
+	}
+	return r[i].InstanceType < r[j].InstanceType
+}
+
+type byHourlyCost []models.InstanceRecommendation
+
+func (r byHourlyCost) Len() int           { return len(r) }
+func (r byHourlyCost) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byHourlyCost) Less(i, j int) bool { return r[i].HourlyCost < r[j].HourlyCost }
+
+// dominates returns if a is at most as expensive as b and performs at least
+// as well, while being strictly better in one of them.
+func dominates(a models.InstanceRecommendation, b models.InstanceRecommendation) bool {
+	if a.HourlyCost > b.HourlyCost || a.Performance < b.Performance {
+		return false
+	}
+
+	return a.HourlyCost < b.HourlyCost || a.Performance > b.Performance
+}
+
+// computePricedRecommendation scores the finished instance results with the
+// pricing option. Instance types without a price are left out, as they can't
+// be compared by cost.
+func computePricedRecommendation(
+	slo models.SLO,
+	pricing string,
+	nodeTypes []models.AWSNodeType,
+	testResults map[string]*InstanceResults) models.PricedRecommendation {
+	recommendations := []models.InstanceRecommendation{}
+	for _, nodeType := range nodeTypes {
+		instanceResults, ok := testResults[instanceTypeDbName(nodeType.Name)]
+		if !ok || instanceResults.State != GetStateString(FINISHED) {
+			continue
+		}
+
+		hourlyCost := nodeType.HourlyCost.HourlyPrice(pricing)
+		if hourlyCost <= 0 {
+			continue
+		}
+
+		performance := instancePerformance(slo, instanceResults.QosValue)
+		recommendations = append(recommendations, models.InstanceRecommendation{
+			InstanceType:  nodeType.Name,
+			QosValue:      instanceResults.QosValue,
+			HourlyCost:    hourlyCost,
+			Performance:   performance,
+			PerfPerDollar: performance / hourlyCost,
+			SloMet:        slo.IsMetWithTolerance(instanceResults.QosValue, 0),
+			SloConfident:  isSLOConfident(slo, instanceResults.QosValue, instanceResults.Stats),
+			SloHeadroom:   sloHeadroom(slo, instanceResults.QosValue),
+		})
+	}
+
+	for i := range recommendations {
+		recommendations[i].Pareto = true
+		for j := range recommendations {
+			if i != j && dominates(recommendations[j], recommendations[i]) {
+				recommendations[i].Pareto = false
+				break
+			}
+		}
+	}
+
+	sort.Sort(byRecommendation(recommendations))
+	frontier := []models.InstanceRecommendation{}
+	for i := range recommendations {
+		recommendations[i].Rank = i + 1
+		if recommendations[i].Pareto {
+			frontier = append(frontier, recommendations[i])
+		}
+	}
+
+	// The frontier is ordered from the cheapest instance type.
+	sort.Sort(byHourlyCost(frontier))
+	pricedRecommendation := models.PricedRecommendation{
+		Pricing:        pricing,
+		Ranking:        recommendations,
+		ParetoFrontier: []string{},
+	}
+	for _, recommendation := range frontier {
+		pricedRecommendation.ParetoFrontier = append(pricedRecommendation.ParetoFrontier, recommendation.InstanceType)
+	}
+	if len(recommendations) > 0 && recommendations[0].SloMet {
+		pricedRecommendation.Recommended = recommendations[0].InstanceType
+	}
+
+	return pricedRecommendation
+}
+
+// computeSizingRecommendation computes the recommendation of the sizing
+// results with both on-demand and reserved pricing.
+func computeSizingRecommendation(
+	slo models.SLO,
+	nodeTypeConfig *models.AWSRegionNodeTypeConfig,
+	results *AllInstanceRunResults) *models.SizingRecommendation {
+	return &models.SizingRecommendation{
+		RunId:    results.RunId,
+		AppName:  results.AppName,
+		Region:   nodeTypeConfig.Region,
+		SLO:      slo,
+		OnDemand: computePricedRecommendation(slo, models.OnDemandPricing, nodeTypeConfig.Data, results.TestResults),
+		Reserved: computePricedRecommendation(slo, models.ReservedPricing, nodeTypeConfig.Data, results.TestResults),
+		Created:  time.Now(),
+	}
+}
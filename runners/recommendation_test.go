@@ -0,0 +1,93 @@
+package runners
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+)
+
+func TestIsSLOConfident(t *testing.T) {
+	slo := models.SLO{Metric: "latency", Value: 100, Type: "latency"}
+	if !isSLOConfident(slo, 90, nil) || isSLOConfident(slo, 110, nil) {
+		t.Error("Expected results without stats to be judged by their mean")
+	}
+
+	// A single trial has no confidence interval to judge by.
+	if !isSLOConfident(slo, 90, &models.QosStats{Trials: 1, CILow: 90, CIHigh: 150}) {
+		t.Error("Expected single trial results to be judged by their mean")
+	}
+
+	if isSLOConfident(slo, 90, &models.QosStats{Trials: 3, CILow: 80, CIHigh: 105}) {
+		t.Error("Expected latency interval above the SLO not to be confident")
+	}
+
+	throughputSLO := models.SLO{Metric: "throughput", Value: 1000, Type: models.ThroughputSLOType}
+	if !isSLOConfident(throughputSLO, 1100, &models.QosStats{Trials: 3, CILow: 1050, CIHigh: 1150}) {
+		t.Error("Expected throughput interval above the SLO to be confident")
+	}
+	if isSLOConfident(throughputSLO, 1100, &models.QosStats{Trials: 3, CILow: 950, CIHigh: 1250}) {
+		t.Error("Expected throughput interval below the SLO not to be confident")
+	}
+}
+
+func TestComputePricedRecommendation(t *testing.T) {
+	slo := models.SLO{Metric: "latency", Value: 100, Type: "latency"}
+	nodeTypes := []models.AWSNodeType{
+		{Name: "t2.small", HourlyCost: models.AWSCost{LinuxOnDemand: 0.1, LinuxReserved: 0.05}},
+		{Name: "m4.large", HourlyCost: models.AWSCost{LinuxOnDemand: 0.2, LinuxReserved: 0.1}},
+		{Name: "m4.xlarge", HourlyCost: models.AWSCost{LinuxOnDemand: 0.4, LinuxReserved: 0.1}},
+		{Name: "t2.nano", HourlyCost: models.AWSCost{LinuxOnDemand: 0.05, LinuxReserved: 0.02}},
+		{Name: "c4.large", HourlyCost: models.AWSCost{LinuxOnDemand: 0.1, LinuxReserved: 0.05}},
+		{Name: "x1.unpriced"},
+	}
+	testResults := map[string]*InstanceResults{
+		"t2-small":    {State: GetStateString(FINISHED), QosValue: 80},
+		"m4-large":    {State: GetStateString(FINISHED), QosValue: 50},
+		"m4-xlarge":   {State: GetStateString(FINISHED), QosValue: 40},
+		"t2-nano":     {State: GetStateString(FINISHED), QosValue: 150},
+		"c4-large":    {State: GetStateString(FAILED), QosValue: 10},
+		"x1-unpriced": {State: GetStateString(FINISHED), QosValue: 10},
+	}
+
+	recommendation := computePricedRecommendation(slo, models.OnDemandPricing, nodeTypes, testResults)
+	ranking := []string{}
+	for i, instanceRecommendation := range recommendation.Ranking {
+		ranking = append(ranking, instanceRecommendation.InstanceType)
+		if instanceRecommendation.Rank != i+1 {
+			t.Errorf("Expected %s at rank %d, got %d", instanceRecommendation.InstanceType, i+1, instanceRecommendation.Rank)
+		}
+	}
+
+	// Instance types meeting the SLO are ranked first by performance per
+	// dollar, and the failed and unpriced instance types are left out.
+	if expected := []string{"t2.small", "m4.large", "m4.xlarge", "t2.nano"}; !reflect.DeepEqual(ranking, expected) {
+		t.Errorf("Expected on-demand ranking %v, got %v", expected, ranking)
+	}
+	if expected := []string{"t2.nano", "t2.small", "m4.large", "m4.xlarge"}; !reflect.DeepEqual(recommendation.ParetoFrontier, expected) {
+		t.Errorf("Expected on-demand pareto frontier %v, got %v", expected, recommendation.ParetoFrontier)
+	}
+	if recommendation.Recommended != "t2.small" {
+		t.Errorf("Expected t2.small to be recommended on-demand, got %s", recommendation.Recommended)
+	}
+
+	// m4.xlarge costs as much as m4.large reserved and performs better.
+	recommendation = computePricedRecommendation(slo, models.ReservedPricing, nodeTypes, testResults)
+	if recommendation.Recommended != "m4.xlarge" {
+		t.Errorf("Expected m4.xlarge to be recommended reserved, got %s", recommendation.Recommended)
+	}
+	if expected := []string{"t2.nano", "t2.small", "m4.xlarge"}; !reflect.DeepEqual(recommendation.ParetoFrontier, expected) {
+		t.Errorf("Expected reserved pareto frontier %v, got %v", expected, recommendation.ParetoFrontier)
+	}
+
+	testResults["t2-small"].Stats = &models.QosStats{Trials: 3, CILow: 60, CIHigh: 110}
+	recommendation = computePricedRecommendation(slo, models.OnDemandPricing, nodeTypes, testResults)
+	if recommendation.Recommended != "m4.large" || !recommendation.Ranking[0].SloConfident {
+		t.Errorf("Expected confidently meeting m4.large to be recommended, got %s", recommendation.Recommended)
+	}
+
+	testResults = map[string]*InstanceResults{"t2-nano": {State: GetStateString(FINISHED), QosValue: 150}}
+	if recommendation = computePricedRecommendation(slo, models.OnDemandPricing, nodeTypes, testResults); recommendation.Recommended != "" {
+		t.Errorf("Expected no recommendation without instance types meeting the SLO, got %s", recommendation.Recommended)
+	}
+}
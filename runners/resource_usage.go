@@ -0,0 +1,202 @@
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+// ResourceUsageConfig configures where the container metrics of the pods are
+// read from to compute their resource usage. Influx metrics are expected in
+// the format of the telegraf docker input with the pod name as a tag, and
+// prometheus metrics in the format of cadvisor with the pod name as a label.
+type ResourceUsageConfig struct {
+	Database string `mapstructure:"database"`
+	PodTag   string `mapstructure:"podTag"`
+	Interval string `mapstructure:"interval"`
+	PodLabel string `mapstructure:"podLabel"`
+	// RateWindow is the range of the prometheus rate of counters.
+	RateWindow string `mapstructure:"rateWindow"`
+	// SnapshotSelectors select the prometheus series exported by snapshots.
+	SnapshotSelectors []string `mapstructure:"snapshotSelectors"`
+}
+
+// GetResourceUsageConfig reads the resourceUsage config, which defaults to
+// the telegraf database and cadvisor metrics with 10s intervals.
+func GetResourceUsageConfig(config *viper.Viper) (ResourceUsageConfig, error) {
+	usageConfig := ResourceUsageConfig{}
+	if err := config.UnmarshalKey("resourceUsage", &usageConfig); err != nil {
+		return usageConfig, errors.New("Unable to parse resource usage config: " + err.Error())
+	}
+
+	if usageConfig.Database == "" {
+		usageConfig.Database = "telegraf"
+	}
+	if usageConfig.PodTag == "" {
+		usageConfig.PodTag = "io.kubernetes.pod.name"
+	}
+	if usageConfig.Interval == "" {
+		usageConfig.Interval = "10s"
+	}
+	if usageConfig.PodLabel == "" {
+		usageConfig.PodLabel = "pod"
+	}
+	if usageConfig.RateWindow == "" {
+		usageConfig.RateWindow = "1m"
+	}
+	if len(usageConfig.SnapshotSelectors) == 0 {
+		usageConfig.SnapshotSelectors = []string{`{__name__=~"container_.+"}`}
+	}
+	if _, err := time.ParseDuration(usageConfig.Interval); err != nil {
+		return usageConfig, errors.New("Unable to parse resource usage interval: " + err.Error())
+	}
+
+	return usageConfig, nil
+}
+
+// resourceMetric is a container metric used to compute a resource usage, with
+// its influx measurement and prometheus metric. Counters are converted to per
+// second rates.
+type resourceMetric struct {
+	Measurement string
+	Field       string
+	Filter      string
+	Counter     bool
+
+	PrometheusMetric  string
+	PrometheusFilter  string
+	PrometheusBy      string
+	PrometheusScale   string
+	PrometheusCounter bool
+}
+
+// containerFilter excludes the pod level cgroups, which add up the usage of
+// all the containers of a pod.
+const containerFilter = `,container!="",container!="POD"`
+
+var (
+	cpuUsageMetric = resourceMetric{
+		Measurement: "docker_container_cpu", Field: "usage_percent", Filter: `"cpu" = 'cpu-total'`,
+		PrometheusMetric: "container_cpu_usage_seconds_total", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container", PrometheusScale: " * 100", PrometheusCounter: true,
+	}
+	memUsageMetric = resourceMetric{
+		Measurement: "docker_container_mem", Field: "usage",
+		PrometheusMetric: "container_memory_working_set_bytes", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container",
+	}
+	netReceivedMetric = resourceMetric{
+		Measurement: "docker_container_net", Field: "rx_bytes", Filter: `"network" != 'total'`,
+		PrometheusMetric: "container_network_receive_bytes_total", PrometheusBy: ", interface", Counter: true, PrometheusCounter: true,
+	}
+	netSentMetric = resourceMetric{
+		Measurement: "docker_container_net", Field: "tx_bytes", Filter: `"network" != 'total'`,
+		PrometheusMetric: "container_network_transmit_bytes_total", PrometheusBy: ", interface", Counter: true, PrometheusCounter: true,
+	}
+	diskBytesReadMetric = resourceMetric{
+		Measurement: "docker_container_blkio", Field: "io_service_bytes_recursive_read", Filter: `"device" = 'total'`,
+		PrometheusMetric: "container_fs_reads_bytes_total", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container", Counter: true, PrometheusCounter: true,
+	}
+	diskBytesWriteMetric = resourceMetric{
+		Measurement: "docker_container_blkio", Field: "io_service_bytes_recursive_write", Filter: `"device" = 'total'`,
+		PrometheusMetric: "container_fs_writes_bytes_total", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container", Counter: true, PrometheusCounter: true,
+	}
+	diskOpsReadMetric = resourceMetric{
+		Measurement: "docker_container_blkio", Field: "io_serviced_recursive_read", Filter: `"device" = 'total'`,
+		PrometheusMetric: "container_fs_reads_total", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container", Counter: true, PrometheusCounter: true,
+	}
+	diskOpsWriteMetric = resourceMetric{
+		Measurement: "docker_container_blkio", Field: "io_serviced_recursive_write", Filter: `"device" = 'total'`,
+		PrometheusMetric: "container_fs_writes_total", PrometheusFilter: containerFilter,
+		PrometheusBy: ", container", Counter: true, PrometheusCounter: true,
+	}
+	influxRegexpDelimiter = strings.NewReplacer("/", `\/`)
+)
+
+// influxQuery returns the query of the metric summed over the pods of the
+// service at every interval of the time range.
+func (metric resourceMetric) influxQuery(
+	usageConfig ResourceUsageConfig,
+	serviceName string,
+	startTime time.Time,
+	endTime time.Time) string {
+	selector := fmt.Sprintf(`mean("%s")`, metric.Field)
+	if metric.Counter {
+		selector = fmt.Sprintf(`non_negative_derivative(max("%s"), 1s)`, metric.Field)
+	}
+
+	// Pods of the service are named after it, e.g: <service>-<hash>-<id>.
+	podPattern := influxRegexpDelimiter.Replace("^" + regexp.QuoteMeta(serviceName) + "-")
+	conditions := []string{
+		fmt.Sprintf("time >= %d", startTime.UnixNano()),
+		fmt.Sprintf("time <= %d", endTime.UnixNano()),
+		fmt.Sprintf(`"%s" =~ /%s/`, usageConfig.PodTag, podPattern),
+	}
+	if metric.Filter != "" {
+		conditions = append(conditions, metric.Filter)
+	}
+
+	return fmt.Sprintf(`SELECT %s FROM "%s" WHERE %s GROUP BY time(%s), * fill(none)`,
+		selector, metric.Measurement, strings.Join(conditions, " AND "), usageConfig.Interval)
+}
+
+// computeUsageStats summarizes the usage values, which are zero if the metric
+// has no values.
+func computeUsageStats(values []float64) models.UsageStats {
+	stats := models.UsageStats{
+		Samples: len(values),
+	}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sortedValues := append([]float64{}, values...)
+	sort.Float64s(sortedValues)
+
+	sum := 0.0
+	for _, value := range sortedValues {
+		sum += value
+	}
+	stats.Mean = sum / float64(len(sortedValues))
+	stats.P95 = percentile(sortedValues, 95)
+	stats.Max = sortedValues[len(sortedValues)-1]
+
+	return stats
+}
+
+// computeResourceUsage queries the values of every resource metric summed over
+// the service's pods, and summarizes their usage.
+func computeResourceUsage(queryValues func(metric resourceMetric) ([]float64, error)) (*models.ResourceUsage, error) {
+	usage := &models.ResourceUsage{}
+	metrics := []struct {
+		metric resourceMetric
+		stats  *models.UsageStats
+	}{
+		{cpuUsageMetric, &usage.CpuUtilization},
+		{memUsageMetric, &usage.MemUsage},
+		{netReceivedMetric, &usage.NetUsage.BytesReceivedPerSec},
+		{netSentMetric, &usage.NetUsage.BytesSentPerSec},
+		{diskBytesReadMetric, &usage.DiskUsage.BytesReadPerSec},
+		{diskBytesWriteMetric, &usage.DiskUsage.BytesWritePerSec},
+		{diskOpsReadMetric, &usage.DiskUsage.OpsReadPerSec},
+		{diskOpsWriteMetric, &usage.DiskUsage.OpsWritePerSec},
+	}
+	for _, m := range metrics {
+		values, err := queryValues(m.metric)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to query %s %s: %s", m.metric.Measurement, m.metric.Field, err.Error())
+		}
+		*m.stats = computeUsageStats(values)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,240 @@
+package runners
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperpilotio/workload-profiler/db"
+	"github.com/hyperpilotio/workload-profiler/jobs"
+	"github.com/spf13/viper"
+)
+
+// RestoreJob recreates a job from its stored request with the original run id,
+// so jobs that were queued before the profiler restarted can be enqueued again.
+func RestoreJob(
+	jobManager *jobs.JobManager,
+	config *viper.Viper,
+	runId string,
+	request jobs.JobRequest) (jobs.Job, error) {
+	configDB, err := db.NewConfigStore(config)
+	if err != nil {
+		return nil, errors.New("Unable to create config store: " + err.Error())
+	}
+
+	applicationConfig, err := configDB.GetApplicationConfig(request.AppName)
+	if err != nil {
+		return nil, errors.New("Unable to get application config for " + request.AppName + ": " + err.Error())
+	}
+
+	switch request.Type {
+	case CalibrationJobType:
+		run, err := newCalibrationRun(runId, applicationConfig, config, request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case BenchmarkJobType:
+		var parameters benchmarkRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		benchmarks, err := configDB.GetBenchmarks()
+		if err != nil {
+			return nil, errors.New("Unable to get the collection of benchmarks: " + err.Error())
+		}
+
+		run, err := newBenchmarkRun(
+			runId,
+			applicationConfig,
+			benchmarks,
+			parameters.StartingIntensity,
+			parameters.Step,
+			parameters.SloTolerance,
+			parameters.SearchMode,
+			parameters.Precision,
+			config)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCalibrationRunId(request.CalibrationRunId)
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case CaptureMetricsJobType:
+		var parameters captureMetricsRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		duration, err := time.ParseDuration(parameters.Duration)
+		if err != nil {
+			return nil, errors.New("Unable to parse duration " + parameters.Duration + ": " + err.Error())
+		}
+
+		run, err := newCaptureMetricsRun(
+			runId,
+			applicationConfig,
+			parameters.ServiceName,
+			parameters.LoadTester,
+			parameters.Benchmark,
+			parameters.BenchmarkIntensity,
+			duration,
+			&parameters.MetricsSource,
+			request.SkipUnreserveOnFailure,
+			config)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case AWSSizingJobType:
+		// Sizing runs stored before their location was recorded have no
+		// parameters, and size in the default region.
+		var parameters awsSizingRunParameters
+		if request.Parameters != "" {
+			if err := parseJobParameters(request, &parameters); err != nil {
+				return nil, err
+			}
+		}
+
+		location := AWSLocation{
+			Region:           parameters.Region,
+			AvailabilityZone: parameters.AvailabilityZone,
+		}
+		run, err := newAWSSizingRun(runId, jobManager, applicationConfig, config, location, request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCalibrationRunId(request.CalibrationRunId)
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case AWSSizingInstancesJobType:
+		var parameters awsSizingInstancesRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		run, err := newAWSSizingInstancesRun(
+			runId,
+			jobManager,
+			applicationConfig,
+			config,
+			parameters.Instances,
+			AWSLocation{
+				Region:           parameters.Region,
+				AvailabilityZone: parameters.AvailabilityZone,
+			},
+			request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCalibrationRunId(request.CalibrationRunId)
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case AWSSizingAllInstancesJobType:
+		var parameters awsSizingAllInstancesRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		nodeTypeConfig, err := configDB.GetNodeTypeConfig(parameters.Region)
+		if err != nil {
+			return nil, errors.New("Unable to get node type for " + parameters.Region + ": " + err.Error())
+		}
+
+		previousGeneration, err := configDB.GetPreviousGenerationConfig(parameters.Region)
+		if err != nil {
+			return nil, errors.New("Unable to get previous generation for " + parameters.Region + ": " + err.Error())
+		}
+
+		previousGenerations := []string{}
+		for _, awsNodeType := range previousGeneration.Data {
+			previousGenerations = append(previousGenerations, awsNodeType.Name)
+		}
+
+		run, err := newAWSSizingAllInstancesRun(
+			runId,
+			jobManager,
+			applicationConfig,
+			config,
+			nodeTypeConfig,
+			previousGenerations,
+			parameters.AvailabilityZone,
+			parameters.ResumeRunId,
+			request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCalibrationRunId(request.CalibrationRunId)
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case GCPSizingJobType:
+		var parameters gcpSizingRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		machineTypeConfig, err := configDB.GetGCPMachineTypeConfig(parameters.Region)
+		if err != nil {
+			return nil, errors.New("Unable to get machine types for " + parameters.Region + ": " + err.Error())
+		}
+
+		run, err := newGCPSizingRun(
+			runId,
+			jobManager,
+			applicationConfig,
+			config,
+			machineTypeConfig,
+			parameters.Instances,
+			request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCalibrationRunId(request.CalibrationRunId)
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case PipelineJobType:
+		var parameters pipelineRunParameters
+		if err := parseJobParameters(request, &parameters); err != nil {
+			return nil, err
+		}
+
+		run, err := newPipelineRun(
+			runId,
+			jobManager,
+			applicationConfig,
+			config,
+			parameters.Stages,
+			parameters.Calibration,
+			request.SkipUnreserveOnFailure)
+		if err != nil {
+			return nil, err
+		}
+		run.SetCallbackUrl(request.CallbackUrl)
+		run.SetUserId(request.UserId)
+		return run, nil
+	case AWSSizingSingleJobType, GCPSizingSingleJobType:
+		// Single runs are spawned and waited on by their sizing run, which
+		// spawns them again when it's restored.
+		return nil, errors.New("Sizing single runs are restored by their sizing run")
+	}
+
+	return nil, errors.New("Unknown job type: " + request.Type)
+}
+
+func parseJobParameters(request jobs.JobRequest, parameters interface{}) error {
+	if err := json.Unmarshal([]byte(request.Parameters), parameters); err != nil {
+		return errors.New("Unable to parse " + request.Type + " job parameters: " + err.Error())
+	}
+
+	return nil
+}
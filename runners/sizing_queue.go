@@ -0,0 +1,99 @@
+package runners
+
+import (
+	"errors"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultMaxConcurrentInstances = 4
+	defaultStaleRunningTimeout    = time.Hour
+)
+
+// SizingConfig configures how all instances sizing runs queue their single
+// runs.
+type SizingConfig struct {
+	// MaxConcurrentInstances bounds the single runs a sizing run has queued or
+	// running at a time.
+	MaxConcurrentInstances int
+	// StaleRunningTimeout is how long an instance type can be left running by
+	// an interrupted run. A resumed run waits on the results of single runs
+	// that are still alive within the timeout, and cancels the ones running
+	// longer to size their instance types again. Instance types whose single
+	// run is gone are sized right away.
+	StaleRunningTimeout time.Duration
+}
+
+// GetSizingConfig reads the sizing config.
+func GetSizingConfig(config *viper.Viper) (SizingConfig, error) {
+	sizingConfig := SizingConfig{
+		MaxConcurrentInstances: config.GetInt("sizing.maxConcurrentInstances"),
+		StaleRunningTimeout:    defaultStaleRunningTimeout,
+	}
+
+	if sizingConfig.MaxConcurrentInstances <= 0 {
+		sizingConfig.MaxConcurrentInstances = defaultMaxConcurrentInstances
+	}
+	if timeout := config.GetString("sizing.staleRunningTimeout"); timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return sizingConfig, errors.New("Unable to parse sizing staleRunningTimeout: " + err.Error())
+		}
+		sizingConfig.StaleRunningTimeout = duration
+	}
+
+	return sizingConfig, nil
+}
+
+// instanceRunResult is the result of the single run sizing the instance type.
+type instanceRunResult struct {
+	instanceType string
+	singleRun    *AWSSizingSingleRun
+	failure      string
+	results      *SizeRunResults
+}
+
+// planInstanceTypes returns the instance types to size, leaving out the finished
+// ones, and the alive single runs of the instance types left running by an interrupted
+// run, which are waited on instead. Alive single runs running longer than the stale
+// timeout are returned to be cancelled, and their instance types are sized again.
+func (run *AWSSizingAllInstancesRun) planInstanceTypes(
+	instanceTypes []string,
+	allInstanceRunResults *AllInstanceRunResults) ([]string, map[string]*AWSSizingSingleRun, []*AWSSizingSingleRun) {
+	queue := []string{}
+	aliveRuns := map[string]*AWSSizingSingleRun{}
+	staleRuns := []*AWSSizingSingleRun{}
+	for _, instanceType := range instanceTypes {
+		existingResults, ok := allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)]
+		if ok && existingResults.State == GetStateString(FINISHED) {
+			continue
+		}
+
+		if ok && existingResults.State == GetStateString(RUNNING) {
+			if singleRun := run.findAliveSingleRun(existingResults); singleRun != nil {
+				if !isStaleRunning(existingResults, run.SizingConfig.StaleRunningTimeout) {
+					aliveRuns[instanceType] = singleRun
+					continue
+				}
+				staleRuns = append(staleRuns, singleRun)
+			}
+		}
+
+		allInstanceRunResults.TestResults[instanceTypeDbName(instanceType)] = &InstanceResults{
+			State: GetStateString(PENDING),
+		}
+		queue = append(queue, instanceType)
+	}
+
+	return queue, aliveRuns, staleRuns
+}
+
+// isStaleRunning returns if the instance type is left running by a sizing
+// run for longer than the timeout. Instance results stored before their start
+// time was recorded are always stale.
+func isStaleRunning(instanceResults *InstanceResults, timeout time.Duration) bool {
+	return instanceResults.State == GetStateString(RUNNING) &&
+		time.Since(instanceResults.Started) > timeout
+}
@@ -0,0 +1,127 @@
+package runners
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperpilotio/workload-profiler/jobs"
+	"github.com/hyperpilotio/workload-profiler/models"
+	"github.com/spf13/viper"
+)
+
+func TestGetSizingConfig(t *testing.T) {
+	sizingConfig, err := GetSizingConfig(viper.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizingConfig.MaxConcurrentInstances != defaultMaxConcurrentInstances ||
+		sizingConfig.StaleRunningTimeout != defaultStaleRunningTimeout {
+		t.Errorf("Unexpected default sizing config: %+v", sizingConfig)
+	}
+
+	config := viper.New()
+	config.Set("sizing.staleRunningTimeout", "1 hour")
+	if _, err := GetSizingConfig(config); err == nil {
+		t.Error("Expected invalid stale running timeout to fail")
+	}
+}
+
+func TestPlanInstanceTypes(t *testing.T) {
+	aliveRun := &AWSSizingSingleRun{ProfileRun: ProfileRun{Id: "resumed-m4.large", State: jobs.JOB_RUNNING}}
+	staleRun := &AWSSizingSingleRun{ProfileRun: ProfileRun{Id: "resumed-m4.xlarge", State: jobs.JOB_QUEUED}}
+	finishedRun := &AWSSizingSingleRun{ProfileRun: ProfileRun{Id: "resumed-c4.xlarge", State: jobs.JOB_FAILED}}
+	run := &AWSSizingAllInstancesRun{
+		AWSSizingRun: AWSSizingRun{
+			JobManager: &jobs.JobManager{Jobs: map[string]jobs.Job{
+				aliveRun.GetId():    aliveRun,
+				staleRun.GetId():    staleRun,
+				finishedRun.GetId(): finishedRun,
+			}},
+		},
+		SizingConfig: SizingConfig{StaleRunningTimeout: time.Hour},
+	}
+
+	results := &AllInstanceRunResults{TestResults: map[string]*InstanceResults{
+		"c4-large":  {State: GetStateString(FINISHED)},
+		"m4-large":  {State: GetStateString(RUNNING), Started: time.Now(), SingleRunId: aliveRun.GetId()},
+		"m4-xlarge": {State: GetStateString(RUNNING), Started: time.Now().Add(-2 * time.Hour), SingleRunId: staleRun.GetId()},
+		"c4-xlarge": {State: GetStateString(RUNNING), Started: time.Now(), SingleRunId: finishedRun.GetId()},
+		"r4-large":  {State: GetStateString(FAILED)},
+	}}
+	queue, aliveRuns, staleRuns := run.planInstanceTypes(
+		[]string{"c4.large", "m4.large", "m4.xlarge", "c4.xlarge", "r4.large", "r4.xlarge"}, results)
+
+	// The alive single run is waited on instead of sizing its instance type again.
+	if len(aliveRuns) != 1 || aliveRuns["m4.large"] != aliveRun {
+		t.Errorf("Expected m4.large single run to be waited on, got %v", aliveRuns)
+	}
+	if results.TestResults["m4-large"].State != GetStateString(RUNNING) {
+		t.Errorf("Expected m4.large to be left running, got %s", results.TestResults["m4-large"].State)
+	}
+	if len(staleRuns) != 1 || staleRuns[0] != staleRun {
+		t.Errorf("Expected m4.xlarge single run to be stale, got %v", staleRuns)
+	}
+
+	expected := []string{"m4.xlarge", "c4.xlarge", "r4.large", "r4.xlarge"}
+	if !reflect.DeepEqual(queue, expected) {
+		t.Errorf("Expected instance types %v to be sized, got %v", expected, queue)
+	}
+	for _, instanceType := range expected {
+		if state := results.TestResults[instanceTypeDbName(instanceType)].State; state != GetStateString(PENDING) {
+			t.Errorf("Expected %s to be pending, got %s", instanceType, state)
+		}
+	}
+}
+
+func TestWatchSingleRun(t *testing.T) {
+	run := &AWSSizingAllInstancesRun{}
+	singleRun := &AWSSizingSingleRun{
+		ProfileRun:  ProfileRun{Id: "resumed-m4.large"},
+		ResultsChan: make(chan *jobs.JobResults, 1),
+	}
+	resultsChan := make(chan instanceRunResult)
+	go run.watchSingleRun(context.Background(), "m4.large", singleRun, resultsChan)
+
+	singleRun.publishResults(&jobs.JobResults{
+		Data: SizeRunResults{QosValue: models.SLO{Value: 1200}},
+	})
+	result := <-resultsChan
+	if result.instanceType != "m4.large" || result.singleRun != singleRun || result.failure != "" {
+		t.Errorf("Unexpected m4.large results: %+v", result)
+	}
+	if result.results == nil || result.results.QosValue.Value != 1200 {
+		t.Errorf("Expected m4.large QoS value 1200, got %+v", result.results)
+	}
+
+	// The results of a cancelled run aren't waited on.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		run.watchSingleRun(ctx, "m4.xlarge", &AWSSizingSingleRun{ResultsChan: make(chan *jobs.JobResults)}, resultsChan)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected watching a single run to stop once the run is cancelled")
+	}
+}
+
+func TestIsStaleRunning(t *testing.T) {
+	started := time.Now().Add(-2 * time.Hour)
+	if !isStaleRunning(&InstanceResults{State: GetStateString(RUNNING), Started: started}, time.Hour) {
+		t.Error("Expected instance type running for 2 hours to be stale")
+	}
+	if isStaleRunning(&InstanceResults{State: GetStateString(RUNNING), Started: started}, 3*time.Hour) {
+		t.Error("Expected instance type running within the timeout not to be stale")
+	}
+	if !isStaleRunning(&InstanceResults{State: GetStateString(RUNNING)}, time.Hour) {
+		t.Error("Expected instance type running without a start time to be stale")
+	}
+	if isStaleRunning(&InstanceResults{State: GetStateString(FINISHED), Started: started}, time.Hour) {
+		t.Error("Expected finished instance type not to be stale")
+	}
+}
@@ -0,0 +1,171 @@
+package runners
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+// TrialConfig configures how many times a load test is repeated to get a
+// stable QoS value. Extra trials are run while the coefficient of variation
+// of the QoS values is above CVThreshold, up to MaxCount trials.
+type TrialConfig struct {
+	Count        int     `mapstructure:"count"`
+	MaxCount     int     `mapstructure:"maxCount"`
+	CVThreshold  float64 `mapstructure:"cvThreshold"`
+	DropOutliers bool    `mapstructure:"dropOutliers"`
+}
+
+// tValues95 are the two-sided 95% student's t values by degrees of freedom.
+var tValues95 = []float64{
+	0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// GetTrialConfig reads the trials config, which defaults to a single trial.
+func GetTrialConfig(config *viper.Viper) (TrialConfig, error) {
+	trialConfig := TrialConfig{}
+	if err := config.UnmarshalKey("trials", &trialConfig); err != nil {
+		return trialConfig, errors.New("Unable to parse trials config: " + err.Error())
+	}
+
+	if trialConfig.Count <= 0 {
+		trialConfig.Count = 1
+	}
+	if trialConfig.MaxCount < trialConfig.Count {
+		trialConfig.MaxCount = trialConfig.Count
+	}
+
+	return trialConfig, nil
+}
+
+// runTrials repeats the trial load test as configured, and returns the results
+// of every trial along with their QoS stats.
+func runTrials(
+	trialConfig TrialConfig,
+	log *logging.Logger,
+	runTrial func(trial int) ([]*models.BenchmarkResult, error)) ([]*models.BenchmarkResult, *models.QosStats, error) {
+	results := []*models.BenchmarkResult{}
+	stats := &models.QosStats{}
+	for trial := 1; trial <= trialConfig.MaxCount; trial++ {
+		trialResults, err := runTrial(trial)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, result := range trialResults {
+			result.Trial = trial
+			results = append(results, result)
+		}
+
+		stats = computeQosStats(results, trialConfig.DropOutliers)
+		stats.Trials = trial
+		if trial < trialConfig.Count {
+			continue
+		}
+
+		if stats.CV <= trialConfig.CVThreshold || trialConfig.CVThreshold <= 0 {
+			break
+		}
+
+		if trial < trialConfig.MaxCount {
+			log.Infof("QoS values are noisy with cv %0.3f after %d trials, running another trial", stats.CV, trial)
+		} else {
+			log.Warningf("QoS values are still noisy with cv %0.3f after max %d trials", stats.CV, trial)
+		}
+	}
+
+	return results, stats, nil
+}
+
+// computeQosStats flags the outliers in the results, and computes the stats of
+// the QoS values. Outliers are left out of the stats if dropOutliers is set.
+func computeQosStats(results []*models.BenchmarkResult, dropOutliers bool) *models.QosStats {
+	stats := &models.QosStats{}
+	markOutliers(results)
+
+	values := []float64{}
+	for _, result := range results {
+		if result.Outlier {
+			stats.Outliers += 1
+			if dropOutliers {
+				continue
+			}
+		}
+		values = append(values, result.QosValue)
+	}
+
+	stats.Samples = len(values)
+	if len(values) == 0 {
+		return stats
+	}
+
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	stats.Mean = total / float64(len(values))
+
+	if len(values) > 1 {
+		var squares float64
+		for _, value := range values {
+			squares += (value - stats.Mean) * (value - stats.Mean)
+		}
+		stats.Stddev = math.Sqrt(squares / float64(len(values)-1))
+	}
+
+	if stats.Mean != 0 {
+		stats.CV = stats.Stddev / math.Abs(stats.Mean)
+	}
+
+	sort.Float64s(values)
+	stats.P50 = percentile(values, 50)
+
+	tValue := 1.96
+	if degrees := len(values) - 1; degrees > 0 && degrees < len(tValues95) {
+		tValue = tValues95[degrees]
+	}
+	margin := tValue * stats.Stddev / math.Sqrt(float64(len(values)))
+	stats.CILow = stats.Mean - margin
+	stats.CIHigh = stats.Mean + margin
+
+	return stats
+}
+
+// markOutliers flags the results outside 1.5 interquartile ranges of the
+// quartiles. At least 4 results are needed to find outliers.
+func markOutliers(results []*models.BenchmarkResult) {
+	if len(results) < 4 {
+		return
+	}
+
+	values := []float64{}
+	for _, result := range results {
+		values = append(values, result.QosValue)
+	}
+	sort.Float64s(values)
+
+	q1 := percentile(values, 25)
+	q3 := percentile(values, 75)
+	iqr := q3 - q1
+	for _, result := range results {
+		result.Outlier = result.QosValue < q1-1.5*iqr || result.QosValue > q3+1.5*iqr
+	}
+}
+
+// percentile interpolates the percentile of the sorted values.
+func percentile(sortedValues []float64, p float64) float64 {
+	if len(sortedValues) == 1 {
+		return sortedValues[0]
+	}
+
+	rank := p / 100 * float64(len(sortedValues)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sortedValues[lower] + (rank-float64(lower))*(sortedValues[upper]-sortedValues[lower])
+}
@@ -0,0 +1,143 @@
+package runners
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/hyperpilotio/workload-profiler/models"
+	logging "github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+func TestGetTrialConfig(t *testing.T) {
+	trialConfig, err := GetTrialConfig(viper.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trialConfig.Count != 1 || trialConfig.MaxCount != 1 {
+		t.Errorf("Expected a single trial by default, got %+v", trialConfig)
+	}
+
+	config := viper.New()
+	config.Set("trials", map[string]interface{}{"count": 3, "maxCount": 2})
+	if trialConfig, err = GetTrialConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if trialConfig.Count != 3 || trialConfig.MaxCount != 3 {
+		t.Errorf("Expected max count raised to the count of 3, got %+v", trialConfig)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	if p := percentile([]float64{7}, 95); p != 7 {
+		t.Errorf("Expected p95 of a single value to be 7, got %f", p)
+	}
+
+	values := []float64{1, 2, 3, 4}
+	for p, expected := range map[float64]float64{0: 1, 25: 1.75, 50: 2.5, 100: 4} {
+		if value := percentile(values, p); math.Abs(value-expected) > 1e-9 {
+			t.Errorf("Expected p%.0f of %v to be %f, got %f", p, values, expected, value)
+		}
+	}
+}
+
+func TestMarkOutliers(t *testing.T) {
+	results := []*models.BenchmarkResult{{QosValue: 10}, {QosValue: 11}, {QosValue: 100}, {QosValue: 12}, {QosValue: 13}}
+	markOutliers(results)
+	for i, result := range results {
+		if result.Outlier != (i == 2) {
+			t.Errorf("Unexpected outlier %t for QoS value %f", result.Outlier, result.QosValue)
+		}
+	}
+
+	// Outliers aren't searched with less than 4 results.
+	results = []*models.BenchmarkResult{{QosValue: 10}, {QosValue: 11}, {QosValue: 1000}}
+	markOutliers(results)
+	for _, result := range results {
+		if result.Outlier {
+			t.Errorf("Unexpected outlier for QoS value %f", result.QosValue)
+		}
+	}
+}
+
+func TestComputeQosStats(t *testing.T) {
+	stats := computeQosStats([]*models.BenchmarkResult{{QosValue: 10}, {QosValue: 12}, {QosValue: 14}}, false)
+	margin := 4.303 * 2 / math.Sqrt(3)
+	if stats.Samples != 3 || stats.Mean != 12 || stats.Stddev != 2 || stats.P50 != 12 {
+		t.Errorf("Unexpected stats: %+v", *stats)
+	}
+	if math.Abs(stats.CV-2.0/12) > 1e-9 {
+		t.Errorf("Expected cv %f, got %f", 2.0/12, stats.CV)
+	}
+	if math.Abs(stats.CILow-(12-margin)) > 1e-9 || math.Abs(stats.CIHigh-(12+margin)) > 1e-9 {
+		t.Errorf("Expected confidence interval [%f, %f], got [%f, %f]", 12-margin, 12+margin, stats.CILow, stats.CIHigh)
+	}
+
+	results := []*models.BenchmarkResult{{QosValue: 10}, {QosValue: 10}, {QosValue: 100}, {QosValue: 10}, {QosValue: 10}}
+	if stats := computeQosStats(results, false); stats.Samples != 5 || stats.Outliers != 1 || stats.Mean != 28 {
+		t.Errorf("Expected outlier to be kept in stats, got %+v", *stats)
+	}
+	if stats := computeQosStats(results, true); stats.Samples != 4 || stats.Outliers != 1 || stats.Mean != 10 || stats.CIHigh != 10 {
+		t.Errorf("Expected outlier to be dropped from stats, got %+v", *stats)
+	}
+}
+
+func TestRunTrials(t *testing.T) {
+	logger := logging.MustGetLogger("trials_test")
+	trialValues := [][]float64{{100, 200}, {150, 150}, {150, 150}}
+	runTrial := func(trial int) ([]*models.BenchmarkResult, error) {
+		return []*models.BenchmarkResult{
+			{QosValue: trialValues[trial-1][0]},
+			{QosValue: trialValues[trial-1][1]},
+		}, nil
+	}
+
+	// Noisy trials are repeated up to the max count.
+	results, stats, err := runTrials(TrialConfig{Count: 1, MaxCount: 3, CVThreshold: 0.1}, logger, runTrial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Trials != 3 || len(results) != 6 || results[5].Trial != 3 {
+		t.Errorf("Expected 3 trials of 2 results, got %d trials of %d results", stats.Trials, len(results))
+	}
+
+	// Without a cv threshold only the configured count of trials is run.
+	if results, stats, err = runTrials(TrialConfig{Count: 2, MaxCount: 3}, logger, runTrial); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Trials != 2 || len(results) != 4 {
+		t.Errorf("Expected 2 trials of 2 results, got %d trials of %d results", stats.Trials, len(results))
+	}
+
+	trialValues = [][]float64{{100, 101}, {100, 101}, {100, 101}}
+	if _, stats, err = runTrials(TrialConfig{Count: 1, MaxCount: 3, CVThreshold: 0.1}, logger, runTrial); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Trials != 1 {
+		t.Errorf("Expected stable results to stop after 1 trial, got %d", stats.Trials)
+	}
+
+	_, _, err = runTrials(TrialConfig{Count: 2, MaxCount: 2}, logger, func(trial int) ([]*models.BenchmarkResult, error) {
+		if trial == 2 {
+			return nil, errors.New("load test failed")
+		}
+		return runTrial(trial)
+	})
+	if err == nil {
+		t.Error("Expected failed trial to fail the trials")
+	}
+}
+
+func TestRunTrialsWithoutTrials(t *testing.T) {
+	results, stats, err := runTrials(TrialConfig{}, logging.MustGetLogger("trials_test"), func(trial int) ([]*models.BenchmarkResult, error) {
+		t.Errorf("Unexpected trial %d", trial)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 || stats == nil || stats.Trials != 0 || stats.Samples != 0 {
+		t.Errorf("Expected empty stats without trials, got %d results and stats %+v", len(results), stats)
+	}
+}
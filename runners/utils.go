@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/golang/glog"
 	"github.com/hyperpilotio/workload-profiler/clients"
+	"github.com/hyperpilotio/workload-profiler/jobs"
 	"github.com/hyperpilotio/workload-profiler/models"
 	"github.com/nu7hatch/gouuid"
 	logging "github.com/op/go-logging"
@@ -20,6 +22,28 @@ func generateId(prefix string) (string, error) {
 	return prefix + "-" + u4.String(), nil
 }
 
+func newJobRequest(
+	jobType string,
+	applicationConfig *models.ApplicationConfig,
+	skipUnreserveOnFailure bool,
+	parameters interface{}) jobs.JobRequest {
+	request := jobs.JobRequest{
+		Type:                   jobType,
+		AppName:                applicationConfig.Name,
+		SkipUnreserveOnFailure: skipUnreserveOnFailure,
+	}
+
+	if parameters != nil {
+		if b, err := json.Marshal(parameters); err != nil {
+			glog.Warningf("Unable to marshal %s job parameters: %s", jobType, err.Error())
+		} else {
+			request.Parameters = string(b)
+		}
+	}
+
+	return request
+}
+
 func min(a int, b int) int {
 	if a > b {
 		return b
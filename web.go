@@ -2,16 +2,24 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hyperpilotio/workload-profiler/jobs"
 )
 
+// logPollInterval is how often the log of a run is checked for new lines
+// while its events are streamed.
+const logPollInterval = 500 * time.Millisecond
+
 type FileLogs []jobs.JobSummary
 
 func (d FileLogs) Len() int { return len(d) }
@@ -54,8 +62,7 @@ func (server *Server) getFileLogContent(c *gin.Context) {
 		return
 	}
 
-	logPath := path.Join(server.Config.GetString("filesPath"), "log", fileName+".log")
-	file, err := os.Open(logPath)
+	file, err := os.Open(server.getLogPath(fileName))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": true,
@@ -87,14 +94,14 @@ func (server *Server) getFileLogs(c *gin.Context) (FileLogs, error) {
 
 	filterStatus := strings.ToUpper(c.Param("status"))
 	switch filterStatus {
-	case jobs.JOB_QUEUED, jobs.JOB_RESERVING, jobs.JOB_RUNNING, jobs.JOB_FINISHED:
+	case jobs.JOB_QUEUED, jobs.JOB_RESERVING, jobs.JOB_RUNNING, jobs.JOB_FINISHED, jobs.JOB_CANCELLED:
 		for _, job := range server.JobManager.GetJobs() {
 			if job == nil {
 				continue
 			}
 			fileLog := job.GetSummary()
 			switch fileLog.Status {
-			case jobs.JOB_QUEUED, jobs.JOB_RESERVING, jobs.JOB_RUNNING, jobs.JOB_FINISHED:
+			case jobs.JOB_QUEUED, jobs.JOB_RESERVING, jobs.JOB_RUNNING, jobs.JOB_FINISHED, jobs.JOB_CANCELLED:
 				fileLogs = append(fileLogs, job.GetSummary())
 			}
 		}
@@ -110,3 +117,142 @@ func (server *Server) getFileLogs(c *gin.Context) (FileLogs, error) {
 	sort.Sort(fileLogs)
 	return fileLogs, nil
 }
+
+func (server *Server) getLogPath(runId string) string {
+	return path.Join(server.Config.GetString("filesPath"), "log", runId+".log")
+}
+
+// logTail reads the lines appended to a log file since the offset.
+type logTail struct {
+	Path   string
+	Offset int64
+}
+
+// newLogTail starts tailing the log from the offset, or from the end of the
+// log if the offset is empty.
+func newLogTail(logPath string, offset string) (*logTail, error) {
+	tail := &logTail{
+		Path: logPath,
+	}
+
+	if offset != "" {
+		value, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || value < 0 {
+			return nil, errors.New("Invalid log offset: " + offset)
+		}
+		tail.Offset = value
+	} else if info, err := os.Stat(logPath); err == nil {
+		tail.Offset = info.Size()
+	}
+
+	return tail, nil
+}
+
+// ReadLines returns the complete lines appended since the last read. A
+// partially written line is returned once it's complete.
+func (tail *logTail) ReadLines() ([]string, error) {
+	file, err := os.Open(tail.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(tail.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		tail.Offset += int64(len(line))
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+
+	return lines, nil
+}
+
+// streamRunEvents streams the state transitions and progress of the run, and
+// the lines appended to its log, as server-sent events until the run ends or
+// the client disconnects. Log lines are streamed from the logOffset byte
+// offset, which defaults to the end of the log, and carry the offset after
+// them to resume from.
+func (server *Server) streamRunEvents(c *gin.Context) {
+	runId := c.Param("runId")
+	job, err := server.JobManager.FindJob(runId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": true,
+			"data":  err.Error(),
+		})
+		return
+	}
+
+	tail, err := newLogTail(server.getLogPath(runId), c.Query("logOffset"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": true,
+			"data":  err.Error(),
+		})
+		return
+	}
+
+	events := server.JobManager.JobStore.Events
+	pending, subscriber := events.Subscribe(runId)
+	defer events.Unsubscribe(runId, subscriber)
+
+	// Jobs restored from the job store have no events, their state is sent instead.
+	if len(pending) == 0 {
+		pending = append(pending, jobs.JobEvent{
+			Type:  jobs.StateEventType,
+			RunId: runId,
+			State: job.GetState(),
+			Time:  time.Now(),
+		})
+	}
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	ended := false
+	sendEvent := func(event jobs.JobEvent) {
+		c.SSEvent(event.Type, event)
+		if event.Type == jobs.StateEventType && jobs.IsFinalState(event.State) {
+			ended = true
+		}
+	}
+	c.Stream(func(w io.Writer) bool {
+		for _, event := range pending {
+			sendEvent(event)
+		}
+		pending = nil
+
+		if !ended {
+			select {
+			case event := <-subscriber:
+				sendEvent(event)
+			case <-ticker.C:
+			}
+		}
+
+		lines, err := tail.ReadLines()
+		if err != nil {
+			c.SSEvent("logError", "Unable to read log: "+err.Error())
+			return false
+		}
+		for _, line := range lines {
+			c.SSEvent("log", gin.H{
+				"line":   line,
+				"offset": tail.Offset,
+			})
+		}
+
+		// The stream ends once the run's final state and log lines are sent.
+		return !ended
+	})
+}